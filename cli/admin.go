@@ -0,0 +1,573 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/michaelhass/cpaw/config"
+	"github.com/michaelhass/cpaw/db"
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/models"
+	"github.com/michaelhass/cpaw/service"
+)
+
+var (
+	ErrInvalidArguments = errors.New("Invalid arguments")
+	ErrDatabaseNotFound = errors.New("Database not found")
+)
+
+// AdminCommands work on the database of the server directly. They read the
+// database path from the server config, see package config, unless -db is
+// passed.
+func AdminCommands() []Command {
+	return []Command{
+		{Name: "user", Usage: "Manage users of the server", Run: runUser},
+		{Name: "session", Usage: "Manage sessions of the server", Run: runSession},
+		{Name: "migrate", Usage: "Migrate the database of the server", Run: runMigrate},
+		{Name: "backup", Usage: "Write a backup of the database of the server", Run: runBackup},
+		{Name: "restore", Usage: "Replace the database of the server with a backup", Run: runRestore},
+		{Name: "export", Usage: "Export the clipboard history of users", Run: runExport},
+		{Name: "import", Usage: "Import an exported clipboard history", Run: runImport},
+	}
+}
+
+func runUser(ctx context.Context, env Env, args []string) error {
+	return run(ctx, env, "cpaw user", []Command{
+		{Name: "create", Usage: "Create a user. The password is read from stdin", Run: runUserCreate},
+		{Name: "list", Usage: "List users", Run: runUserList},
+		{Name: "delete", Usage: "Delete a user including all of its items", Run: runUserDelete},
+		{Name: "reset-password", Usage: "Set a new password and sign out the user", Run: runUserResetPassword},
+		{Name: "set-role", Usage: "Change the role of a user", Run: runUserSetRole},
+	}, args)
+}
+
+func runSession(ctx context.Context, env Env, args []string) error {
+	return run(ctx, env, "cpaw session", []Command{
+		{Name: "purge", Usage: "Sign out all users, a single user or delete expired sessions", Run: runSessionPurge},
+	}, args)
+}
+
+func runMigrate(ctx context.Context, env Env, args []string) error {
+	return run(ctx, env, "cpaw migrate", []Command{
+		{Name: "up", Usage: "Apply all pending migrations", Run: runMigrateUp},
+		{Name: "down", Usage: "Roll back migrations", Run: runMigrateDown},
+		{Name: "version", Usage: "Print the migration version", Run: runMigrateVersion},
+	}, args)
+}
+
+// admin gives commands access to the database of the server.
+type admin struct {
+	database      db.Database
+	users         repository.UserStore
+	sessions      repository.SessionStore
+	loginAttempts repository.LoginAttemptStore
+	authService   *service.AuthService
+	exportService *service.ExportService
+}
+
+// loadServerConfig loads the config of the server. A non-empty dbPath
+// overrides the configured database path.
+func loadServerConfig(env Env, dbPath string) (config.Config, error) {
+	conf, err := config.Load(nil, os.Getenv, env.Stderr)
+	if err != nil {
+		return conf, err
+	}
+	if len(dbPath) > 0 {
+		conf.DbPath = dbPath
+	}
+	return conf, nil
+}
+
+// openDatabase opens an existing database. It doesn't create a new SQLite
+// database to not silently work on the wrong file.
+func openDatabase(env Env, dbPath string) (db.Database, config.Config, error) {
+	conf, err := loadServerConfig(env, dbPath)
+	if err != nil {
+		return nil, conf, err
+	}
+	if db.Backend(conf.DbBackend) == db.SqliteBackend {
+		if _, err := os.Stat(conf.DbPath); errors.Is(err, fs.ErrNotExist) {
+			return nil, conf, fmt.Errorf("%w: %s", ErrDatabaseNotFound, conf.DbPath)
+		} else if err != nil {
+			return nil, conf, err
+		}
+	}
+
+	database, err := conf.OpenDatabase()
+	if err != nil {
+		return nil, conf, err
+	}
+	return database, conf, nil
+}
+
+// openSqlite opens the database for commands, which only support SQLite.
+func openSqlite(env Env, dbPath string) (*db.Sqlite, error) {
+	database, _, err := openDatabase(env, dbPath)
+	if err != nil {
+		return nil, err
+	}
+	sqlite, ok := database.(*db.Sqlite)
+	if !ok {
+		database.Close()
+		return nil, fmt.Errorf("%w: only sqlite is supported", db.ErrUnsupportedBackend)
+	}
+	return sqlite, nil
+}
+
+// openAdmin opens the database and applies pending migrations like the server
+// does on start.
+func openAdmin(env Env, dbPath string) (*admin, error) {
+	database, conf, err := openDatabase(env, dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.SetUp(); err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	conn := database.Conn()
+	users := repository.NewUserRepository(conn)
+	sessions := repository.NewSessionRespository(conn)
+	loginAttempts := repository.NewLoginAttemptRepository(conn)
+	items := repository.NewItemRepository(conn, repository.WithBackend(database.Backend()))
+	authService := service.NewAuthService(
+		sessions,
+		users,
+		repository.NewApiTokenRepository(conn),
+		loginAttempts,
+		repository.NewTwoFactorRepository(conn),
+		service.WithAuthConfig(conf.AuthConfig()),
+	)
+	return &admin{
+		database:      database,
+		users:         users,
+		sessions:      sessions,
+		loginAttempts: loginAttempts,
+		authService:   authService,
+		exportService: service.NewExportService(items, users),
+	}, nil
+}
+
+func (a *admin) Close() error {
+	return a.database.Close()
+}
+
+func (a *admin) getUser(ctx context.Context, userName string) (models.User, error) {
+	user, err := a.authService.GetUserByName(ctx, userName)
+	if errors.Is(err, repository.ErrNotFound) {
+		return user, fmt.Errorf("%w: %s", service.ErrUnknownUser, userName)
+	}
+	return user, err
+}
+
+// parseAdminFlags parses the flags of an admin command and checks the number
+// of positional arguments.
+func parseAdminFlags(flags *flag.FlagSet, args []string, argCount int) (dbPath string, err error) {
+	dbFlag := flags.String("db", "", "Path of the database. Defaults to the server config")
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if flags.NArg() != argCount {
+		flags.Usage()
+		return "", ErrInvalidArguments
+	}
+	return *dbFlag, nil
+}
+
+func runUserCreate(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "user create", "user create [--role ROLE] NAME < password")
+	role := flags.String("role", string(models.UserRole), "Role of the user: user or admin")
+	dbPath, err := parseAdminFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	a, err := openAdmin(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	password, err := readPassword(env)
+	if err != nil {
+		return err
+	}
+	user, err := a.authService.CreateUser(ctx, service.CreateUserParams{
+		UserName: flags.Arg(0),
+		Password: password,
+		Role:     models.Role(*role),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stdout, user.Id)
+	return nil
+}
+
+func runUserList(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "user list", "user list")
+	dbPath, err := parseAdminFlags(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	a, err := openAdmin(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	users, err := a.authService.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+	for _, user := range users {
+		twoFactor := ""
+		if user.TwoFactorEnabled {
+			twoFactor = "2fa"
+		}
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\n",
+			user.Id,
+			user.UserName,
+			user.Role,
+			time.Unix(user.CreatedAt, 0).Format("2006-01-02 15:04"),
+			twoFactor,
+		)
+	}
+	return w.Flush()
+}
+
+func runUserDelete(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "user delete", "user delete NAME")
+	dbPath, err := parseAdminFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	a, err := openAdmin(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	user, err := a.getUser(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := a.users.DeleteUserById(ctx, user.Id); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stderr, "Deleted user", user.UserName)
+	return nil
+}
+
+func runUserResetPassword(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "user reset-password", "user reset-password NAME < password")
+	dbPath, err := parseAdminFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	a, err := openAdmin(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	user, err := a.getUser(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	password, err := readPassword(env)
+	if err != nil {
+		return err
+	}
+	// Without a session to keep, all sessions of the user are signed out.
+	err = a.authService.UpdatePassword(ctx, service.UpdatePasswordParams{UserId: user.Id, Password: password})
+	if err != nil {
+		return err
+	}
+	// A forgotten password often comes with a locked account.
+	err = a.loginAttempts.DeleteLoginAttempt(ctx, repository.GetLoginAttemptParams{
+		Scope: models.UserNameLoginAttemptScope,
+		Key:   user.UserName,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stderr, "Password updated for", user.UserName)
+	return nil
+}
+
+func runUserSetRole(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "user set-role", "user set-role NAME ROLE")
+	dbPath, err := parseAdminFlags(flags, args, 2)
+	if err != nil {
+		return err
+	}
+
+	a, err := openAdmin(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	user, err := a.getUser(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	err = a.authService.SetUserRole(ctx, service.SetUserRoleParams{
+		UserId: user.Id,
+		Role:   models.Role(flags.Arg(1)),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Stderr, "%s is now %s\n", user.UserName, flags.Arg(1))
+	return nil
+}
+
+func runSessionPurge(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "session purge", "session purge [--user NAME | --expired]")
+	userName := flags.String("user", "", "Only sign out the user with this name")
+	expired := flags.Bool("expired", false, "Only delete expired sessions")
+	dbPath, err := parseAdminFlags(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	a, err := openAdmin(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	switch {
+	case *expired:
+		err = a.sessions.DeleteExpired(ctx)
+	case len(*userName) > 0:
+		var user models.User
+		if user, err = a.getUser(ctx, *userName); err == nil {
+			// Without a session to keep, all sessions of the user are deleted.
+			err = a.sessions.DeleteOtherSessionsForUser(ctx, repository.DeleteOtherSessionsForUserParams{
+				UserId: user.Id,
+			})
+		}
+	default:
+		err = a.sessions.DeleteAll(ctx)
+	}
+	return err
+}
+
+func runMigrateUp(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "migrate up", "migrate up")
+	dbPath, err := parseAdminFlags(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	database, _, err := openDatabase(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.MigrateUp(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return printMigrationVersion(env.Stdout, database)
+}
+
+func runMigrateDown(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "migrate down", "migrate down [--steps N | --all]")
+	steps := flags.Int("steps", 1, "Number of migrations to roll back")
+	all := flags.Bool("all", false, "Roll back all migrations, which deletes all data")
+	dbPath, err := parseAdminFlags(flags, args, 0)
+	if err != nil {
+		return err
+	}
+	if *steps < 1 {
+		flags.Usage()
+		return fmt.Errorf("Invalid number of steps: %d", *steps)
+	}
+
+	database, _, err := openDatabase(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if *all {
+		err = database.MigrateDown()
+	} else {
+		err = database.MigrateSteps(-*steps)
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return printMigrationVersion(env.Stdout, database)
+}
+
+func runMigrateVersion(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "migrate version", "migrate version")
+	dbPath, err := parseAdminFlags(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	database, _, err := openDatabase(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	return printMigrationVersion(env.Stdout, database)
+}
+
+func runBackup(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "backup", "backup FILE")
+	dbPath, err := parseAdminFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	sqlite, err := openSqlite(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer sqlite.Close()
+
+	return sqlite.Backup(ctx, flags.Arg(0))
+}
+
+func runRestore(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "restore", "restore FILE. Stop the server first")
+	dbPath, err := parseAdminFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	conf, err := loadServerConfig(env, dbPath)
+	if err != nil {
+		return err
+	}
+	if db.Backend(conf.DbBackend) != db.SqliteBackend {
+		return fmt.Errorf("%w: only sqlite is supported", db.ErrUnsupportedBackend)
+	}
+
+	previousPath, err := db.Restore(ctx, flags.Arg(0), conf.DbPath)
+	if err != nil {
+		return err
+	}
+	if len(previousPath) > 0 {
+		fmt.Fprintln(env.Stderr, "Moved previous database to", previousPath)
+	}
+	fmt.Fprintln(env.Stderr, "Restored", conf.DbPath)
+	return nil
+}
+
+func runExport(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "export", "export [--user NAME] [--format zip|jsonl] FILE")
+	userName := flags.String("user", "", "Only export the items of the user with this name")
+	format := flags.String("format", string(service.ZipExportFormat), "Format of the export: zip or jsonl")
+	dbPath, err := parseAdminFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	if !service.ExportFormat(*format).IsValid() {
+		return service.ErrInvalidExportFormat
+	}
+
+	a, err := openAdmin(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	params := service.ExportItemsParams{Format: service.ExportFormat(*format)}
+	if len(*userName) > 0 {
+		user, err := a.getUser(ctx, *userName)
+		if err != nil {
+			return err
+		}
+		params.UserId = user.Id
+	}
+
+	file, err := os.OpenFile(flags.Arg(0), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	err = a.exportService.ExportItems(ctx, params, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func runImport(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "import", "import [--user NAME] FILE")
+	userName := flags.String("user", "", "Import all items for the user with this name instead of the exported users")
+	dbPath, err := parseAdminFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	a, err := openAdmin(env, dbPath)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	params := service.ImportItemsParams{}
+	if len(*userName) > 0 {
+		user, err := a.getUser(ctx, *userName)
+		if err != nil {
+			return err
+		}
+		params.UserId = user.Id
+	}
+	if params.Data, err = os.ReadFile(flags.Arg(0)); err != nil {
+		return err
+	}
+
+	result, err := a.exportService.ImportItems(ctx, params)
+	if err != nil {
+		return err
+	}
+	for _, conflict := range result.Conflicts {
+		fmt.Fprintf(env.Stdout, "line %d\t%s\t%s\n", conflict.Line, conflict.ItemId, conflict.Reason)
+	}
+	fmt.Fprintf(env.Stderr, "Imported %d items, skipped %d\n", result.Imported, len(result.Conflicts))
+	return nil
+}
+
+func printMigrationVersion(w io.Writer, database db.Database) error {
+	version, dirty, err := database.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		fmt.Fprintln(w, "none")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	line := strconv.FormatUint(uint64(version), 10)
+	if dirty {
+		line += " (dirty)"
+	}
+	fmt.Fprintln(w, line)
+	return nil
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/michaelhass/cpaw/db"
+	"github.com/michaelhass/cpaw/models"
+)
+
+func TestAdminCommands(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "cpaw.db")
+	t.Setenv("CPAW_CONFIG", "")
+	t.Setenv("CPAW_DB_PATH", dbPath)
+
+	ctx := context.Background()
+	run := func(t *testing.T, stdin string, args ...string) (string, error) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		env := Env{Stdin: strings.NewReader(stdin), Stdout: &stdout, Stderr: &stderr}
+		err := Run(ctx, env, AdminCommands(), args)
+		return stdout.String(), err
+	}
+
+	if _, err := run(t, "", "user", "list"); !errors.Is(err, ErrDatabaseNotFound) {
+		t.Fatal("Expected 'ErrDatabaseNotFound'. Got: ", err)
+	}
+	sqlite, err := db.NewSqlite(db.WithDbPath(dbPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlite.SetUp(); err != nil {
+		t.Fatal(err)
+	}
+	sqlite.Close()
+
+	t.Run("Migrate", func(t *testing.T) {
+		before, err := run(t, "", "migrate", "version")
+		if err != nil || before == "none\n" {
+			t.Fatalf("Expected migration version. Got: %q %v", before, err)
+		}
+		if _, err := run(t, "", "migrate", "down"); err != nil {
+			t.Fatal(err)
+		}
+		after, err := run(t, "", "migrate", "up")
+		if err != nil || after != before {
+			t.Errorf("Expected version %q after migrating up. Got: %q %v", before, after, err)
+		}
+	})
+
+	t.Run("User", func(t *testing.T) {
+		if _, err := run(t, "short\n", "user", "create", "admin"); err == nil {
+			t.Error("Expected error for short password")
+		}
+		if _, err := run(t, "password\n", "user", "create", "-role", "admin", "admin"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run(t, "password\n", "user", "create", "bob"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run(t, "", "user", "set-role", "bob", "admin"); err != nil {
+			t.Error(err)
+		}
+		if _, err := run(t, "", "user", "set-role", "bob", "root"); err == nil {
+			t.Error("Expected error for invalid role")
+		}
+		if _, err := run(t, "new password\n", "user", "reset-password", "bob"); err != nil {
+			t.Error(err)
+		}
+		if _, err := run(t, "", "user", "delete", "admin"); err != nil {
+			t.Error(err)
+		}
+
+		list, err := run(t, "", "user", "list")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(list), "\n")
+		if len(lines) != 1 || !strings.Contains(lines[0], "bob") || !strings.Contains(lines[0], string(models.AdminRole)) {
+			t.Errorf("Expected bob as only admin. Got: %q", list)
+		}
+	})
+
+	t.Run("Session", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"session", "purge"},
+			{"session", "purge", "-expired"},
+			{"session", "purge", "-user", "bob"},
+		} {
+			if _, err := run(t, "", args...); err != nil {
+				t.Error(args, err)
+			}
+		}
+		if _, err := run(t, "", "session", "purge", "-user", "nobody"); err == nil {
+			t.Error("Expected error for unknown user")
+		}
+	})
+
+	t.Run("BackupRestore", func(t *testing.T) {
+		backupPath := filepath.Join(t.TempDir(), "backup.db")
+		if _, err := run(t, "", "backup", backupPath); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run(t, "password\n", "user", "create", "carol"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run(t, "", "restore", backupPath); err != nil {
+			t.Fatal(err)
+		}
+		list, err := run(t, "", "user", "list")
+		if err != nil || strings.Contains(list, "carol") {
+			t.Errorf("Expected user created after backup to be gone. Got: %q %v", list, err)
+		}
+		previous, _ := filepath.Glob(dbPath + ".before-restore-*")
+		if len(previous) != 1 {
+			t.Errorf("Expected previous database to be kept. Got: %v", previous)
+		}
+
+		invalidPath := filepath.Join(t.TempDir(), "invalid.db")
+		if err := os.WriteFile(invalidPath, []byte("no database"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run(t, "", "restore", invalidPath); err == nil {
+			t.Error("Expected error for invalid backup")
+		}
+
+		// An empty file is an empty SQLite database without migrations.
+		emptyPath := filepath.Join(t.TempDir(), "empty.db")
+		if err := os.WriteFile(emptyPath, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run(t, "", "restore", emptyPath); err == nil {
+			t.Error("Expected error for backup without schema version")
+		}
+		if info, err := os.Stat(emptyPath); err != nil || info.Size() != 0 {
+			t.Errorf("Expected backup to be unchanged. Got: %v %v", info, err)
+		}
+	})
+
+	t.Run("ExportImport", func(t *testing.T) {
+		exportPath := filepath.Join(t.TempDir(), "export.zip")
+		if _, err := run(t, "", "export", exportPath); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run(t, "", "export", exportPath); err == nil {
+			t.Error("Expected error for existing export file")
+		}
+		if _, err := run(t, "", "import", "-user", "bob", exportPath); err != nil {
+			t.Error(err)
+		}
+		if _, err := run(t, "", "export", "-user", "nobody", exportPath+".jsonl"); err == nil {
+			t.Error("Expected error for unknown user")
+		}
+	})
+
+	if _, err := run(t, "", "user", "delete"); !errors.Is(err, ErrInvalidArguments) {
+		t.Error("Expected 'ErrInvalidArguments'. Got: ", err)
+	}
+}
@@ -0,0 +1,93 @@
+// Package cli implements the cpaw command line interface.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+var ErrUnknownCommand = errors.New("Unknown command")
+
+type Env struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+type Command struct {
+	Name  string
+	Usage string
+	Run   func(ctx context.Context, env Env, args []string) error
+}
+
+func FindCommand(commands []Command, name string) (Command, bool) {
+	index := slices.IndexFunc(commands, func(c Command) bool { return c.Name == name })
+	if index < 0 {
+		return Command{}, false
+	}
+	return commands[index], true
+}
+
+// Run executes the command named by the first argument.
+func Run(ctx context.Context, env Env, commands []Command, args []string) error {
+	return run(ctx, env, "cpaw", commands, args)
+}
+
+// run executes a command of program, which is the command line that leads to
+// the commands, e.g. "cpaw user".
+func run(ctx context.Context, env Env, program string, commands []Command, args []string) error {
+	if len(args) == 0 {
+		printUsage(env.Stderr, program, commands)
+		return ErrUnknownCommand
+	}
+
+	command, ok := FindCommand(commands, args[0])
+	if !ok {
+		printUsage(env.Stderr, program, commands)
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, args[0])
+	}
+
+	err := command.Run(ctx, env, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
+
+func PrintUsage(w io.Writer, commands []Command) {
+	printUsage(w, "cpaw", commands)
+}
+
+func printUsage(w io.Writer, program string, commands []Command) {
+	fmt.Fprintf(w, "Usage: %s <command> [arguments]\n", program)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %-15s %s\n", command.Name, command.Usage)
+	}
+}
+
+func newFlagSet(env Env, name string, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(env.Stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(env.Stderr, "Usage: cpaw %s\n", usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// preview returns the first line of s shortened to max runes.
+func preview(s string, max int) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	runes := []rune(line)
+	if len(runes) > max {
+		return string(runes[:max-1]) + "…"
+	}
+	return line
+}
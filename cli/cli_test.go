@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	var stderr bytes.Buffer
+	env := Env{Stderr: &stderr}
+	called := false
+	commands := []Command{{
+		Name: "foo",
+		Run: func(ctx context.Context, env Env, args []string) error {
+			called = len(args) == 1 && args[0] == "bar"
+			return nil
+		},
+	}}
+
+	if err := Run(context.Background(), env, commands, []string{"foo", "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Error("Expected command to be called with its arguments")
+	}
+
+	err := Run(context.Background(), env, commands, []string{"baz"})
+	if !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("Expected ErrUnknownCommand, got %v", err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpaw", "client.json")
+	t.Setenv(serverEnv, "")
+	t.Setenv(tokenEnv, "")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(config.validate(), ErrNotLoggedIn) {
+		t.Error("Expected empty config to be invalid")
+	}
+
+	want := Config{Server: "http://localhost:3000", Token: "token"}
+	if err := SaveConfig(path, want); err != nil {
+		t.Fatal(err)
+	}
+	config, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config != want {
+		t.Errorf("Expected %+v, got %+v", want, config)
+	}
+
+	t.Setenv(tokenEnv, "env")
+	config, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config != want {
+		t.Errorf("Expected environment not to change the loaded config, got %+v", config)
+	}
+	if token := config.withEnv().Token; token != "env" {
+		t.Errorf("Expected token from environment, got %q", token)
+	}
+}
+
+func TestLogoutKeepsEnvironmentOutOfConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.json")
+	t.Setenv(configPathEnv, path)
+	t.Setenv(serverEnv, "http://env:3000")
+	t.Setenv(tokenEnv, "env")
+
+	if err := os.WriteFile(path, []byte(`{"server":"http://localhost:3000","token":"token"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(context.Background(), Env{Stderr: io.Discard}, ClientCommands(), []string{"logout"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{Server: "http://localhost:3000"}
+	if config != want {
+		t.Errorf("Expected %+v, got %+v", want, config)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("Expected permissions 0600, got %o", perm)
+	}
+}
+
+func TestIsText(t *testing.T) {
+	tests := map[string]bool{
+		"foo\n":        true,
+		"äöü":          true,
+		"foo\x00bar":   false,
+		"\xff\xfe\xfd": false,
+	}
+	for input, want := range tests {
+		if got := isText([]byte(input)); got != want {
+			t.Errorf("isText(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/michaelhass/cpaw/client"
+	"github.com/michaelhass/cpaw/clipsync"
+	"github.com/michaelhass/cpaw/models"
+	"golang.org/x/term"
+)
+
+const (
+	watchRetryDelay    time.Duration = time.Second * 2
+	maxWatchRetryDelay time.Duration = time.Minute
+)
+
+var ErrNoItems = errors.New("No items")
+
+func ClientCommands() []Command {
+	return []Command{
+		{Name: "login", Usage: "Store server URL and credentials", Run: runLogin},
+		{Name: "logout", Usage: "Remove stored credentials", Run: runLogout},
+		{Name: "push", Usage: "Create an item from stdin, text or files", Run: runPush},
+		{Name: "pull", Usage: "Write the latest item to stdout", Run: runPull},
+		{Name: "ls", Usage: "List items", Run: runList},
+		{Name: "rm", Usage: "Delete items", Run: runRemove},
+		{Name: "watch", Usage: "Print item changes as they happen", Run: runWatch},
+	}
+}
+
+func loadClient() (*client.Client, Config, error) {
+	path, err := DefaultConfigPath()
+	if err != nil {
+		return nil, Config{}, err
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		return nil, config, err
+	}
+	config = config.withEnv()
+	if err := config.validate(); err != nil {
+		return nil, config, err
+	}
+	return client.New(config.Server, config.Token, nil), config, nil
+}
+
+func runLogin(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "login", "login --server URL (--token TOKEN | --user NAME)")
+	server := flags.String("server", "", "Server URL, e.g. http://localhost:3000")
+	token := flags.String("token", "", "Personal API token")
+	user := flags.String("user", "", "User name to sign in with. Sessions expire, prefer --token")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := DefaultConfigPath()
+	if err != nil {
+		return err
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	if len(*server) > 0 {
+		config.Server = *server
+	}
+	if len(config.Server) == 0 {
+		flags.Usage()
+		return ErrNotLoggedIn
+	}
+
+	switch {
+	case len(*token) > 0:
+		config.Token = *token
+	case len(*user) > 0:
+		password, err := readPassword(env)
+		if err != nil {
+			return err
+		}
+		config.Token, err = client.New(config.Server, "", nil).SignIn(ctx, *user, password)
+		if err != nil {
+			return err
+		}
+	default:
+		flags.Usage()
+		return ErrNotLoggedIn
+	}
+
+	_, err = client.New(config.Server, config.Token, nil).ListItems(ctx, client.ListItemsParams{Limit: 1})
+	if err != nil {
+		return err
+	}
+	if err := SaveConfig(path, config); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stderr, "Logged in to", config.Server)
+	return nil
+}
+
+func readPassword(env Env) (string, error) {
+	fmt.Fprint(env.Stderr, "Password: ")
+	defer fmt.Fprintln(env.Stderr)
+
+	if file, ok := env.Stdin.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		password, err := term.ReadPassword(int(file.Fd()))
+		return string(password), err
+	}
+	password, err := bufio.NewReader(env.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
+
+func runLogout(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "logout", "logout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := DefaultConfigPath()
+	if err != nil {
+		return err
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	config.Token = ""
+	return SaveConfig(path, config)
+}
+
+func runPush(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "push", "push [-m TEXT] [--name NAME] [--ttl DURATION] [--burn] [FILE...]")
+	message := flags.String("m", "", "Text content of the item")
+	name := flags.String("name", "stdin", "File name used for binary data read from stdin")
+	ttl := flags.Duration("ttl", 0, "Delete the item after this duration, e.g. 10m")
+	burn := flags.Bool("burn", false, "Delete the item once it has been pulled")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	apiClient, _, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	params := client.CreateItemParams{
+		Content:       *message,
+		ExpiresIn:     *ttl,
+		BurnAfterRead: *burn,
+	}
+	for _, path := range flags.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		params.Files = append(params.Files, client.File{
+			Name:     filepath.Base(path),
+			MimeType: mime.TypeByExtension(filepath.Ext(path)),
+			Data:     file,
+		})
+	}
+
+	if len(params.Content) == 0 && len(params.Files) == 0 {
+		data, err := io.ReadAll(env.Stdin)
+		if err != nil {
+			return err
+		}
+		if isText(data) {
+			params.Content = string(data)
+		} else {
+			params.Files = append(params.Files, client.File{
+				Name:     *name,
+				MimeType: http.DetectContentType(data),
+				Data:     bytes.NewReader(data),
+			})
+		}
+	}
+
+	item, err := apiClient.CreateItem(ctx, params)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stdout, item.Id)
+	return nil
+}
+
+// isText reports whether data can be stored as item content instead of an
+// attachment.
+func isText(data []byte) bool {
+	return utf8.Valid(data) && !bytes.ContainsRune(data, 0)
+}
+
+func runPull(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "pull", "pull [--id ID]")
+	itemId := flags.String("id", "", "Item to pull instead of the latest one")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	apiClient, _, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	var item models.Item
+	if len(*itemId) > 0 {
+		item, err = apiClient.GetItem(ctx, *itemId)
+		if err != nil {
+			return err
+		}
+	} else {
+		page, err := apiClient.ListItems(ctx, client.ListItemsParams{Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(page.Items) == 0 {
+			return ErrNoItems
+		}
+		item = page.Items[0]
+		// Listings never contain the content of burn after read items.
+		if item.BurnAfterRead {
+			item, err = apiClient.GetItem(ctx, item.Id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(item.Content) == 0 && len(item.Attachments) > 0 {
+		return apiClient.DownloadAttachment(ctx, item.Attachments[0], env.Stdout)
+	}
+	_, err = io.WriteString(env.Stdout, item.Content)
+	return err
+}
+
+func runList(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "ls", "ls [-n COUNT]")
+	count := flags.Int("n", 20, "Number of items to list")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	apiClient, _, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	page, err := apiClient.ListItems(ctx, client.ListItemsParams{Limit: *count})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+	for _, item := range page.Items {
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\n",
+			item.Id,
+			time.Unix(item.CreatedAt, 0).Format("2006-01-02 15:04"),
+			itemPreview(item),
+		)
+	}
+	return w.Flush()
+}
+
+func itemPreview(item models.Item) string {
+	text := preview(item.Content, 60)
+	if item.BurnAfterRead {
+		text = "[burn after read]"
+	}
+	if len(item.Attachments) > 0 {
+		names := make([]string, len(item.Attachments))
+		for i, attachment := range item.Attachments {
+			names[i] = attachment.FileName
+		}
+		text = strings.TrimSpace(text + " [" + strings.Join(names, ", ") + "]")
+	}
+	return text
+}
+
+func runRemove(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "rm", "rm ID...")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	apiClient, _, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	for _, itemId := range flags.Args() {
+		if err := apiClient.DeleteItem(ctx, itemId); err != nil {
+			return fmt.Errorf("%s: %w", itemId, err)
+		}
+	}
+	return nil
+}
+
+// runWatch prints a tab separated line for every created, updated and deleted
+// item and reconnects, resuming after the last seen item, if the connection
+// drops.
+func runWatch(ctx context.Context, env Env, args []string) error {
+	flags := newFlagSet(env, "watch", "watch")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	_, config, err := loadClient()
+	if err != nil {
+		return err
+	}
+
+	var (
+		lastItemId string
+		retryDelay = watchRetryDelay
+	)
+	for {
+		syncClient, err := clipsync.Dial(ctx, config.Server, clipsync.DialOptions{
+			Token:      config.Token,
+			LastItemId: lastItemId,
+		})
+		if err == nil {
+			retryDelay = watchRetryDelay
+			for msg := range syncClient.Events() {
+				switch msg.Type {
+				case clipsync.ItemCreatedMessage, clipsync.ItemUpdatedMessage:
+					var text string
+					if msg.Item != nil {
+						text = itemPreview(*msg.Item)
+					}
+					action := strings.TrimPrefix(string(msg.Type), "item_")
+					fmt.Fprintf(env.Stdout, "%s\t%s\t%s\n", action, msg.ItemId, text)
+				case clipsync.ItemDeletedMessage:
+					fmt.Fprintf(env.Stdout, "deleted\t%s\n", msg.ItemId)
+				}
+			}
+			lastItemId = syncClient.LastItemId()
+			err = syncClient.Err()
+			syncClient.Close()
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		fmt.Fprintf(env.Stderr, "Connection lost: %v. Retrying in %s\n", err, retryDelay)
+		select {
+		case <-time.After(retryDelay):
+			retryDelay = min(retryDelay*2, maxWatchRetryDelay)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
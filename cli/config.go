@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	configPathEnv string = "CPAW_CLIENT_CONFIG"
+	serverEnv     string = "CPAW_SERVER"
+	tokenEnv      string = "CPAW_TOKEN"
+)
+
+var ErrNotLoggedIn = errors.New("Not logged in. Please run 'cpaw login' first")
+
+type Config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+func DefaultConfigPath() (string, error) {
+	if path := os.Getenv(configPathEnv); len(path) > 0 {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cpaw", "client.json"), nil
+}
+
+// LoadConfig reads the config file at path. A missing file results in an
+// empty config.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return config, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// SaveConfig writes the config readable for the current user only, as it
+// contains credentials.
+func SaveConfig(path string, config Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the permissions of an existing file.
+	return os.Chmod(path, 0o600)
+}
+
+// withEnv returns the config with CPAW_SERVER and CPAW_TOKEN taking
+// precedence. It is only used to create clients, so values from the
+// environment are never saved.
+func (c Config) withEnv() Config {
+	if server := os.Getenv(serverEnv); len(server) > 0 {
+		c.Server = server
+	}
+	if token := os.Getenv(tokenEnv); len(token) > 0 {
+		c.Token = token
+	}
+	return c
+}
+
+func (c Config) validate() error {
+	if len(c.Server) == 0 || len(c.Token) == 0 {
+		return ErrNotLoggedIn
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+// Package client talks to the REST API of a cpaw server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+const (
+	apiPath           string = "/api/v1"
+	sessionCookieName string = "cpaw_session"
+)
+
+var (
+	ErrMissingSession    = errors.New("Server did not return a session")
+	ErrTwoFactorRequired = errors.New("Two-factor authentication is enabled. Please use a personal API token")
+)
+
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if len(e.Message) > 0 {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+type Client struct {
+	serverURL  string
+	token      string
+	httpClient *http.Client
+}
+
+func New(serverURL string, token string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		serverURL:  strings.TrimSuffix(serverURL, "/"),
+		token:      token,
+		httpClient: httpClient,
+	}
+}
+
+// SignIn creates a new remembered session and returns its token, which can be
+// used instead of a personal API token until the session expires.
+func (c *Client) SignIn(ctx context.Context, userName string, password string) (string, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(map[string]any{
+		"userName": userName,
+		"password": password,
+		"remember": true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.do(ctx, http.MethodGet, "/auth/signin/", &body, "application/json")
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == sessionCookieName {
+			return cookie.Value, nil
+		}
+	}
+
+	var challenge struct {
+		TwoFactorRequired bool `json:"twoFactorRequired"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&challenge); err == nil && challenge.TwoFactorRequired {
+		return "", ErrTwoFactorRequired
+	}
+	return "", ErrMissingSession
+}
+
+type ListItemsParams struct {
+	Limit  int
+	Cursor string
+}
+
+func (c *Client) ListItems(ctx context.Context, params ListItemsParams) (models.ItemPage, error) {
+	var page models.ItemPage
+
+	query := url.Values{}
+	if params.Limit > 0 {
+		query.Set("limit", strconv.Itoa(params.Limit))
+	}
+	if len(params.Cursor) > 0 {
+		query.Set("cursor", params.Cursor)
+	}
+
+	res, err := c.do(ctx, http.MethodGet, "/items/?"+query.Encode(), nil, "")
+	if err != nil {
+		return page, err
+	}
+	defer res.Body.Close()
+	err = json.NewDecoder(res.Body).Decode(&page)
+	return page, err
+}
+
+func (c *Client) GetItem(ctx context.Context, itemId string) (models.Item, error) {
+	var item models.Item
+	res, err := c.do(ctx, http.MethodGet, "/items/"+url.PathEscape(itemId)+"/", nil, "")
+	if err != nil {
+		return item, err
+	}
+	defer res.Body.Close()
+	err = json.NewDecoder(res.Body).Decode(&item)
+	return item, err
+}
+
+type File struct {
+	Name     string
+	MimeType string
+	Data     io.Reader
+}
+
+type CreateItemParams struct {
+	Content string
+	Files   []File
+	// ExpiresIn is optional and rounded to seconds.
+	ExpiresIn     time.Duration
+	BurnAfterRead bool
+}
+
+// CreateItem sends a JSON request for plain text and a multipart request if
+// there are files to upload.
+func (c *Client) CreateItem(ctx context.Context, params CreateItemParams) (models.Item, error) {
+	var (
+		item        models.Item
+		body        bytes.Buffer
+		contentType string
+	)
+
+	expiresIn := int64(params.ExpiresIn / time.Second)
+	if len(params.Files) == 0 {
+		contentType = "application/json"
+		err := json.NewEncoder(&body).Encode(map[string]any{
+			"content":       params.Content,
+			"expiresIn":     expiresIn,
+			"burnAfterRead": params.BurnAfterRead,
+		})
+		if err != nil {
+			return item, err
+		}
+	} else {
+		writer := multipart.NewWriter(&body)
+		fields := map[string]string{
+			"content":         params.Content,
+			"expires_in":      strconv.FormatInt(expiresIn, 10),
+			"burn_after_read": strconv.FormatBool(params.BurnAfterRead),
+		}
+		for name, value := range fields {
+			if err := writer.WriteField(name, value); err != nil {
+				return item, err
+			}
+		}
+		for _, file := range params.Files {
+			if err := writeMultipartFile(writer, file); err != nil {
+				return item, err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return item, err
+		}
+		contentType = writer.FormDataContentType()
+	}
+
+	res, err := c.do(ctx, http.MethodPost, "/items/", &body, contentType)
+	if err != nil {
+		return item, err
+	}
+	defer res.Body.Close()
+	err = json.NewDecoder(res.Body).Decode(&item)
+	return item, err
+}
+
+func writeMultipartFile(writer *multipart.Writer, file File) error {
+	header := textproto.MIMEHeader{}
+	header.Set(
+		"Content-Disposition",
+		fmt.Sprintf(`form-data; name="files"; filename=%q`, file.Name),
+	)
+	mimeType := file.MimeType
+	if len(mimeType) == 0 {
+		mimeType = "application/octet-stream"
+	}
+	header.Set("Content-Type", mimeType)
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file.Data)
+	return err
+}
+
+func (c *Client) DeleteItem(ctx context.Context, itemId string) error {
+	res, err := c.do(ctx, http.MethodDelete, "/items/"+url.PathEscape(itemId)+"/", nil, "")
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (c *Client) DownloadAttachment(ctx context.Context, attachment models.Attachment, w io.Writer) error {
+	path := fmt.Sprintf(
+		"/items/%s/attachments/%s/",
+		url.PathEscape(attachment.ItemId),
+		url.PathEscape(attachment.Id),
+	)
+	res, err := c.do(ctx, http.MethodGet, path, nil, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+func (c *Client) do(
+	ctx context.Context,
+	method string,
+	path string,
+	body io.Reader,
+	contentType string,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.serverURL+apiPath+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if len(c.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		defer res.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return res, nil
+}
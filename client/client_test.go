@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+const testToken string = "cpaw_pat_test"
+
+func newTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/items/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("limit") != "1" {
+			t.Errorf("Expected limit 1, got %q", r.URL.Query().Get("limit"))
+		}
+		json.NewEncoder(w).Encode(models.ItemPage{Items: []models.Item{{Id: "1", Content: "foo"}}})
+	})
+	mux.HandleFunc("POST /api/v1/items/", func(w http.ResponseWriter, r *http.Request) {
+		item := models.Item{Id: "2"}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			item.Content = r.FormValue("content")
+			file, header, err := r.FormFile("files")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			data, _ := io.ReadAll(file)
+			item.Attachments = []models.Attachment{{
+				Id:       "3",
+				ItemId:   item.Id,
+				FileName: header.Filename,
+				MimeType: header.Header.Get("Content-Type"),
+				Size:     int64(len(data)),
+			}}
+		} else {
+			json.NewDecoder(r.Body).Decode(&item)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(item)
+	})
+	mux.HandleFunc("GET /api/v1/items/{itemId}/attachments/{attachmentId}/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte{0, 1, 2})
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		_, err := New(server.URL, "invalid", nil).ListItems(ctx, ListItemsParams{Limit: 1})
+		var clientErr *Error
+		if !errors.As(err, &clientErr) || clientErr.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected unauthorized error, got %v", err)
+		}
+	})
+
+	client := New(server.URL+"/", testToken, nil)
+
+	t.Run("ListItems", func(t *testing.T) {
+		page, err := client.ListItems(ctx, ListItemsParams{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Items) != 1 || page.Items[0].Content != "foo" {
+			t.Errorf("Unexpected page %+v", page)
+		}
+	})
+
+	t.Run("CreateTextItem", func(t *testing.T) {
+		item, err := client.CreateItem(ctx, CreateItemParams{Content: "bar"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Content != "bar" {
+			t.Errorf("Expected content bar, got %q", item.Content)
+		}
+	})
+
+	t.Run("CreateAttachmentItem", func(t *testing.T) {
+		item, err := client.CreateItem(ctx, CreateItemParams{
+			Content: "baz",
+			Files:   []File{{Name: "data.bin", Data: bytes.NewReader([]byte{0, 1, 2})}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Content != "baz" || len(item.Attachments) != 1 {
+			t.Fatalf("Unexpected item %+v", item)
+		}
+		attachment := item.Attachments[0]
+		if attachment.FileName != "data.bin" || attachment.MimeType != "application/octet-stream" {
+			t.Errorf("Unexpected attachment %+v", attachment)
+		}
+
+		var data bytes.Buffer
+		if err := client.DownloadAttachment(ctx, attachment, &data); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data.Bytes(), []byte{0, 1, 2}) {
+			t.Errorf("Unexpected attachment data %v", data.Bytes())
+		}
+	})
+}
@@ -0,0 +1,246 @@
+package clipsync
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/michaelhass/cpaw/models"
+)
+
+const (
+	Path string = "/api/v1/sync/"
+
+	MaxMessageSize int64 = 16 << 20
+)
+
+var (
+	ErrClosed             = errors.New("Sync connection closed")
+	ErrUnexpectedResponse = errors.New("Unexpected response from server")
+)
+
+type DialOptions struct {
+	// Token is sent as bearer token during the handshake.
+	Token string
+	// LastItemId resumes the stream after the given item.
+	LastItemId string
+	HTTPClient *http.Client
+	HTTPHeader http.Header
+}
+
+// Client is a reference implementation of the sync protocol. It answers
+// heartbeats, keeps track of the last item it has seen and correlates
+// requests with their acknowledgements.
+type Client struct {
+	conn    *websocket.Conn
+	resumed bool
+	events  chan Message
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+
+	writeMu sync.Mutex
+
+	mu         sync.Mutex
+	pending    map[string]chan Message
+	lastItemId string
+
+	requestCount atomic.Uint64
+}
+
+// Dial connects to the sync endpoint of the server at serverURL, for example
+// "http://localhost:3000", and completes the hello/welcome exchange.
+func Dial(ctx context.Context, serverURL string, opts DialOptions) (*Client, error) {
+	header := http.Header{}
+	for key, values := range opts.HTTPHeader {
+		header[key] = values
+	}
+	if len(opts.Token) > 0 {
+		header.Set("Authorization", "Bearer "+opts.Token)
+	}
+
+	conn, _, err := websocket.Dial(ctx, strings.TrimSuffix(serverURL, "/")+Path, &websocket.DialOptions{
+		HTTPClient:   opts.HTTPClient,
+		HTTPHeader:   header,
+		Subprotocols: []string{Subprotocol},
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadLimit(MaxMessageSize)
+
+	hello := Message{Type: HelloMessage, Version: ProtocolVersion, LastItemId: opts.LastItemId}
+	if err := wsjson.Write(ctx, conn, hello); err != nil {
+		conn.Close(websocket.StatusProtocolError, "")
+		return nil, err
+	}
+
+	var welcome Message
+	if err := wsjson.Read(ctx, conn, &welcome); err != nil {
+		conn.Close(websocket.StatusProtocolError, "")
+		return nil, err
+	}
+	if welcome.Type == ErrorMessage {
+		conn.Close(websocket.StatusNormalClosure, "")
+		return nil, errors.New(welcome.Error)
+	}
+	if welcome.Type != WelcomeMessage {
+		conn.Close(websocket.StatusProtocolError, "")
+		return nil, ErrUnexpectedResponse
+	}
+
+	clientCtx, cancel := context.WithCancel(context.Background())
+	client := &Client{
+		conn:       conn,
+		resumed:    welcome.Resumed,
+		events:     make(chan Message, 64),
+		ctx:        clientCtx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		pending:    map[string]chan Message{},
+		lastItemId: opts.LastItemId,
+	}
+	go client.readLoop()
+	return client, nil
+}
+
+// Resumed reports whether the server replays the items missed since
+// DialOptions.LastItemId. If not, the client should reload all items.
+func (c *Client) Resumed() bool {
+	return c.resumed
+}
+
+// Events delivers item_created and item_deleted messages. The channel is
+// closed when the connection ends; Err returns the reason.
+func (c *Client) Events() <-chan Message {
+	return c.events
+}
+
+func (c *Client) LastItemId() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastItemId
+}
+
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+func (c *Client) CreateItem(ctx context.Context, content string) (models.Item, error) {
+	reply, err := c.request(ctx, Message{Type: CreateItemMessage, Content: content})
+	if err != nil {
+		return models.Item{}, err
+	}
+	if reply.Item == nil {
+		return models.Item{}, ErrUnexpectedResponse
+	}
+	return *reply.Item, nil
+}
+
+func (c *Client) DeleteItem(ctx context.Context, itemId string) error {
+	_, err := c.request(ctx, Message{Type: DeleteItemMessage, ItemId: itemId})
+	return err
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	return c.write(ctx, Message{Type: PingMessage})
+}
+
+func (c *Client) Close() error {
+	err := c.conn.Close(websocket.StatusNormalClosure, "")
+	c.cancel()
+	<-c.done
+	return err
+}
+
+func (c *Client) request(ctx context.Context, msg Message) (Message, error) {
+	msg.RequestId = strconv.FormatUint(c.requestCount.Add(1), 10)
+	reply := make(chan Message, 1)
+
+	c.mu.Lock()
+	c.pending[msg.RequestId] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, msg.RequestId)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(ctx, msg); err != nil {
+		return Message{}, err
+	}
+
+	select {
+	case response := <-reply:
+		if response.Type == ErrorMessage {
+			return response, errors.New(response.Error)
+		}
+		return response, nil
+	case <-c.done:
+		return Message{}, ErrClosed
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+func (c *Client) write(ctx context.Context, msg Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return wsjson.Write(ctx, c.conn, msg)
+}
+
+func (c *Client) readLoop() {
+	defer close(c.done)
+	defer close(c.events)
+
+	for {
+		var msg Message
+		if err := wsjson.Read(c.ctx, c.conn, &msg); err != nil {
+			if c.ctx.Err() != nil {
+				err = ErrClosed
+			}
+			c.err = err
+			return
+		}
+
+		switch msg.Type {
+		case PingMessage:
+			if err := c.write(c.ctx, Message{Type: PongMessage}); err != nil {
+				c.err = err
+				return
+			}
+		case AckMessage, ErrorMessage:
+			c.mu.Lock()
+			reply, ok := c.pending[msg.RequestId]
+			c.mu.Unlock()
+			if ok {
+				reply <- msg
+			}
+		case ItemCreatedMessage, ItemUpdatedMessage, ItemDeletedMessage:
+			if msg.Type == ItemCreatedMessage {
+				c.mu.Lock()
+				c.lastItemId = msg.ItemId
+				c.mu.Unlock()
+			}
+			select {
+			case c.events <- msg:
+			case <-c.ctx.Done():
+				c.err = ErrClosed
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package clipsync defines the WebSocket protocol native clients use to keep
+// their clipboard in sync with a cpaw server, and a reference client.
+//
+// A connection is authenticated during the handshake, either with the
+// session cookie or with an "Authorization: Bearer <token>" header, and must
+// negotiate the Subprotocol. Every frame is a JSON encoded Message.
+//
+// The client starts by sending a hello message with the protocol version it
+// speaks and, optionally, the id of the last item it has seen. The server
+// answers with welcome. If the server was able to resume, it then replays
+// every item created at or after the last seen item as item_created messages
+// before streaming live item_created, item_updated and item_deleted events.
+// Updates and deletions that happened while a client was offline are not
+// replayed, so a client that gets a welcome with resumed set to false should
+// reload its items through the REST API. Clients must treat item_created
+// idempotently. Only personal items are synced, items of shared workspaces
+// are not.
+//
+// Clients create and delete items with create_item and delete_item. Both
+// carry a client chosen request id which the server echoes in an ack, or in
+// an error if the request failed.
+//
+// Either side may send ping at any time and the other side answers with pong.
+// The server pings every HeartbeatInterval and closes connections from which
+// it has not received any message for HeartbeatTimeout.
+package clipsync
+
+import (
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+const (
+	ProtocolVersion int    = 1
+	Subprotocol     string = "cpaw.sync.v1"
+
+	HeartbeatInterval time.Duration = time.Second * 30
+	HeartbeatTimeout  time.Duration = HeartbeatInterval * 3
+)
+
+type MessageType string
+
+const (
+	HelloMessage       MessageType = "hello"
+	WelcomeMessage     MessageType = "welcome"
+	ItemCreatedMessage MessageType = "item_created"
+	ItemDeletedMessage MessageType = "item_deleted"
+	ItemUpdatedMessage MessageType = "item_updated"
+	CreateItemMessage  MessageType = "create_item"
+	DeleteItemMessage  MessageType = "delete_item"
+	AckMessage         MessageType = "ack"
+	ErrorMessage       MessageType = "error"
+	PingMessage        MessageType = "ping"
+	PongMessage        MessageType = "pong"
+)
+
+type Message struct {
+	Type       MessageType  `json:"type"`
+	Version    int          `json:"version,omitempty"`
+	RequestId  string       `json:"requestId,omitempty"`
+	LastItemId string       `json:"lastItemId,omitempty"`
+	Resumed    bool         `json:"resumed,omitempty"`
+	ItemId     string       `json:"itemId,omitempty"`
+	Item       *models.Item `json:"item,omitempty"`
+	Content    string       `json:"content,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+func NewItemEventMessage(event models.ItemEvent) (Message, bool) {
+	if len(event.WorkspaceId) > 0 {
+		return Message{}, false
+	}
+	switch event.Type {
+	case models.ItemCreatedEvent:
+		return Message{Type: ItemCreatedMessage, ItemId: event.ItemId, Item: event.Item}, true
+	case models.ItemDeletedEvent:
+		return Message{Type: ItemDeletedMessage, ItemId: event.ItemId}, true
+	case models.ItemUpdatedEvent:
+		return Message{Type: ItemUpdatedMessage, ItemId: event.ItemId, Item: event.Item}, true
+	default:
+		return Message{}, false
+	}
+}
@@ -0,0 +1,375 @@
+// Package config loads the settings of the cpaw server.
+//
+// Settings are read with increasing precedence from the defaults, a TOML
+// config file, CPAW_* environment variables and command line flags. The config
+// file is passed with -config or CPAW_CONFIG.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/michaelhass/cpaw/db"
+	"github.com/michaelhass/cpaw/models"
+	"github.com/michaelhass/cpaw/service"
+)
+
+const configPathEnv string = "CPAW_CONFIG"
+
+var ErrInvalidConfig = errors.New("Invalid config")
+
+type Config struct {
+	// Addr is the address the HTTP server listens on.
+	Addr string `toml:"addr"`
+	// DbBackend is either "sqlite" or "postgres".
+	DbBackend string `toml:"db_backend"`
+	// DbPath is the path of the SQLite database file.
+	DbPath string `toml:"db_path"`
+	// PostgresDsn is the connection string of the Postgres database. It usually
+	// contains a password, so it has no flag.
+	PostgresDsn string `toml:"postgres_dsn"`
+	// StaticDir is the directory with the stylesheets and scripts.
+	StaticDir string `toml:"static_dir"`
+	// SecureCookies restricts cookies to HTTPS. Enable it if browsers reach the
+	// server over TLS, which usually ends at a reverse proxy in front of it.
+	SecureCookies bool        `toml:"secure_cookies"`
+	InitialUser   InitialUser `toml:"initial_user"`
+	Auth          Auth        `toml:"auth"`
+	Oidc          Oidc        `toml:"oidc"`
+	Backup        Backup      `toml:"backup"`
+}
+
+// InitialUser is the admin created on the first start. If the name is empty,
+// the server asks for it on the terminal.
+type InitialUser struct {
+	Name     string `toml:"name"`
+	Password string `toml:"password"`
+}
+
+type Auth struct {
+	SessionDuration              time.Duration `toml:"session_duration"`
+	MaxSessionLifetime           time.Duration `toml:"max_session_lifetime"`
+	RememberedSessionDuration    time.Duration `toml:"remembered_session_duration"`
+	MaxRememberedSessionLifetime time.Duration `toml:"max_remembered_session_lifetime"`
+	MinPasswordLength            int           `toml:"min_password_length"`
+	CleanUpInterval              time.Duration `toml:"cleanup_interval"`
+}
+
+// Backup configures scheduled backups. They are disabled unless Dir is set.
+type Backup struct {
+	Dir      string        `toml:"dir"`
+	Interval time.Duration `toml:"interval"`
+	// Retention is the number of backups to keep.
+	Retention int `toml:"retention"`
+}
+
+// Oidc configures single sign-on. It is disabled unless Issuer is set.
+type Oidc struct {
+	Issuer       string `toml:"issuer"`
+	ClientId     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	RedirectURL  string `toml:"redirect_url"`
+	RoleClaim    string `toml:"role_claim"`
+	// RoleMapping maps claim values to roles, e.g. "cpaw-admins=admin".
+	RoleMapping string `toml:"role_mapping"`
+	DefaultRole string `toml:"default_role"`
+}
+
+func Default() Config {
+	authConfig := service.DefaultAuthConfig()
+	return Config{
+		Addr:      ":3000",
+		DbBackend: string(db.SqliteBackend),
+		DbPath:    "cpaw.db",
+		StaticDir: "static",
+		Auth: Auth{
+			SessionDuration:              authConfig.SessionDuration,
+			MaxSessionLifetime:           authConfig.MaxSessionLifetime,
+			RememberedSessionDuration:    authConfig.RememberedSessionDuration,
+			MaxRememberedSessionLifetime: authConfig.MaxRememberedSessionLifetime,
+			MinPasswordLength:            authConfig.MinPasswordLength,
+			CleanUpInterval:              authConfig.CleanUpInterval,
+		},
+		Backup: Backup{
+			Interval:  service.DefaultBackupInterval,
+			Retention: service.DefaultBackupRetention,
+		},
+	}
+}
+
+// setting is a value that can be set by environment variable and flag.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	value func(*Config) any
+}
+
+var settings = []setting{
+	{"CPAW_ADDR", "addr", "address to listen on", func(c *Config) any { return &c.Addr }},
+	{"CPAW_DB_BACKEND", "db-backend", "database backend: sqlite or postgres", func(c *Config) any { return &c.DbBackend }},
+	{"CPAW_DB_PATH", "db", "path of the SQLite database", func(c *Config) any { return &c.DbPath }},
+	{"CPAW_POSTGRES_DSN", "", "", func(c *Config) any { return &c.PostgresDsn }},
+	{"CPAW_STATIC_DIR", "static", "directory of static files", func(c *Config) any { return &c.StaticDir }},
+	{"CPAW_SECURE_COOKIES", "secure-cookies", "only send cookies over HTTPS",
+		func(c *Config) any { return &c.SecureCookies }},
+	{"CPAW_INITIAL_USER_NAME", "initial-user", "name of the admin created on first start",
+		func(c *Config) any { return &c.InitialUser.Name }},
+	{"CPAW_INITIAL_USER_PASSWORD", "", "", func(c *Config) any { return &c.InitialUser.Password }},
+	{"CPAW_SESSION_DURATION", "session-duration", "time a session stays valid without being used",
+		func(c *Config) any { return &c.Auth.SessionDuration }},
+	{"CPAW_MAX_SESSION_LIFETIME", "max-session-lifetime", "time after which a session expires regardless of use",
+		func(c *Config) any { return &c.Auth.MaxSessionLifetime }},
+	{"CPAW_REMEMBERED_SESSION_DURATION", "remembered-session-duration", "session duration of remembered devices",
+		func(c *Config) any { return &c.Auth.RememberedSessionDuration }},
+	{"CPAW_MAX_REMEMBERED_SESSION_LIFETIME", "max-remembered-session-lifetime",
+		"max session lifetime of remembered devices", func(c *Config) any { return &c.Auth.MaxRememberedSessionLifetime }},
+	{"CPAW_MIN_PASSWORD_LENGTH", "min-password-length", "minimum length of passwords",
+		func(c *Config) any { return &c.Auth.MinPasswordLength }},
+	{"CPAW_CLEANUP_INTERVAL", "cleanup-interval", "interval of deleting expired sessions and items",
+		func(c *Config) any { return &c.Auth.CleanUpInterval }},
+	{"CPAW_BACKUP_DIR", "backup-dir", "directory of scheduled backups, which are disabled if empty",
+		func(c *Config) any { return &c.Backup.Dir }},
+	{"CPAW_BACKUP_INTERVAL", "backup-interval", "interval of scheduled backups",
+		func(c *Config) any { return &c.Backup.Interval }},
+	{"CPAW_BACKUP_RETENTION", "backup-retention", "number of scheduled backups to keep",
+		func(c *Config) any { return &c.Backup.Retention }},
+	{"CPAW_OIDC_ISSUER", "oidc-issuer", "issuer URL of the single sign-on provider",
+		func(c *Config) any { return &c.Oidc.Issuer }},
+	{"CPAW_OIDC_CLIENT_ID", "oidc-client-id", "client id at the single sign-on provider",
+		func(c *Config) any { return &c.Oidc.ClientId }},
+	{"CPAW_OIDC_CLIENT_SECRET", "", "", func(c *Config) any { return &c.Oidc.ClientSecret }},
+	{"CPAW_OIDC_REDIRECT_URL", "oidc-redirect-url", "callback URL registered at the single sign-on provider",
+		func(c *Config) any { return &c.Oidc.RedirectURL }},
+	{"CPAW_OIDC_ROLE_CLAIM", "oidc-role-claim", "claim with the roles of a user",
+		func(c *Config) any { return &c.Oidc.RoleClaim }},
+	{"CPAW_OIDC_ROLE_MAPPING", "oidc-role-mapping", "comma separated claim=role pairs",
+		func(c *Config) any { return &c.Oidc.RoleMapping }},
+	{"CPAW_OIDC_DEFAULT_ROLE", "oidc-default-role", "role of users without a mapped claim",
+		func(c *Config) any { return &c.Oidc.DefaultRole }},
+}
+
+// Load reads the config from the config file, the environment and the flags
+// in args. Secrets, like passwords, can't be passed as flag, because other
+// users could read them from the process list.
+func Load(args []string, getenv func(string) string, output io.Writer) (Config, error) {
+	config := Default()
+
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(output)
+	configPath := flags.String("config", getenv(configPathEnv), "path of the TOML config file. Env: "+configPathEnv)
+	var flagValues []func() error
+	defaults := Default()
+	for _, s := range settings {
+		if len(s.flag) == 0 {
+			continue
+		}
+		usage := s.usage + ". Env: " + s.env
+		if defaultValue := formatValue(s.value(&defaults)); len(defaultValue) > 0 && defaultValue != "0" {
+			usage += " (default " + defaultValue + ")"
+		}
+		setFlag := func(value string) error {
+			var scratch Config
+			if err := setValue(s.value(&scratch), value); err != nil {
+				return err
+			}
+			// Flags are applied after the file and the environment were read.
+			flagValues = append(flagValues, func() error { return setValue(s.value(&config), value) })
+			return nil
+		}
+		if _, ok := s.value(&defaults).(*bool); ok {
+			flags.BoolFunc(s.flag, usage, setFlag)
+		} else {
+			flags.Func(s.flag, usage, setFlag)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+
+	if len(*configPath) > 0 {
+		if err := loadFile(*configPath, &config); err != nil {
+			return config, err
+		}
+	}
+	for _, s := range settings {
+		value := getenv(s.env)
+		if len(value) == 0 {
+			continue
+		}
+		if err := setValue(s.value(&config), value); err != nil {
+			return config, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, s.env, err)
+		}
+	}
+	for _, apply := range flagValues {
+		if err := apply(); err != nil {
+			return config, err
+		}
+	}
+	return config, config.Validate()
+}
+
+func loadFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	metadata, err := toml.Decode(string(data), config)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidConfig, path, err)
+	}
+	if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("%w: %s: unknown key %s", ErrInvalidConfig, path, undecoded[0])
+	}
+	return nil
+}
+
+func setValue(target any, value string) error {
+	switch target := target.(type) {
+	case *string:
+		*target = value
+	case *bool:
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target = enabled
+	case *int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target = number
+	case *time.Duration:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*target = duration
+	default:
+		return fmt.Errorf("unsupported setting type %T", target)
+	}
+	return nil
+}
+
+func formatValue(value any) string {
+	switch value := value.(type) {
+	case *string:
+		return *value
+	case *bool:
+		if *value {
+			return "true"
+		}
+	case *int:
+		return strconv.Itoa(*value)
+	case *time.Duration:
+		return value.String()
+	}
+	return ""
+}
+
+func (c Config) Validate() error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: "+format, append([]any{ErrInvalidConfig}, args...)...)
+	}
+
+	if len(c.Addr) == 0 {
+		return invalid("addr is missing")
+	}
+	switch db.Backend(c.DbBackend) {
+	case db.SqliteBackend:
+		if len(c.DbPath) == 0 {
+			return invalid("db_path is missing")
+		}
+	case db.PostgresBackend:
+		if len(c.PostgresDsn) == 0 {
+			return invalid("postgres_dsn is missing")
+		}
+	default:
+		return invalid("db_backend must be sqlite or postgres")
+	}
+	if len(c.InitialUser.Name) > 0 && !service.IsValidUserName(c.InitialUser.Name) {
+		return invalid("%s", service.ErrUserNameInvalidChars)
+	}
+
+	auth := c.Auth
+	for name, duration := range map[string]time.Duration{
+		"session_duration":                auth.SessionDuration,
+		"max_session_lifetime":            auth.MaxSessionLifetime,
+		"remembered_session_duration":     auth.RememberedSessionDuration,
+		"max_remembered_session_lifetime": auth.MaxRememberedSessionLifetime,
+		"cleanup_interval":                auth.CleanUpInterval,
+	} {
+		if duration <= 0 {
+			return invalid("%s must be positive", name)
+		}
+	}
+	if auth.MaxSessionLifetime < auth.SessionDuration {
+		return invalid("max_session_lifetime must not be shorter than session_duration")
+	}
+	if auth.MaxRememberedSessionLifetime < auth.RememberedSessionDuration {
+		return invalid("max_remembered_session_lifetime must not be shorter than remembered_session_duration")
+	}
+	if auth.MinPasswordLength < 1 {
+		return invalid("min_password_length must be positive")
+	}
+
+	if c.Backup.Interval <= 0 {
+		return invalid("backup interval must be positive")
+	}
+	if c.Backup.Retention < 1 {
+		return invalid("backup retention must be positive")
+	}
+
+	if _, err := service.ParseOidcRoleMapping(c.Oidc.RoleMapping); err != nil {
+		return invalid("oidc role_mapping: %s", err)
+	}
+	if len(c.Oidc.DefaultRole) > 0 && !models.Role(c.Oidc.DefaultRole).IsValid() {
+		return invalid("oidc default_role: %s", service.ErrInvalidRole)
+	}
+	return nil
+}
+
+// OpenDatabase opens the database of the configured backend.
+func (c Config) OpenDatabase() (db.Database, error) {
+	return db.Open(db.Backend(c.DbBackend), c.DbPath, c.PostgresDsn)
+}
+
+func (c Config) AuthConfig() service.AuthConfig {
+	return service.AuthConfig{
+		SessionDuration:              c.Auth.SessionDuration,
+		MaxSessionLifetime:           c.Auth.MaxSessionLifetime,
+		RememberedSessionDuration:    c.Auth.RememberedSessionDuration,
+		MaxRememberedSessionLifetime: c.Auth.MaxRememberedSessionLifetime,
+		MinPasswordLength:            c.Auth.MinPasswordLength,
+		CleanUpInterval:              c.Auth.CleanUpInterval,
+	}
+}
+
+func (c Config) BackupConfig() service.BackupConfig {
+	return service.BackupConfig{
+		Dir:       c.Backup.Dir,
+		Interval:  c.Backup.Interval,
+		Retention: c.Backup.Retention,
+	}
+}
+
+func (c Config) OidcConfig() service.OidcConfig {
+	// Validate has already checked the mapping.
+	roleMapping, _ := service.ParseOidcRoleMapping(c.Oidc.RoleMapping)
+	return service.OidcConfig{
+		Issuer:       c.Oidc.Issuer,
+		ClientId:     c.Oidc.ClientId,
+		ClientSecret: c.Oidc.ClientSecret,
+		RedirectURL:  c.Oidc.RedirectURL,
+		RoleClaim:    c.Oidc.RoleClaim,
+		RoleMapping:  roleMapping,
+		DefaultRole:  models.Role(c.Oidc.DefaultRole),
+	}
+}
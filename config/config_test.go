@@ -0,0 +1,89 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpaw.toml")
+	err := os.WriteFile(path, []byte(`
+addr = ":4000"
+db_path = "file.db"
+static_dir = "/srv/static"
+
+[auth]
+session_duration = "30m"
+min_password_length = 10
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"CPAW_CONFIG":              path,
+		"CPAW_DB_PATH":             "env.db",
+		"CPAW_ADDR":                ":5000",
+		"CPAW_MIN_PASSWORD_LENGTH": "12",
+	}
+	config, err := Load([]string{"-addr", ":6000", "-secure-cookies"}, func(key string) string { return env[key] }, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"FlagOverEnv", config.Addr, ":6000"},
+		{"EnvOverFile", config.DbPath, "env.db"},
+		{"File", config.StaticDir, "/srv/static"},
+		{"FileDuration", config.Auth.SessionDuration, time.Minute * 30},
+		{"EnvInt", config.Auth.MinPasswordLength, 12},
+		{"FlagBool", config.SecureCookies, true},
+		{"Default", config.Auth.CleanUpInterval, Default().Auth.CleanUpInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("Expected %v. Got: %v", tt.want, tt.got)
+			}
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpaw.toml")
+	if err := os.WriteFile(path, []byte(`unknown = true`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{"UnknownKey", []string{"-config", path}, nil},
+		{"Duration", nil, map[string]string{"CPAW_SESSION_DURATION": "forever"}},
+		{"Bool", nil, map[string]string{"CPAW_SECURE_COOKIES": "maybe"}},
+		{"Lifetime", []string{"-session-duration", "24h"}, nil},
+		{"PasswordLength", []string{"-min-password-length", "0"}, nil},
+		{"RoleMapping", nil, map[string]string{"CPAW_OIDC_ROLE_MAPPING": "admins"}},
+		{"InitialUser", []string{"-initial-user", "a b"}, nil},
+		{"DbBackend", []string{"-db-backend", "mysql"}, nil},
+		{"PostgresDsn", []string{"-db-backend", "postgres"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.args, func(key string) string { return tt.env[key] }, io.Discard)
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Error("Expected 'ErrInvalidConfig'. Got: ", err)
+			}
+		})
+	}
+}
@@ -27,3 +27,46 @@ func GetUser(c context.Context) (models.User, bool) {
 	user, ok := c.Value(keyUserCtx).(models.User)
 	return user, ok
 }
+
+const keySessionCtx = "keySessionCtx"
+
+func WithSession(parent context.Context, session models.Session) context.Context {
+	return context.WithValue(parent, keySessionCtx, session)
+}
+
+func GetSession(c context.Context) (models.Session, bool) {
+	session, ok := c.Value(keySessionCtx).(models.Session)
+	return session, ok
+}
+
+const keyCsrfTokenCtx = "keyCsrfTokenCtx"
+
+func WithCsrfToken(parent context.Context, token string) context.Context {
+	return context.WithValue(parent, keyCsrfTokenCtx, token)
+}
+
+func GetCsrfToken(c context.Context) (string, bool) {
+	token, ok := c.Value(keyCsrfTokenCtx).(string)
+	return token, ok
+}
+
+const keyApiTokenCtx = "keyApiTokenCtx"
+
+func WithApiToken(parent context.Context, token models.ApiToken) context.Context {
+	return context.WithValue(parent, keyApiTokenCtx, token)
+}
+
+func GetApiToken(c context.Context) (models.ApiToken, bool) {
+	token, ok := c.Value(keyApiTokenCtx).(models.ApiToken)
+	return token, ok
+}
+
+// HasScope reports whether the request may access the given scope. Requests
+// authenticated with a session are not restricted by scopes.
+func HasScope(c context.Context, scope models.Scope) bool {
+	token, ok := GetApiToken(c)
+	if !ok {
+		return true
+	}
+	return token.HasScope(scope)
+}
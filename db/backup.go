@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+var (
+	ErrDirtySchema          = errors.New("Database schema is dirty")
+	ErrUnknownSchemaVersion = errors.New("Unknown database schema version")
+	ErrCorruptDatabase      = errors.New("Database is corrupt")
+)
+
+// Backup writes a consistent copy of the database to path while it stays
+// usable for other connections. The file at path must not exist yet.
+func (s *Sqlite) Backup(ctx context.Context, path string) error {
+	_, err := s.DB.ExecContext(ctx, "VACUUM INTO $1;", path)
+	return err
+}
+
+// CheckVersion returns the schema version of the database. It fails unless
+// the version is one of the migrations of this build and was applied
+// completely.
+func (s *Sqlite) CheckVersion() (uint, error) {
+	version, dirty, err := s.Version()
+	if err != nil {
+		return version, err
+	}
+	return version, checkVersion(version, dirty)
+}
+
+func checkVersion(version uint, dirty bool) error {
+	if dirty {
+		return fmt.Errorf("%w: %d", ErrDirtySchema, version)
+	}
+
+	sourceDriver, err := iofs.New(migrationFS, "migrations")
+	if err != nil {
+		return err
+	}
+	defer sourceDriver.Close()
+	body, _, err := sourceDriver.ReadUp(version)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %d", ErrUnknownSchemaVersion, version)
+	} else if err != nil {
+		return err
+	}
+	body.Close()
+	return nil
+}
+
+// CheckIntegrity runs SQLite's integrity check.
+func (s *Sqlite) CheckIntegrity(ctx context.Context) error {
+	return checkIntegrity(ctx, s.DB)
+}
+
+func checkIntegrity(ctx context.Context, db *sql.DB) error {
+	var result string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check;").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: %s", ErrCorruptDatabase, result)
+	}
+	return nil
+}
+
+const backupVersionQuery = `
+	SELECT version, dirty FROM schema_migrations LIMIT 1;
+`
+
+// checkBackup runs the checks of CheckVersion and CheckIntegrity on the
+// database at path. It opens the database read-only and reads the migration
+// table directly, as the migration driver would create it in the backup.
+func checkBackup(ctx context.Context, path string) error {
+	backup, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer backup.Close()
+
+	var (
+		version uint
+		dirty   bool
+	)
+	err = backup.QueryRowContext(ctx, backupVersionQuery).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: no version", ErrUnknownSchemaVersion)
+	} else if err != nil {
+		return err
+	}
+	if err := checkVersion(version, dirty); err != nil {
+		return err
+	}
+	return checkIntegrity(ctx, backup)
+}
+
+// Restore replaces the database at dbPath with the backup at backupPath. The
+// backup has to pass CheckVersion and CheckIntegrity and is not modified. The
+// replaced database is kept next to it and its path returned. The server must
+// not run during a restore.
+func Restore(ctx context.Context, backupPath string, dbPath string) (string, error) {
+	if _, err := os.Stat(backupPath); err != nil {
+		return "", err
+	}
+	if err := checkBackup(ctx, backupPath); err != nil {
+		return "", err
+	}
+
+	// Copy first, so the database is only replaced by a complete file.
+	tmp, err := os.CreateTemp(filepath.Dir(dbPath), ".cpaw-restore-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if err := copyFile(tmp, backupPath); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	previousPath := ""
+	if _, err := os.Stat(dbPath); err == nil {
+		previousPath = dbPath + ".before-restore-" + time.Now().Format("20060102-150405")
+		// A leftover journal would be applied to the restored database, so it
+		// moves together with the database.
+		for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+			err := os.Rename(dbPath+suffix, previousPath+suffix)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	return previousPath, os.Rename(tmp.Name(), dbPath)
+}
+
+func copyFile(dst *os.File, srcPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	return dst.Sync()
+}
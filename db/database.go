@@ -0,0 +1,56 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+const (
+	SqliteBackend   Backend = "sqlite"
+	PostgresBackend Backend = "postgres"
+)
+
+var ErrUnsupportedBackend = errors.New("Unsupported database backend")
+
+// Backend is the kind of database the server stores its data in.
+type Backend string
+
+func (b Backend) IsValid() bool {
+	return b == SqliteBackend || b == PostgresBackend
+}
+
+// Database is implemented by all backends. Each backend has its own set of
+// migrations, which are applied by SetUp.
+type Database interface {
+	Backend() Backend
+	// Conn returns the connection pool the repositories work on.
+	Conn() *sql.DB
+	SetUp() error
+	MigrateUp() error
+	MigrateDown() error
+	MigrateSteps(n int) error
+	Version() (version uint, dirty bool, err error)
+	Close() error
+}
+
+// Open opens the database of the given backend. dbPath is the file of a
+// SQLite database and dsn the connection string of a Postgres database.
+func Open(backend Backend, dbPath string, dsn string) (Database, error) {
+	var (
+		database Database
+		err      error
+	)
+	switch backend {
+	case SqliteBackend:
+		database, err = NewSqlite(WithDbName("cpaw"), WithDbPath(dbPath))
+	case PostgresBackend:
+		database, err = NewPostgres(WithDsn(dsn))
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnsupportedBackend, backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return database, nil
+}
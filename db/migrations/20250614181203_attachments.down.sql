@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS attachments_item_id_idx;
+
+DROP TABLE IF EXISTS attachments;
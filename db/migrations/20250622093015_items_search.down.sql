@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS items_search_after_delete;
+
+DROP TRIGGER IF EXISTS items_search_after_update;
+
+DROP TRIGGER IF EXISTS items_search_after_insert;
+
+DROP TABLE IF EXISTS items_search;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS items_user_id_created_at_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS items_user_id_created_at_idx ON items (user_id, created_at DESC, id DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS api_tokens_user_id_idx;
+
+DROP TABLE IF EXISTS api_tokens;
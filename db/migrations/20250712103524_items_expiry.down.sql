@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS items_expires_at_idx;
+
+ALTER TABLE items DROP COLUMN burn_after_read;
+
+ALTER TABLE items DROP COLUMN expires_at;
@@ -0,0 +1,5 @@
+ALTER TABLE items ADD COLUMN expires_at INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE items ADD COLUMN burn_after_read INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS items_expires_at_idx ON items (expires_at) WHERE expires_at > 0;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS item_shares_item_id_idx;
+
+DROP TABLE IF EXISTS item_shares;
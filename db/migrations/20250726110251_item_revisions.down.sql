@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS item_revisions_item_id_idx;
+
+DROP TABLE IF EXISTS item_revisions;
+
+ALTER TABLE items DROP COLUMN updated_at;
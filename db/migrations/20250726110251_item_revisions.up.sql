@@ -0,0 +1,11 @@
+ALTER TABLE items ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS item_revisions (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    item_id TEXT NOT NULL,
+    content TEXT NOT NULL,
+    FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS item_revisions_item_id_idx ON item_revisions (item_id, created_at DESC);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS items_workspace_id_created_at_idx;
+
+ALTER TABLE items DROP COLUMN workspace_id;
+
+DROP INDEX IF EXISTS workspace_members_user_id_idx;
+
+DROP TABLE IF EXISTS workspace_members;
+
+DROP TABLE IF EXISTS workspaces;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS workspaces (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    owner_id TEXT NOT NULL,
+    FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (workspace_id, user_id),
+    FOREIGN KEY (workspace_id) REFERENCES workspaces (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+
+ALTER TABLE items ADD COLUMN workspace_id TEXT REFERENCES workspaces (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS items_workspace_id_created_at_idx ON items (workspace_id, created_at DESC, id DESC);
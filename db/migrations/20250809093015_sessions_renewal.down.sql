@@ -0,0 +1,3 @@
+ALTER TABLE sessions DROP COLUMN remember;
+
+ALTER TABLE sessions DROP COLUMN created_at;
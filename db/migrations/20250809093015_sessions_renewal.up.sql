@@ -0,0 +1,6 @@
+ALTER TABLE sessions ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE sessions ADD COLUMN remember INTEGER NOT NULL DEFAULT 0;
+
+-- Existing sessions were created with the default lifetime of 15 minutes.
+UPDATE sessions SET created_at = expires_at - 900;
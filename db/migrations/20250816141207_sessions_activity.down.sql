@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS sessions_user_id_idx;
+
+DROP INDEX IF EXISTS sessions_id_idx;
+
+ALTER TABLE sessions DROP COLUMN last_seen_at;
+
+ALTER TABLE sessions DROP COLUMN ip_address;
+
+ALTER TABLE sessions DROP COLUMN user_agent;
+
+ALTER TABLE sessions DROP COLUMN id;
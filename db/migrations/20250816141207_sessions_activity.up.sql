@@ -0,0 +1,13 @@
+ALTER TABLE sessions ADD COLUMN id TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE sessions ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE sessions ADD COLUMN last_seen_at INTEGER NOT NULL DEFAULT 0;
+
+UPDATE sessions SET id = lower(hex(randomblob(16))), last_seen_at = created_at;
+
+CREATE UNIQUE INDEX IF NOT EXISTS sessions_id_idx ON sessions (id);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
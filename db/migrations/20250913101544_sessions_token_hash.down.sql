@@ -0,0 +1,3 @@
+DELETE FROM sessions;
+
+ALTER TABLE sessions RENAME COLUMN token_hash TO token;
@@ -0,0 +1,5 @@
+-- Sessions only store a hash of their token from now on. Existing sessions
+-- hold the plain token and are signed out.
+DELETE FROM sessions;
+
+ALTER TABLE sessions RENAME COLUMN token TO token_hash;
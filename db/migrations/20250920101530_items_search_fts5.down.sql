@@ -0,0 +1,32 @@
+DROP TRIGGER IF EXISTS items_search_after_delete;
+
+DROP TRIGGER IF EXISTS items_search_after_update;
+
+DROP TRIGGER IF EXISTS items_search_after_insert;
+
+DROP TABLE IF EXISTS items_search;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS items_search USING fts4 (
+    item_id,
+    content,
+    notindexed=item_id,
+    tokenize=unicode61
+);
+
+INSERT INTO items_search (item_id, content)
+SELECT id, content FROM items;
+
+CREATE TRIGGER IF NOT EXISTS items_search_after_insert AFTER INSERT ON items
+BEGIN
+    INSERT INTO items_search (item_id, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS items_search_after_update AFTER UPDATE OF content ON items
+BEGIN
+    UPDATE items_search SET content = new.content WHERE item_id = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS items_search_after_delete AFTER DELETE ON items
+BEGIN
+    DELETE FROM items_search WHERE item_id = old.id;
+END;
@@ -0,0 +1,32 @@
+DROP TRIGGER IF EXISTS items_search_after_delete;
+
+DROP TRIGGER IF EXISTS items_search_after_update;
+
+DROP TRIGGER IF EXISTS items_search_after_insert;
+
+DROP TABLE IF EXISTS items_search;
+
+-- The rowid of an entry is the rowid of its item, so the triggers find the
+-- entry of an item without scanning the table.
+CREATE VIRTUAL TABLE IF NOT EXISTS items_search USING fts5 (
+    content,
+    tokenize = 'unicode61'
+);
+
+INSERT INTO items_search (rowid, content)
+SELECT rowid, content FROM items;
+
+CREATE TRIGGER IF NOT EXISTS items_search_after_insert AFTER INSERT ON items
+BEGIN
+    INSERT INTO items_search (rowid, content) VALUES (new.rowid, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS items_search_after_update AFTER UPDATE OF content ON items
+BEGIN
+    UPDATE items_search SET content = new.content WHERE rowid = old.rowid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS items_search_after_delete AFTER DELETE ON items
+BEGIN
+    DELETE FROM items_search WHERE rowid = old.rowid;
+END;
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS login_challenges;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS item_shares;
+DROP TABLE IF EXISTS item_revisions;
+DROP TABLE IF EXISTS attachments;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS roles;
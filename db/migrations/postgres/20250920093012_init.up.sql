@@ -0,0 +1,167 @@
+-- The schema matches the SQLite migrations up to 20250913101544. Timestamps
+-- are unix seconds like in SQLite.
+
+CREATE TABLE IF NOT EXISTS roles (name TEXT NOT NULL PRIMARY KEY);
+
+INSERT INTO roles (name)
+VALUES
+    ('admin'),
+    ('user')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    user_name TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    role TEXT,
+    totp_secret TEXT NOT NULL DEFAULT '',
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_last_step BIGINT NOT NULL DEFAULT 0,
+    FOREIGN KEY (role) REFERENCES roles (name) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS workspaces (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    name TEXT NOT NULL,
+    owner_id TEXT NOT NULL,
+    FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (workspace_id, user_id),
+    FOREIGN KEY (workspace_id) REFERENCES workspaces (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+
+CREATE TABLE IF NOT EXISTS items (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    content TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    expires_at BIGINT NOT NULL DEFAULT 0,
+    burn_after_read BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at BIGINT NOT NULL DEFAULT 0,
+    workspace_id TEXT,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (workspace_id) REFERENCES workspaces (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS items_user_id_created_at_idx ON items (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS items_workspace_id_created_at_idx ON items (workspace_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS items_expires_at_idx ON items (expires_at) WHERE expires_at > 0;
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    item_id TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    data BYTEA NOT NULL,
+    FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS attachments_item_id_idx ON attachments (item_id);
+
+-- rowid stands in for the implicit rowid of SQLite, which orders revisions
+-- created within the same second.
+CREATE TABLE IF NOT EXISTS item_revisions (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    item_id TEXT NOT NULL,
+    content TEXT NOT NULL,
+    rowid BIGSERIAL NOT NULL,
+    FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS item_revisions_item_id_idx ON item_revisions (item_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS item_shares (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    item_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    token TEXT NOT NULL UNIQUE,
+    expires_at BIGINT NOT NULL DEFAULT 0,
+    max_views BIGINT NOT NULL DEFAULT 0,
+    view_count BIGINT NOT NULL DEFAULT 0,
+    password_hash TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS item_shares_item_id_idx ON item_shares (item_id);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT NOT NULL UNIQUE,
+    token_hash TEXT NOT NULL PRIMARY KEY,
+    created_at BIGINT NOT NULL DEFAULT 0,
+    expires_at BIGINT NOT NULL,
+    last_seen_at BIGINT NOT NULL DEFAULT 0,
+    user_id TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    remember BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    last_used_at BIGINT NOT NULL DEFAULT 0,
+    expires_at BIGINT NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS api_tokens_user_id_idx ON api_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    scope TEXT NOT NULL,
+    key TEXT NOT NULL,
+    failures BIGINT NOT NULL DEFAULT 0,
+    last_failed_at BIGINT NOT NULL,
+    locked_until BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    code_hash TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (user_id, code_hash),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS login_challenges (
+    token_hash TEXT NOT NULL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    remember BOOLEAN NOT NULL DEFAULT FALSE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (issuer, subject),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/michaelhass/cpaw/models"
+)
+
+type ApiTokenRepository struct {
+	db *sql.DB
+}
+
+func NewApiTokenRepository(db *sql.DB) *ApiTokenRepository {
+	return &ApiTokenRepository{db: db}
+}
+
+type CreateApiTokenParams struct {
+	UserId    string
+	Name      string
+	TokenHash string
+	Scopes    []models.Scope
+	ExpiresAt time.Time
+}
+
+const createApiTokenQuery = `
+INSERT INTO api_tokens (id, created_at, user_id, name, token_hash, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at, user_id, name, token_hash, scopes, last_used_at, expires_at;
+`
+
+func (tr *ApiTokenRepository) CreateApiToken(ctx context.Context, arg CreateApiTokenParams) (models.ApiToken, error) {
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return models.ApiToken{}, err
+	}
+
+	var expiresAt int64
+	if !arg.ExpiresAt.IsZero() {
+		expiresAt = arg.ExpiresAt.Unix()
+	}
+
+	row := tr.db.QueryRowContext(
+		ctx,
+		createApiTokenQuery,
+		uuid.String(),
+		time.Now().Unix(),
+		arg.UserId,
+		arg.Name,
+		arg.TokenHash,
+		joinScopes(arg.Scopes),
+		expiresAt,
+	)
+	return scanApiToken(row)
+}
+
+const getApiTokenByHashQuery = `
+SELECT id, created_at, user_id, name, token_hash, scopes, last_used_at, expires_at FROM api_tokens
+WHERE token_hash = $1;
+`
+
+func (tr *ApiTokenRepository) GetApiTokenByHash(ctx context.Context, tokenHash string) (models.ApiToken, error) {
+	row := tr.db.QueryRowContext(ctx, getApiTokenByHashQuery, tokenHash)
+	token, err := scanApiToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return token, ErrNotFound
+	}
+	return token, err
+}
+
+const listApiTokensForUserQuery = `
+SELECT id, created_at, user_id, name, token_hash, scopes, last_used_at, expires_at FROM api_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC, name;
+`
+
+func (tr *ApiTokenRepository) ListApiTokensForUser(ctx context.Context, userId string) ([]models.ApiToken, error) {
+	tokens := []models.ApiToken{}
+
+	rows, err := tr.db.QueryContext(ctx, listApiTokensForUserQuery, userId)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		token, err := scanApiToken(rows)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+const updateApiTokenLastUsedQuery = "UPDATE api_tokens SET last_used_at = $1 WHERE id = $2;"
+
+func (tr *ApiTokenRepository) UpdateLastUsed(ctx context.Context, tokenId string, lastUsedAt time.Time) error {
+	_, err := tr.db.ExecContext(ctx, updateApiTokenLastUsedQuery, lastUsedAt.Unix(), tokenId)
+	return err
+}
+
+const deleteApiTokenForUserQuery = "DELETE FROM api_tokens WHERE id = $1 AND user_id = $2;"
+
+type DeleteApiTokenForUserParams struct {
+	TokenId string
+	UserId  string
+}
+
+func (tr *ApiTokenRepository) DeleteApiTokenForUser(ctx context.Context, arg DeleteApiTokenForUserParams) error {
+	result, err := tr.db.ExecContext(ctx, deleteApiTokenForUserQuery, arg.TokenId, arg.UserId)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanApiToken(row rowScanner) (models.ApiToken, error) {
+	var (
+		token  models.ApiToken
+		scopes string
+	)
+	err := row.Scan(
+		&token.Id,
+		&token.CreatedAt,
+		&token.UserId,
+		&token.Name,
+		&token.TokenHash,
+		&scopes,
+		&token.LastUsedAt,
+		&token.ExpiresAt,
+	)
+	token.Scopes = splitScopes(scopes)
+	return token, err
+}
+
+func joinScopes(scopes []models.Scope) string {
+	values := make([]string, len(scopes))
+	for i, scope := range scopes {
+		values[i] = string(scope)
+	}
+	return strings.Join(values, ",")
+}
+
+func splitScopes(scopes string) []models.Scope {
+	result := []models.Scope{}
+	for _, scope := range strings.Split(scopes, ",") {
+		if len(scope) > 0 {
+			result = append(result, models.Scope(scope))
+		}
+	}
+	return result
+}
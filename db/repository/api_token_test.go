@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+func TestApiTokenRepository(t *testing.T) {
+	runWithTestStores(t, "ApiTokenRepositoryTest.db", func(t *testing.T, stores testStores) {
+		tokenRepo, userRepo := stores.apiTokens, stores.users
+
+		tokenRepoTestFunc := func(f func(*testing.T, models.User)) func(*testing.T) {
+			return func(t *testing.T) {
+				t.Cleanup(func() {
+					userRepo.DeleteAll(context.Background())
+				})
+				testUser, err := userRepo.CreateUser(context.Background(), CreateUserParams{
+					UserName: "token_user",
+					Password: "pw",
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				f(t, testUser)
+			}
+		}
+
+		t.Run("CreateApiToken", tokenRepoTestFunc(testCreateApiToken(tokenRepo)))
+		t.Run("UpdateLastUsed", tokenRepoTestFunc(testUpdateApiTokenLastUsed(tokenRepo)))
+		t.Run("DeleteApiTokenForUser", tokenRepoTestFunc(testDeleteApiTokenForUser(tokenRepo)))
+	})
+}
+
+func testCreateApiToken(repo ApiTokenStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		params := CreateApiTokenParams{
+			UserId:    testUser.Id,
+			Name:      "ci",
+			TokenHash: "hash_1",
+			Scopes:    []models.Scope{models.ItemsReadScope, models.ItemsWriteScope},
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		token, err := repo.CreateApiToken(ctx, params)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if token.Name != params.Name ||
+			token.TokenHash != params.TokenHash ||
+			token.ExpiresAt != params.ExpiresAt.Unix() ||
+			token.LastUsedAt != 0 ||
+			!reflect.DeepEqual(token.Scopes, params.Scopes) {
+			t.Errorf("Token not stored correctly. Got: %v", token)
+			return
+		}
+
+		_, err = repo.CreateApiToken(ctx, params)
+		if err == nil {
+			t.Error("Expected error for duplicate token hash")
+			return
+		}
+
+		gotToken, err := repo.GetApiTokenByHash(ctx, params.TokenHash)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !reflect.DeepEqual(token, gotToken) {
+			t.Errorf("Tokens did not match. Expected: %v. Got: %v", token, gotToken)
+		}
+
+		_, err = repo.GetApiTokenByHash(ctx, "unknown")
+		if !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound'. Got: ", err)
+		}
+	}
+}
+
+func testUpdateApiTokenLastUsed(repo ApiTokenStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		token, err := repo.CreateApiToken(ctx, CreateApiTokenParams{
+			UserId:    testUser.Id,
+			Name:      "script",
+			TokenHash: "hash_2",
+			Scopes:    []models.Scope{models.ItemsReadScope},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		lastUsedAt := time.Now()
+		if err := repo.UpdateLastUsed(ctx, token.Id, lastUsedAt); err != nil {
+			t.Error(err)
+			return
+		}
+
+		tokens, err := repo.ListApiTokensForUser(ctx, testUser.Id)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(tokens) != 1 || tokens[0].LastUsedAt != lastUsedAt.Unix() {
+			t.Errorf("Last used time not updated. Got: %v", tokens)
+		}
+	}
+}
+
+func testDeleteApiTokenForUser(repo ApiTokenStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		token, err := repo.CreateApiToken(ctx, CreateApiTokenParams{
+			UserId:    testUser.Id,
+			Name:      "revoke",
+			TokenHash: "hash_3",
+			Scopes:    []models.Scope{models.ItemsReadScope},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		err = repo.DeleteApiTokenForUser(ctx, DeleteApiTokenForUserParams{TokenId: token.Id, UserId: "other"})
+		if !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound'. Got: ", err)
+			return
+		}
+
+		err = repo.DeleteApiTokenForUser(ctx, DeleteApiTokenForUserParams{TokenId: token.Id, UserId: testUser.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		_, err = repo.GetApiTokenByHash(ctx, token.TokenHash)
+		if !errors.Is(err, ErrNotFound) {
+			t.Error("Token not deleted", err)
+		}
+	}
+}
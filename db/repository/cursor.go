@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+var ErrInvalidCursor = errors.New("Invalid cursor.")
+
+// ItemCursor points at the last item of a page. Items are ordered by
+// created_at and id, so the next page starts strictly after it.
+type ItemCursor struct {
+	CreatedAt int64
+	Id        string
+}
+
+func newItemCursor(item models.Item) ItemCursor {
+	return ItemCursor{CreatedAt: item.CreatedAt, Id: item.Id}
+}
+
+func (c ItemCursor) IsZero() bool {
+	return c.CreatedAt == 0 && len(c.Id) == 0
+}
+
+func (c ItemCursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	value := fmt.Sprintf("%d:%s", c.CreatedAt, c.Id)
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+func ParseItemCursor(s string) (ItemCursor, error) {
+	var cursor ItemCursor
+	if len(s) == 0 {
+		return cursor, nil
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(value), ":")
+	if !ok || len(id) == 0 {
+		return cursor, ErrInvalidCursor
+	}
+	cursor.CreatedAt, err = strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	cursor.Id = id
+	return cursor, nil
+}
+
+func (c ItemCursor) queryArgs() (int64, string) {
+	if c.IsZero() {
+		return math.MaxInt64, ""
+	}
+	return c.CreatedAt, c.Id
+}
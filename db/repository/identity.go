@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+type IdentityRepository struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+type CreateIdentityParams struct {
+	Issuer  string
+	Subject string
+	UserId  string
+}
+
+const createIdentityQuery = `
+INSERT INTO user_identities (issuer, subject, user_id, created_at)
+VALUES ($1, $2, $3, $4)
+RETURNING issuer, subject, user_id, created_at;
+`
+
+func (ir *IdentityRepository) CreateIdentity(ctx context.Context, arg CreateIdentityParams) (models.Identity, error) {
+	row := ir.db.QueryRowContext(
+		ctx,
+		createIdentityQuery,
+		arg.Issuer,
+		arg.Subject,
+		arg.UserId,
+		time.Now().Unix(),
+	)
+	return scanIdentity(row)
+}
+
+type GetIdentityParams struct {
+	Issuer  string
+	Subject string
+}
+
+const getIdentityQuery = `
+SELECT issuer, subject, user_id, created_at FROM user_identities
+WHERE issuer = $1 AND subject = $2;
+`
+
+func (ir *IdentityRepository) GetIdentity(ctx context.Context, arg GetIdentityParams) (models.Identity, error) {
+	row := ir.db.QueryRowContext(ctx, getIdentityQuery, arg.Issuer, arg.Subject)
+	identity, err := scanIdentity(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return identity, ErrNotFound
+	}
+	return identity, err
+}
+
+func scanIdentity(row rowScanner) (models.Identity, error) {
+	var identity models.Identity
+	err := row.Scan(&identity.Issuer, &identity.Subject, &identity.UserId, &identity.CreatedAt)
+	return identity, err
+}
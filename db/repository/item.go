@@ -4,29 +4,70 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/michaelhass/cpaw/db"
 	"github.com/michaelhass/cpaw/models"
 )
 
 type ItemRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	backend db.Backend
 }
 
-func NewItemRepository(db *sql.DB) *ItemRepository {
-	return &ItemRepository{db: db}
+type ItemRepositoryOption func(*ItemRepository)
+
+// WithBackend sets the backend of the database, which decides how items are
+// searched. It defaults to SQLite.
+func WithBackend(backend db.Backend) ItemRepositoryOption {
+	return func(ir *ItemRepository) {
+		ir.backend = backend
+	}
+}
+
+func NewItemRepository(db *sql.DB, opts ...ItemRepositoryOption) *ItemRepository {
+	ir := &ItemRepository{db: db}
+	for _, opt := range opts {
+		opt(ir)
+	}
+	return ir
 }
 
 type CreateItemParams struct {
 	Content string
 	UserId  string
+	// WorkspaceId is optional. Items without one are personal items of the
+	// user.
+	WorkspaceId string
+	// ExpiresAt is optional. The zero value means the item does not expire.
+	ExpiresAt     time.Time
+	BurnAfterRead bool
+	Attachments   []CreateAttachmentParams
+	// CreatedAt is optional and defaults to now. Imports use it to keep the
+	// original creation time.
+	CreatedAt time.Time
+}
+
+type CreateAttachmentParams struct {
+	FileName string
+	MimeType string
+	Data     []byte
 }
 
 const createItemQuery = `
-INSERT INTO items (id, created_at, content, user_id)
-VALUES ($1, $2, $3, $4)
-RETURNING id, created_at, content, user_id;
+INSERT INTO items (id, created_at, content, user_id, expires_at, burn_after_read, workspace_id)
+VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+RETURNING id, created_at, content, user_id, expires_at, burn_after_read, updated_at, COALESCE(workspace_id, '');
+`
+
+const createAttachmentQuery = `
+INSERT INTO attachments (id, created_at, item_id, file_name, mime_type, size, data)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at, item_id, file_name, mime_type, size;
 `
 
 func (ir *ItemRepository) CreateItem(ctx context.Context, arg CreateItemParams) (models.Item, error) {
@@ -39,73 +80,733 @@ func (ir *ItemRepository) CreateItem(ctx context.Context, arg CreateItemParams)
 
 	id := uuid.String()
 	createdAt := time.Now().Unix()
+	if !arg.CreatedAt.IsZero() {
+		createdAt = arg.CreatedAt.Unix()
+	}
 
-	row := ir.db.QueryRowContext(
+	var expiresAt int64
+	if !arg.ExpiresAt.IsZero() {
+		expiresAt = arg.ExpiresAt.Unix()
+	}
+
+	tx, err := ir.db.BeginTx(ctx, nil)
+	if err != nil {
+		return item, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(
 		ctx,
 		createItemQuery,
 		id,
 		createdAt,
 		arg.Content,
 		arg.UserId,
+		expiresAt,
+		arg.BurnAfterRead,
+		arg.WorkspaceId,
 	)
 
-	err = row.Scan(&item.Id, &item.CreatedAt, &item.Content, &item.UserId)
-	return item, err
+	item, err = scanItem(row)
+	if err != nil {
+		return item, err
+	}
+
+	item.Attachments = []models.Attachment{}
+	for _, attachmentArg := range arg.Attachments {
+		attachment, err := createAttachment(ctx, tx, item.Id, createdAt, attachmentArg)
+		if err != nil {
+			return models.Item{}, err
+		}
+		item.Attachments = append(item.Attachments, attachment)
+	}
+
+	return item, tx.Commit()
+}
+
+func createAttachment(
+	ctx context.Context,
+	tx *sql.Tx,
+	itemId string,
+	createdAt int64,
+	arg CreateAttachmentParams,
+) (models.Attachment, error) {
+	var attachment models.Attachment
+
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return attachment, err
+	}
+
+	row := tx.QueryRowContext(
+		ctx,
+		createAttachmentQuery,
+		uuid.String(),
+		createdAt,
+		itemId,
+		arg.FileName,
+		arg.MimeType,
+		len(arg.Data),
+		arg.Data,
+	)
+	err = row.Scan(
+		&attachment.Id,
+		&attachment.CreatedAt,
+		&attachment.ItemId,
+		&attachment.FileName,
+		&attachment.MimeType,
+		&attachment.Size,
+	)
+	return attachment, err
 }
 
-const getItemByIdQuery = "SELECT id, created_at, content, user_id FROM items WHERE id = $1;"
+const getItemByIdQuery = `
+SELECT id, created_at, content, user_id, expires_at, burn_after_read, updated_at, COALESCE(workspace_id, '') FROM items
+WHERE id = $1 AND (expires_at = 0 OR expires_at > $2);
+`
 
 func (ir *ItemRepository) GetItemById(ctx context.Context, itemId string) (models.Item, error) {
-	row := ir.db.QueryRowContext(ctx, getItemByIdQuery, itemId)
-	var item models.Item
-	err := row.Scan(&item.Id, &item.CreatedAt, &item.Content, &item.UserId)
+	row := ir.db.QueryRowContext(ctx, getItemByIdQuery, itemId, time.Now().Unix())
+	item, err := scanItem(row)
 	if errors.Is(err, sql.ErrNoRows) {
 		return item, ErrNotFound
 	}
+	if err != nil {
+		return item, err
+	}
+	item.Attachments, err = ir.listAttachmentsForItem(ctx, item.Id)
 	return item, err
 }
 
-const getItemForUserWuery = "SELECT id, created_at, content, user_id FROM items WHERE id = $1 AND user_id = $2;"
+const getItemForUserWuery = `
+SELECT id, created_at, content, user_id, expires_at, burn_after_read, updated_at, COALESCE(workspace_id, '') FROM items
+WHERE id = $1 AND user_id = $2 AND (expires_at = 0 OR expires_at > $3);
+`
+
+const burnItemForUserQuery = "DELETE FROM items WHERE id = $1 AND user_id = $2 AND burn_after_read = TRUE;"
 
 type GetItemForUserParams struct {
 	ItemId string
 	UserId string
 }
 
+// GetItemForUser returns an unexpired item. Burn after read items are deleted
+// by reading them, so only the first of concurrent readers gets the item.
 func (ir *ItemRepository) GetItemForUser(ctx context.Context, arg GetItemForUserParams) (models.Item, error) {
-	row := ir.db.QueryRowContext(ctx, getItemByIdQuery, arg.ItemId, arg.UserId)
-	var item models.Item
-	err := row.Scan(&item.Id, &item.CreatedAt, &item.Content, &item.UserId)
+	row := ir.db.QueryRowContext(ctx, getItemForUserWuery, arg.ItemId, arg.UserId, time.Now().Unix())
+	item, err := scanItem(row)
 	if errors.Is(err, sql.ErrNoRows) {
 		return item, ErrNotFound
 	}
-	return item, err
+	if err != nil {
+		return item, err
+	}
+	item.Attachments, err = ir.listAttachmentsForItem(ctx, item.Id)
+	if err != nil || !item.BurnAfterRead {
+		return item, err
+	}
+
+	result, err := ir.db.ExecContext(ctx, burnItemForUserQuery, arg.ItemId, arg.UserId)
+	if err != nil {
+		return models.Item{}, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return models.Item{}, err
+	}
+	if count == 0 {
+		return models.Item{}, ErrNotFound
+	}
+	return item, nil
 }
 
 const listItemsForUserQuery = `
-SELECT * FROM items
+SELECT id, created_at, content, user_id, expires_at, burn_after_read, updated_at, COALESCE(workspace_id, '') FROM items
+WHERE ((workspace_id IS NULL AND user_id = $1 AND $2 = '') OR workspace_id = $2)
+    AND (created_at < $3 OR (created_at = $3 AND id < $4))
+    AND (expires_at = 0 OR expires_at > $5)
+ORDER BY created_at DESC, id DESC
+LIMIT $6;
+`
+
+// ListItemsForUserParams lists the personal items of a user or, if set, the
+// items of a workspace.
+type ListItemsForUserParams struct {
+	UserId      string
+	WorkspaceId string
+	Cursor      ItemCursor
+	Limit       int
+}
+
+func (ir *ItemRepository) ListItemsForUser(ctx context.Context, arg ListItemsForUserParams) (models.ItemPage, error) {
+	page := models.ItemPage{Items: []models.Item{}}
+
+	limit := arg.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+
+	createdAt, id := arg.Cursor.queryArgs()
+	rows, err := ir.db.QueryContext(
+		ctx,
+		listItemsForUserQuery,
+		arg.UserId,
+		arg.WorkspaceId,
+		createdAt,
+		id,
+		time.Now().Unix(),
+		limit+1,
+	)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return page, err
+		}
+		page.Items = append(page.Items, hideBurnAfterReadContent(item))
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.NextCursor = newItemCursor(page.Items[limit-1]).String()
+	}
+
+	err = ir.loadAttachments(ctx, page.Items)
+	return page, err
+}
+
+const listItemsForUserCreatedSinceQuery = `
+SELECT id, created_at, content, user_id, expires_at, burn_after_read, updated_at, COALESCE(workspace_id, '') FROM items
 WHERE user_id = $1
-ORDER BY created_at DESC
+    AND workspace_id IS NULL
+    AND created_at >= $2
+    AND (expires_at = 0 OR expires_at > $3)
+ORDER BY created_at ASC, id ASC
+LIMIT $4;
 `
 
-func (ir *ItemRepository) ListItemsForUser(ctx context.Context, userId string) ([]models.Item, error) {
+type ListItemsForUserCreatedSinceParams struct {
+	UserId    string
+	CreatedAt int64
+	Limit     int
+}
+
+// ListItemsForUserCreatedSince lists the oldest personal items created at or
+// after the given time first.
+func (ir *ItemRepository) ListItemsForUserCreatedSince(
+	ctx context.Context,
+	arg ListItemsForUserCreatedSinceParams,
+) ([]models.Item, error) {
 	items := []models.Item{}
 
-	rows, err := ir.db.QueryContext(ctx, listItemsForUserQuery, userId)
+	rows, err := ir.db.QueryContext(
+		ctx,
+		listItemsForUserCreatedSinceQuery,
+		arg.UserId,
+		arg.CreatedAt,
+		time.Now().Unix(),
+		arg.Limit,
+	)
 	if err != nil {
 		return items, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var item models.Item
-		if err := rows.Scan(&item.Id, &item.CreatedAt, &item.Content, &item.UserId); err != nil {
+		item, err := scanItem(rows)
+		if err != nil {
 			return items, err
 		}
-		items = append(items, item)
+		items = append(items, hideBurnAfterReadContent(item))
+	}
+	if err := rows.Err(); err != nil {
+		return items, err
 	}
 
-	return items, rows.Err()
+	err = ir.loadAttachments(ctx, items)
+	return items, err
+}
+
+const searchItemsForUserQuery = `
+SELECT i.id, i.created_at, i.content, i.user_id, i.expires_at, i.burn_after_read, i.updated_at, COALESCE(i.workspace_id, ''),
+    snippet(items_search, 0, $1, $2, '…', 24),
+    bm25(items_search)
+FROM items_search s
+INNER JOIN items i ON i.rowid = s.rowid
+WHERE items_search MATCH $3
+    AND ((i.workspace_id IS NULL AND i.user_id = $4 AND $5 = '') OR i.workspace_id = $5)
+    AND i.burn_after_read = FALSE
+    AND (i.expires_at = 0 OR i.expires_at > $6)
+ORDER BY bm25(items_search), i.created_at DESC, i.id DESC
+LIMIT $7;
+`
+
+// SearchItemsForUserParams searches the personal items of a user or, if set,
+// the items of a workspace. Results are ordered by rank, best match first.
+type SearchItemsForUserParams struct {
+	UserId      string
+	WorkspaceId string
+	Query       string
+	Limit       int
+}
+
+func (ir *ItemRepository) SearchItemsForUser(ctx context.Context, arg SearchItemsForUserParams) ([]models.ItemSearchResult, error) {
+	var (
+		results []models.ItemSearchResult
+		err     error
+	)
+	if ir.backend == db.PostgresBackend {
+		results, err = ir.searchItemsWithoutIndex(ctx, arg)
+	} else {
+		results, err = ir.searchItems(ctx, arg)
+	}
+	if err != nil {
+		return results, err
+	}
+
+	items := make([]models.Item, len(results))
+	for i, result := range results {
+		items[i] = result.Item
+	}
+	if err := ir.loadAttachments(ctx, items); err != nil {
+		return results, err
+	}
+	for i := range results {
+		results[i].Attachments = items[i].Attachments
+	}
+
+	return results, nil
+}
+
+// searchItems searches the full-text index of SQLite.
+func (ir *ItemRepository) searchItems(ctx context.Context, arg SearchItemsForUserParams) ([]models.ItemSearchResult, error) {
+	results := []models.ItemSearchResult{}
+
+	query := newSearchQuery(arg.Query)
+	if len(query) == 0 {
+		return results, nil
+	}
+
+	rows, err := ir.db.QueryContext(
+		ctx,
+		searchItemsForUserQuery,
+		snippetMatchStart,
+		snippetMatchEnd,
+		query,
+		arg.UserId,
+		arg.WorkspaceId,
+		time.Now().Unix(),
+		searchLimit(arg.Limit),
+	)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			result  models.ItemSearchResult
+			snippet string
+			bm25    float64
+		)
+		err := rows.Scan(
+			&result.Id,
+			&result.CreatedAt,
+			&result.Content,
+			&result.UserId,
+			&result.ExpiresAt,
+			&result.BurnAfterRead,
+			&result.UpdatedAt,
+			&result.WorkspaceId,
+			&snippet,
+			&bm25,
+		)
+		if err != nil {
+			return results, err
+		}
+		result.Snippet = parseSnippet(snippet)
+		// bm25 is negative and lower for better matches.
+		result.Rank = -bm25
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+const searchItemsWithoutIndexQuery = `
+SELECT id, created_at, content, user_id, expires_at, burn_after_read, updated_at, COALESCE(workspace_id, ''),
+    %s AS rank
+FROM items
+WHERE ((workspace_id IS NULL AND user_id = $1 AND $2 = '') OR workspace_id = $2)
+    AND burn_after_read = FALSE
+    AND (expires_at = 0 OR expires_at > $3)
+    AND %s
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT $4;
+`
+
+// searchTermRank ranks how often a term occurs in the content like
+// matchSearchTerms, so the database orders results the same way.
+const searchTermRank = `(
+    (length(lower(content)) - length(replace(lower(content), lower($%[1]d::text), '')))::float
+    / length($%[1]d::text) * 2.2
+) / (
+    (length(lower(content)) - length(replace(lower(content), lower($%[1]d::text), '')))::float
+    / length($%[1]d::text) + 1.2
+)`
+
+// searchItemsWithoutIndex searches for items that contain every term, ignoring
+// case. Unlike the full-text index, terms also match within words.
+func (ir *ItemRepository) searchItemsWithoutIndex(
+	ctx context.Context,
+	arg SearchItemsForUserParams,
+) ([]models.ItemSearchResult, error) {
+	results := []models.ItemSearchResult{}
+
+	terms := newSearchTerms(arg.Query)
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	ranks := make([]string, len(terms))
+	conditions := make([]string, len(terms))
+	args := []any{arg.UserId, arg.WorkspaceId, time.Now().Unix(), searchLimit(arg.Limit)}
+	for i, term := range terms {
+		ranks[i] = fmt.Sprintf(searchTermRank, len(args)+1)
+		conditions[i] = fmt.Sprintf("content ILIKE $%d", len(args)+2)
+		args = append(args, term, likeSearchPattern(term))
+	}
+	query := fmt.Sprintf(
+		searchItemsWithoutIndexQuery,
+		strings.Join(ranks, " + "),
+		strings.Join(conditions, " AND "),
+	)
+
+	rows, err := ir.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result models.ItemSearchResult
+		err := rows.Scan(
+			&result.Id,
+			&result.CreatedAt,
+			&result.Content,
+			&result.UserId,
+			&result.ExpiresAt,
+			&result.BurnAfterRead,
+			&result.UpdatedAt,
+			&result.WorkspaceId,
+			&result.Rank,
+		)
+		if err != nil {
+			return results, err
+		}
+		result.Snippet, _ = matchSearchTerms(result.Content, terms)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// searchLimit returns the limit of search results for a query, where zero or
+// less means no limit.
+func searchLimit(limit int) int {
+	if limit <= 0 {
+		return math.MaxInt32
+	}
+	return limit
+}
+
+const getItemForUpdateQuery = `
+SELECT content, created_at, updated_at FROM items
+WHERE id = $1 AND user_id = $2 AND burn_after_read = FALSE AND (expires_at = 0 OR expires_at > $3);
+`
+
+const createItemRevisionQuery = `
+INSERT INTO item_revisions (id, created_at, item_id, content)
+VALUES ($1, $2, $3, $4);
+`
+
+const updateItemContentQuery = `
+UPDATE items SET content = $1, updated_at = $2
+WHERE id = $3
+RETURNING id, created_at, content, user_id, expires_at, burn_after_read, updated_at, COALESCE(workspace_id, '');
+`
+
+type UpdateItemForUserParams struct {
+	ItemId  string
+	UserId  string
+	Content string
+}
+
+// UpdateItemForUser replaces the content of an item and keeps the previous
+// content as a revision. Burn after read items can't be updated.
+func (ir *ItemRepository) UpdateItemForUser(ctx context.Context, arg UpdateItemForUserParams) (models.Item, error) {
+	var item models.Item
+
+	tx, err := ir.db.BeginTx(ctx, nil)
+	if err != nil {
+		return item, err
+	}
+	defer tx.Rollback()
+
+	var (
+		content              string
+		createdAt, updatedAt int64
+	)
+	row := tx.QueryRowContext(ctx, getItemForUpdateQuery, arg.ItemId, arg.UserId, time.Now().Unix())
+	err = row.Scan(&content, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return item, ErrNotFound
+	}
+	if err != nil {
+		return item, err
+	}
+
+	if content == arg.Content {
+		tx.Rollback()
+		return ir.GetItemForUser(ctx, GetItemForUserParams{ItemId: arg.ItemId, UserId: arg.UserId})
+	}
+
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return item, err
+	}
+	// A revision is dated by when its content was written.
+	revisionCreatedAt := max(createdAt, updatedAt)
+	_, err = tx.ExecContext(ctx, createItemRevisionQuery, uuid.String(), revisionCreatedAt, arg.ItemId, content)
+	if err != nil {
+		return item, err
+	}
+
+	row = tx.QueryRowContext(ctx, updateItemContentQuery, arg.Content, time.Now().Unix(), arg.ItemId)
+	item, err = scanItem(row)
+	if err != nil {
+		return item, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Item{}, err
+	}
+
+	item.Attachments, err = ir.listAttachmentsForItem(ctx, item.Id)
+	return item, err
+}
+
+const listItemRevisionsForUserQuery = `
+SELECT r.id, r.created_at, r.item_id, r.content FROM item_revisions r
+INNER JOIN items i ON i.id = r.item_id
+WHERE r.item_id = $1 AND i.user_id = $2
+ORDER BY r.created_at DESC, r.rowid DESC;
+`
+
+type ListItemRevisionsForUserParams struct {
+	ItemId string
+	UserId string
+}
+
+// ListItemRevisionsForUser lists the previous contents of an item, newest
+// first.
+func (ir *ItemRepository) ListItemRevisionsForUser(
+	ctx context.Context,
+	arg ListItemRevisionsForUserParams,
+) ([]models.ItemRevision, error) {
+	revisions := []models.ItemRevision{}
+
+	rows, err := ir.db.QueryContext(ctx, listItemRevisionsForUserQuery, arg.ItemId, arg.UserId)
+	if err != nil {
+		return revisions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var revision models.ItemRevision
+		err := rows.Scan(&revision.Id, &revision.CreatedAt, &revision.ItemId, &revision.Content)
+		if err != nil {
+			return revisions, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+const getItemRevisionForUserQuery = `
+SELECT r.id, r.created_at, r.item_id, r.content FROM item_revisions r
+INNER JOIN items i ON i.id = r.item_id
+WHERE r.id = $1 AND r.item_id = $2 AND i.user_id = $3;
+`
+
+type GetItemRevisionForUserParams struct {
+	RevisionId string
+	ItemId     string
+	UserId     string
+}
+
+func (ir *ItemRepository) GetItemRevisionForUser(
+	ctx context.Context,
+	arg GetItemRevisionForUserParams,
+) (models.ItemRevision, error) {
+	var revision models.ItemRevision
+	row := ir.db.QueryRowContext(ctx, getItemRevisionForUserQuery, arg.RevisionId, arg.ItemId, arg.UserId)
+	err := row.Scan(&revision.Id, &revision.CreatedAt, &revision.ItemId, &revision.Content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return revision, ErrNotFound
+	}
+	return revision, err
+}
+
+const listAttachmentsForItemQuery = `
+SELECT id, created_at, item_id, file_name, mime_type, size FROM attachments
+WHERE item_id = $1
+ORDER BY file_name;
+`
+
+func (ir *ItemRepository) listAttachmentsForItem(ctx context.Context, itemId string) ([]models.Attachment, error) {
+	attachments := []models.Attachment{}
+
+	rows, err := ir.db.QueryContext(ctx, listAttachmentsForItemQuery, itemId)
+	if err != nil {
+		return attachments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return attachments, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+const listAttachmentsForItemsQuery = `
+SELECT id, created_at, item_id, file_name, mime_type, size FROM attachments
+WHERE item_id IN (%s)
+ORDER BY file_name;
+`
+
+// loadAttachments sets the attachment metadata of all given items with a
+// single query.
+func (ir *ItemRepository) loadAttachments(ctx context.Context, items []models.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(items))
+	args := make([]any, len(items))
+	for i, item := range items {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = item.Id
+	}
+	query := fmt.Sprintf(listAttachmentsForItemsQuery, strings.Join(placeholders, ", "))
+
+	rows, err := ir.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	attachments := map[string][]models.Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return err
+		}
+		attachments[attachment.ItemId] = append(attachments[attachment.ItemId], attachment)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range items {
+		items[i].Attachments = attachments[items[i].Id]
+		if items[i].Attachments == nil {
+			items[i].Attachments = []models.Attachment{}
+		}
+	}
+	return nil
+}
+
+func scanItem(row rowScanner) (models.Item, error) {
+	var item models.Item
+	err := row.Scan(
+		&item.Id,
+		&item.CreatedAt,
+		&item.Content,
+		&item.UserId,
+		&item.ExpiresAt,
+		&item.BurnAfterRead,
+		&item.UpdatedAt,
+		&item.WorkspaceId,
+	)
+	return item, err
+}
+
+// hideBurnAfterReadContent clears the content of burn after read items, as it
+// may only be revealed through GetItemForUser.
+func hideBurnAfterReadContent(item models.Item) models.Item {
+	if item.BurnAfterRead {
+		item.Content = ""
+	}
+	return item
+}
+
+func scanAttachment(rows *sql.Rows) (models.Attachment, error) {
+	var attachment models.Attachment
+	err := rows.Scan(
+		&attachment.Id,
+		&attachment.CreatedAt,
+		&attachment.ItemId,
+		&attachment.FileName,
+		&attachment.MimeType,
+		&attachment.Size,
+	)
+	return attachment, err
+}
+
+const getAttachmentForUserQuery = `
+SELECT a.id, a.created_at, a.item_id, a.file_name, a.mime_type, a.size, a.data FROM attachments a
+INNER JOIN items i ON i.id = a.item_id
+WHERE a.id = $1 AND a.item_id = $2 AND i.user_id = $3 AND (i.expires_at = 0 OR i.expires_at > $4);
+`
+
+type GetAttachmentForUserParams struct {
+	AttachmentId string
+	ItemId       string
+	UserId       string
+}
+
+func (ir *ItemRepository) GetAttachmentForUser(ctx context.Context, arg GetAttachmentForUserParams) (models.Attachment, error) {
+	row := ir.db.QueryRowContext(
+		ctx,
+		getAttachmentForUserQuery,
+		arg.AttachmentId,
+		arg.ItemId,
+		arg.UserId,
+		time.Now().Unix(),
+	)
+	var attachment models.Attachment
+	err := row.Scan(
+		&attachment.Id,
+		&attachment.CreatedAt,
+		&attachment.ItemId,
+		&attachment.FileName,
+		&attachment.MimeType,
+		&attachment.Size,
+		&attachment.Data,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return attachment, ErrNotFound
+	}
+	return attachment, err
 }
 
 const deleteItemForUserQuery = "DELETE FROM items WHERE id = $1 AND user_id = $2;"
@@ -119,3 +820,36 @@ func (ir *ItemRepository) DeleteItemForUser(ctx context.Context, arg DeleteUserI
 	_, err := ir.db.ExecContext(ctx, deleteItemForUserQuery, arg.ItemId, arg.UserId)
 	return err
 }
+
+const deleteExpiredItemsQuery = `
+DELETE FROM items WHERE expires_at > 0 AND expires_at <= $1
+RETURNING id, user_id, COALESCE(workspace_id, '');
+`
+
+// DeleteExpired deletes all expired items and returns their ids, owners and
+// workspaces.
+func (ir *ItemRepository) DeleteExpired(ctx context.Context) ([]models.Item, error) {
+	items := []models.Item{}
+
+	rows, err := ir.db.QueryContext(ctx, deleteExpiredItemsQuery, time.Now().Unix())
+	if err != nil {
+		return items, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.Item
+		if err := rows.Scan(&item.Id, &item.UserId, &item.WorkspaceId); err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const deleteAllItemsQuery = "DELETE FROM items;"
+
+func (ir *ItemRepository) DeleteAll(ctx context.Context) error {
+	_, err := ir.db.ExecContext(ctx, deleteAllItemsQuery)
+	return err
+}
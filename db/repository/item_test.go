@@ -0,0 +1,523 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+func TestItemRepository(t *testing.T) {
+	runWithTestStores(t, "ItemRepositoryTest.db", func(t *testing.T, stores testStores) {
+		itemRepo := stores.items
+		userRepo := stores.users
+
+		itemRepoTestFunc := func(f func(*testing.T, models.User)) func(*testing.T) {
+			return func(t *testing.T) {
+				t.Cleanup(func() {
+					userRepo.DeleteAll(context.Background())
+				})
+				testUser, err := userRepo.CreateUser(context.Background(), CreateUserParams{
+					UserName: "item_user",
+					Password: "pw",
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				f(t, testUser)
+			}
+		}
+
+		t.Run("CreateItem", itemRepoTestFunc(testCreateItem(itemRepo)))
+		t.Run("GetItemForUser", itemRepoTestFunc(testGetItemForUser(itemRepo)))
+		t.Run("GetAttachmentForUser", itemRepoTestFunc(testGetAttachmentForUser(itemRepo)))
+		t.Run("DeleteItemForUser", itemRepoTestFunc(testDeleteItemForUser(itemRepo)))
+		t.Run("SearchItemsForUser", itemRepoTestFunc(testSearchItemsForUser(itemRepo)))
+		t.Run("ListItemsForUser", itemRepoTestFunc(testListItemsForUser(itemRepo)))
+		t.Run("ExpiredItems", itemRepoTestFunc(testExpiredItems(itemRepo)))
+		t.Run("BurnAfterRead", itemRepoTestFunc(testBurnAfterRead(itemRepo)))
+		t.Run("UpdateItemForUser", itemRepoTestFunc(testUpdateItemForUser(itemRepo)))
+	})
+}
+
+func testCreateItem(repo ItemStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		params := CreateItemParams{
+			Content: "some content",
+			UserId:  testUser.Id,
+			Attachments: []CreateAttachmentParams{
+				{FileName: "a.txt", MimeType: "text/plain", Data: []byte("hello")},
+			},
+		}
+		item, err := repo.CreateItem(ctx, params)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if item.Content != params.Content || item.UserId != params.UserId {
+			t.Errorf("Item not stored correctly. Got: %v", item)
+			return
+		}
+		if len(item.Attachments) != 1 {
+			t.Errorf("Expected 1 attachment. Got: %d", len(item.Attachments))
+			return
+		}
+		attachment := item.Attachments[0]
+		if attachment.ItemId != item.Id ||
+			attachment.FileName != "a.txt" ||
+			attachment.MimeType != "text/plain" ||
+			attachment.Size != 5 {
+			t.Errorf("Attachment not stored correctly. Got: %v", attachment)
+		}
+
+		_, err = repo.CreateItem(ctx, CreateItemParams{Content: "no user"})
+		if err == nil {
+			t.Error("Expected error for missing user id")
+		}
+	}
+}
+
+func testGetItemForUser(repo ItemStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		created, err := repo.CreateItem(ctx, CreateItemParams{Content: "content", UserId: testUser.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		_, err = repo.GetItemForUser(ctx, GetItemForUserParams{ItemId: created.Id, UserId: "other"})
+		if !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound'. Got: ", err)
+			return
+		}
+
+		item, err := repo.GetItemForUser(ctx, GetItemForUserParams{ItemId: created.Id, UserId: testUser.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if item.Id != created.Id || item.Attachments == nil {
+			t.Errorf("Item did not match. Expected: %v. Got: %v", created, item)
+		}
+	}
+}
+
+func testGetAttachmentForUser(repo ItemStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		data := []byte{0x89, 0x50, 0x4e, 0x47}
+		item, err := repo.CreateItem(ctx, CreateItemParams{
+			UserId: testUser.Id,
+			Attachments: []CreateAttachmentParams{
+				{FileName: "image.png", MimeType: "image/png", Data: data},
+			},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		params := GetAttachmentForUserParams{
+			AttachmentId: item.Attachments[0].Id,
+			ItemId:       item.Id,
+			UserId:       "other",
+		}
+		_, err = repo.GetAttachmentForUser(ctx, params)
+		if !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound'. Got: ", err)
+			return
+		}
+
+		params.UserId = testUser.Id
+		attachment, err := repo.GetAttachmentForUser(ctx, params)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !bytes.Equal(attachment.Data, data) {
+			t.Errorf("Attachment data did not match. Expected: %v. Got: %v", data, attachment.Data)
+		}
+
+		page, err := repo.ListItemsForUser(ctx, ListItemsForUserParams{UserId: testUser.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		items := page.Items
+		if len(items) != 1 || len(items[0].Attachments) != 1 || items[0].Attachments[0].Data != nil {
+			t.Errorf("Expected listed item with attachment metadata only. Got: %v", items)
+		}
+	}
+}
+
+func testDeleteItemForUser(repo ItemStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		item, err := repo.CreateItem(ctx, CreateItemParams{
+			UserId: testUser.Id,
+			Attachments: []CreateAttachmentParams{
+				{FileName: "a.bin", MimeType: "application/octet-stream", Data: []byte{1, 2, 3}},
+			},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		err = repo.DeleteItemForUser(ctx, DeleteUserItemParams{ItemId: item.Id, UserId: testUser.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		_, err = repo.GetAttachmentForUser(ctx, GetAttachmentForUserParams{
+			AttachmentId: item.Attachments[0].Id,
+			ItemId:       item.Id,
+			UserId:       testUser.Id,
+		})
+		if !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound' for attachment of deleted item. Got: ", err)
+		}
+
+		sqlRepo, ok := repo.(*ItemRepository)
+		if !ok {
+			return
+		}
+		var count int
+		row := sqlRepo.db.QueryRowContext(ctx, "SELECT COUNT(1) FROM attachments WHERE item_id = $1;", item.Id)
+		if err := row.Scan(&count); err != nil {
+			t.Error(err)
+			return
+		}
+		if count != 0 {
+			t.Errorf("Attachments not deleted with item. Count: %d", count)
+		}
+	}
+}
+
+func testSearchItemsForUser(repo ItemStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		contents := []string{
+			"deploy the build to staging",
+			"build log: build failed twice",
+			"grocery list",
+		}
+		for _, content := range contents {
+			if _, err := repo.CreateItem(ctx, CreateItemParams{Content: content, UserId: testUser.Id}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+
+		results, err := repo.SearchItemsForUser(ctx, SearchItemsForUserParams{
+			UserId: testUser.Id,
+			Query:  `"bui`,
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(results) != 2 {
+			t.Errorf("Expected 2 results. Got: %d", len(results))
+			return
+		}
+		if results[0].Content != contents[1] {
+			t.Errorf("Expected item with most matches first. Got: %s", results[0].Content)
+		}
+		if results[0].Rank < results[1].Rank {
+			t.Errorf("Results not ordered by rank: %v", results)
+		}
+
+		limited, err := repo.SearchItemsForUser(ctx, SearchItemsForUserParams{
+			UserId: testUser.Id,
+			Query:  "bui",
+			Limit:  1,
+		})
+		if err != nil || len(limited) != 1 || limited[0].Id != results[0].Id {
+			t.Errorf("Expected best match within limit. Got: %v, %v", limited, err)
+		}
+
+		var highlighted []string
+		for _, fragment := range results[0].Snippet {
+			if fragment.Match {
+				highlighted = append(highlighted, fragment.Text)
+			}
+		}
+		// The full-text index highlights whole words, other stores the
+		// matched term.
+		if len(highlighted) != 2 || !strings.HasPrefix(highlighted[0], "bui") {
+			t.Errorf("Unexpected highlights: %v", highlighted)
+		}
+
+		first := results[0]
+		err = repo.DeleteItemForUser(ctx, DeleteUserItemParams{ItemId: first.Id, UserId: testUser.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		results, err = repo.SearchItemsForUser(ctx, SearchItemsForUserParams{
+			UserId: "other",
+			Query:  "build",
+		})
+		if err != nil || len(results) != 0 {
+			t.Errorf("Expected no results for other user. Got: %v, %v", results, err)
+		}
+		results, err = repo.SearchItemsForUser(ctx, SearchItemsForUserParams{
+			UserId: testUser.Id,
+			Query:  "build",
+		})
+		if err != nil || len(results) != 1 {
+			t.Errorf("Expected deleted item to be removed from index. Got: %v, %v", results, err)
+		}
+	}
+}
+
+func testListItemsForUser(repo ItemStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		created := map[string]bool{}
+		for i := range 7 {
+			item, err := repo.CreateItem(ctx, CreateItemParams{
+				Content: fmt.Sprintf("item %d", i),
+				UserId:  testUser.Id,
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			created[item.Id] = true
+		}
+
+		var (
+			listed  []models.Item
+			cursor  ItemCursor
+			pageCnt int
+		)
+		for {
+			page, err := repo.ListItemsForUser(ctx, ListItemsForUserParams{
+				UserId: testUser.Id,
+				Cursor: cursor,
+				Limit:  3,
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			pageCnt++
+			listed = append(listed, page.Items...)
+			if len(page.NextCursor) == 0 {
+				break
+			}
+			cursor, err = ParseItemCursor(page.NextCursor)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+
+		if pageCnt != 3 {
+			t.Errorf("Expected 3 pages. Got: %d", pageCnt)
+		}
+		if len(listed) != len(created) {
+			t.Errorf("Expected %d items. Got: %d", len(created), len(listed))
+			return
+		}
+		for i, item := range listed {
+			if !created[item.Id] {
+				t.Errorf("Unexpected or duplicate item: %v", item)
+			}
+			delete(created, item.Id)
+			if i > 0 {
+				prev := listed[i-1]
+				if prev.CreatedAt < item.CreatedAt ||
+					(prev.CreatedAt == item.CreatedAt && prev.Id < item.Id) {
+					t.Errorf("Items not ordered. %v before %v", prev, item)
+				}
+			}
+		}
+
+		if _, err := ParseItemCursor("not a cursor"); !errors.Is(err, ErrInvalidCursor) {
+			t.Error("Expected 'ErrInvalidCursor'. Got: ", err)
+		}
+	}
+}
+
+func testExpiredItems(repo ItemStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		expired, err := repo.CreateItem(ctx, CreateItemParams{
+			Content:   "expired",
+			UserId:    testUser.Id,
+			ExpiresAt: time.Now().Add(-time.Second),
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		valid, err := repo.CreateItem(ctx, CreateItemParams{
+			Content:   "valid",
+			UserId:    testUser.Id,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		_, err = repo.GetItemForUser(ctx, GetItemForUserParams{ItemId: expired.Id, UserId: testUser.Id})
+		if !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound'. Got: ", err)
+		}
+
+		page, err := repo.ListItemsForUser(ctx, ListItemsForUserParams{UserId: testUser.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(page.Items) != 1 || page.Items[0].Id != valid.Id || page.Items[0].ExpiresAt != valid.ExpiresAt {
+			t.Errorf("Expected only the valid item. Got: %v", page.Items)
+		}
+
+		deleted, err := repo.DeleteExpired(ctx)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(deleted) != 1 || deleted[0].Id != expired.Id || deleted[0].UserId != testUser.Id {
+			t.Errorf("Expected only the expired item to be deleted. Got: %v", deleted)
+		}
+	}
+}
+
+func testBurnAfterRead(repo ItemStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		created, err := repo.CreateItem(ctx, CreateItemParams{
+			Content:       "secret",
+			UserId:        testUser.Id,
+			BurnAfterRead: true,
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		page, err := repo.ListItemsForUser(ctx, ListItemsForUserParams{UserId: testUser.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(page.Items) != 1 || !page.Items[0].BurnAfterRead || len(page.Items[0].Content) > 0 {
+			t.Errorf("Expected burn after read item without content. Got: %v", page.Items)
+		}
+
+		results, err := repo.SearchItemsForUser(ctx, SearchItemsForUserParams{UserId: testUser.Id, Query: "secret"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(results) > 0 {
+			t.Errorf("Expected burn after read item not to be searchable. Got: %v", results)
+		}
+
+		params := GetItemForUserParams{ItemId: created.Id, UserId: testUser.Id}
+		item, err := repo.GetItemForUser(ctx, params)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if item.Content != "secret" {
+			t.Errorf("Expected content 'secret'. Got: %s", item.Content)
+		}
+
+		_, err = repo.GetItemForUser(ctx, params)
+		if !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound' after reading. Got: ", err)
+		}
+	}
+}
+
+func testUpdateItemForUser(repo ItemStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		created, err := repo.CreateItem(ctx, CreateItemParams{Content: "first", UserId: testUser.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		_, err = repo.UpdateItemForUser(ctx, UpdateItemForUserParams{ItemId: created.Id, UserId: "other", Content: "x"})
+		if !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound'. Got: ", err)
+			return
+		}
+
+		for _, content := range []string{"second", "third", "third"} {
+			item, err := repo.UpdateItemForUser(ctx, UpdateItemForUserParams{
+				ItemId:  created.Id,
+				UserId:  testUser.Id,
+				Content: content,
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if item.Content != content || item.UpdatedAt == 0 || item.Attachments == nil {
+				t.Errorf("Item not updated correctly. Got: %v", item)
+			}
+		}
+
+		revisions, err := repo.ListItemRevisionsForUser(ctx, ListItemRevisionsForUserParams{
+			ItemId: created.Id,
+			UserId: testUser.Id,
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(revisions) != 2 || revisions[0].Content != "second" || revisions[1].Content != "first" {
+			t.Errorf("Expected revisions 'second' and 'first'. Got: %v", revisions)
+			return
+		}
+
+		revision, err := repo.GetItemRevisionForUser(ctx, GetItemRevisionForUserParams{
+			RevisionId: revisions[1].Id,
+			ItemId:     created.Id,
+			UserId:     testUser.Id,
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if revision != revisions[1] {
+			t.Errorf("Revision did not match. Expected: %v. Got: %v", revisions[1], revision)
+		}
+
+		results, err := repo.SearchItemsForUser(ctx, SearchItemsForUserParams{UserId: testUser.Id, Query: "third"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(results) != 1 || results[0].Id != created.Id {
+			t.Errorf("Expected updated item to be searchable. Got: %v", results)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+type GetLoginAttemptParams struct {
+	Scope models.LoginAttemptScope
+	Key   string
+}
+
+const getLoginAttemptQuery = `
+SELECT scope, key, failures, last_failed_at, locked_until FROM login_attempts
+WHERE scope = $1 AND key = $2;
+`
+
+func (lr *LoginAttemptRepository) GetLoginAttempt(
+	ctx context.Context,
+	arg GetLoginAttemptParams,
+) (models.LoginAttempt, error) {
+	row := lr.db.QueryRowContext(ctx, getLoginAttemptQuery, arg.Scope, arg.Key)
+	attempt, err := scanLoginAttempt(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return attempt, ErrNotFound
+	}
+	return attempt, err
+}
+
+const recordLoginFailureQuery = `
+INSERT INTO login_attempts (scope, key, failures, last_failed_at, locked_until)
+VALUES ($1, $2, 1, $3, 0)
+ON CONFLICT (scope, key) DO UPDATE SET
+	failures = CASE WHEN login_attempts.last_failed_at <= $4 THEN 1 ELSE login_attempts.failures + 1 END,
+	locked_until = CASE WHEN login_attempts.last_failed_at <= $4 THEN 0 ELSE login_attempts.locked_until END,
+	last_failed_at = excluded.last_failed_at
+RETURNING scope, key, failures, last_failed_at, locked_until;
+`
+
+type RecordLoginFailureParams struct {
+	Scope    models.LoginAttemptScope
+	Key      string
+	FailedAt time.Time
+	// Failures of attempts that last failed at or before ForgetBefore are
+	// forgotten and counting starts over.
+	ForgetBefore time.Time
+}
+
+// RecordLoginFailure counts a failed attempt and returns the attempt with the
+// new count. Counting happens in the database, so concurrent failures are all
+// counted.
+func (lr *LoginAttemptRepository) RecordLoginFailure(
+	ctx context.Context,
+	arg RecordLoginFailureParams,
+) (models.LoginAttempt, error) {
+	row := lr.db.QueryRowContext(
+		ctx,
+		recordLoginFailureQuery,
+		arg.Scope,
+		arg.Key,
+		arg.FailedAt.Unix(),
+		arg.ForgetBefore.Unix(),
+	)
+	return scanLoginAttempt(row)
+}
+
+const lockLoginAttemptQuery = `
+UPDATE login_attempts
+SET locked_until = CASE WHEN locked_until < $1 THEN $1 ELSE locked_until END
+WHERE scope = $2 AND key = $3;
+`
+
+type LockLoginAttemptParams struct {
+	Scope       models.LoginAttemptScope
+	Key         string
+	LockedUntil time.Time
+}
+
+// LockLoginAttempt locks a key until the given time. It never shortens an
+// existing lock.
+func (lr *LoginAttemptRepository) LockLoginAttempt(ctx context.Context, arg LockLoginAttemptParams) error {
+	_, err := lr.db.ExecContext(ctx, lockLoginAttemptQuery, arg.LockedUntil.Unix(), arg.Scope, arg.Key)
+	return err
+}
+
+const deleteLoginAttemptQuery = "DELETE FROM login_attempts WHERE scope = $1 AND key = $2;"
+
+func (lr *LoginAttemptRepository) DeleteLoginAttempt(ctx context.Context, arg GetLoginAttemptParams) error {
+	_, err := lr.db.ExecContext(ctx, deleteLoginAttemptQuery, arg.Scope, arg.Key)
+	return err
+}
+
+const listLockedQuery = `
+SELECT scope, key, failures, last_failed_at, locked_until FROM login_attempts
+WHERE scope = $1 AND locked_until > $2
+ORDER BY locked_until DESC;
+`
+
+// ListLocked lists the keys of a scope that are currently locked.
+func (lr *LoginAttemptRepository) ListLocked(
+	ctx context.Context,
+	scope models.LoginAttemptScope,
+) ([]models.LoginAttempt, error) {
+	attempts := []models.LoginAttempt{}
+
+	rows, err := lr.db.QueryContext(ctx, listLockedQuery, scope, time.Now().Unix())
+	if err != nil {
+		return attempts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		attempt, err := scanLoginAttempt(rows)
+		if err != nil {
+			return attempts, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+const deleteStaleLoginAttemptsQuery = `
+DELETE FROM login_attempts
+WHERE last_failed_at <= $1 AND locked_until <= $2;
+`
+
+// DeleteStale deletes attempts that are not locked and have not failed since
+// failedBefore.
+func (lr *LoginAttemptRepository) DeleteStale(ctx context.Context, failedBefore time.Time) error {
+	_, err := lr.db.ExecContext(ctx, deleteStaleLoginAttemptsQuery, failedBefore.Unix(), time.Now().Unix())
+	return err
+}
+
+func scanLoginAttempt(row rowScanner) (models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := row.Scan(
+		&attempt.Scope,
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.LastFailedAt,
+		&attempt.LockedUntil,
+	)
+	return attempt, err
+}
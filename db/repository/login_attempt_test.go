@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+func TestLoginAttemptRepository(t *testing.T) {
+	runWithTestStores(t, "LoginAttemptRepositoryTest.db", func(t *testing.T, stores testStores) {
+		repo := stores.loginAttempts
+
+		loginAttemptTestFunc := func(
+			f func(*testing.T, LoginAttemptStore, GetLoginAttemptParams),
+		) func(*testing.T) {
+			return func(t *testing.T) {
+				key := GetLoginAttemptParams{Scope: models.UserNameLoginAttemptScope, Key: t.Name()}
+				t.Cleanup(func() {
+					repo.DeleteLoginAttempt(context.Background(), key)
+				})
+				f(t, repo, key)
+			}
+		}
+
+		t.Run("RecordLoginFailure", loginAttemptTestFunc(testRecordLoginFailure))
+		t.Run("LockLoginAttempt", loginAttemptTestFunc(testLockLoginAttempt))
+		t.Run("DeleteStale", loginAttemptTestFunc(testDeleteStaleLoginAttempts))
+		t.Run("ConcurrentFailures", loginAttemptTestFunc(testConcurrentLoginFailures))
+	})
+}
+
+func testRecordLoginFailure(t *testing.T, repo LoginAttemptStore, key GetLoginAttemptParams) {
+	ctx := context.Background()
+	now := time.Now()
+
+	record := func(failedAt time.Time, forgetBefore time.Time) models.LoginAttempt {
+		t.Helper()
+		attempt, err := repo.RecordLoginFailure(ctx, RecordLoginFailureParams{
+			Scope:        key.Scope,
+			Key:          key.Key,
+			FailedAt:     failedAt,
+			ForgetBefore: forgetBefore,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return attempt
+	}
+
+	record(now.Add(-time.Minute), now.Add(-time.Hour))
+	if attempt := record(now, now.Add(-time.Hour)); attempt.Failures != 2 {
+		t.Errorf("Expected 2 failures. Got: %d", attempt.Failures)
+	}
+	attempt := record(now.Add(time.Minute), now)
+	if attempt.Failures != 1 || attempt.LastFailedAt != now.Add(time.Minute).Unix() {
+		t.Errorf("Expected failures to start over. Got: %+v", attempt)
+	}
+
+	if got, err := repo.GetLoginAttempt(ctx, key); err != nil || got != attempt {
+		t.Errorf("Expected %+v. Got: %+v %v", attempt, got, err)
+	}
+}
+
+func testLockLoginAttempt(t *testing.T, repo LoginAttemptStore, key GetLoginAttemptParams) {
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := repo.RecordLoginFailure(ctx, RecordLoginFailureParams{
+		Scope:    key.Scope,
+		Key:      key.Key,
+		FailedAt: now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock := func(lockedUntil time.Time) {
+		t.Helper()
+		err := repo.LockLoginAttempt(ctx, LockLoginAttemptParams{
+			Scope:       key.Scope,
+			Key:         key.Key,
+			LockedUntil: lockedUntil,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	lock(now.Add(time.Hour))
+	lock(now.Add(time.Minute))
+
+	attempt, err := repo.GetLoginAttempt(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempt.LockedUntil != now.Add(time.Hour).Unix() {
+		t.Errorf("Expected lock not to be shortened. Got: %d", attempt.LockedUntil)
+	}
+
+	locked, err := repo.ListLocked(ctx, key.Scope)
+	if err != nil || len(locked) != 1 || locked[0].Key != key.Key {
+		t.Errorf("Expected locked attempt. Got: %v %v", locked, err)
+	}
+	locked, err = repo.ListLocked(ctx, models.IpAddressLoginAttemptScope)
+	if err != nil || len(locked) != 0 {
+		t.Errorf("Expected no locked attempt for other scope. Got: %v %v", locked, err)
+	}
+}
+
+func testDeleteStaleLoginAttempts(t *testing.T, repo LoginAttemptStore, key GetLoginAttemptParams) {
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := repo.RecordLoginFailure(ctx, RecordLoginFailureParams{
+		Scope:    key.Scope,
+		Key:      key.Key,
+		FailedAt: now.Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.LockLoginAttempt(ctx, LockLoginAttemptParams{
+		Scope:       key.Scope,
+		Key:         key.Key,
+		LockedUntil: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.DeleteStale(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetLoginAttempt(ctx, key); err != nil {
+		t.Error("Expected locked attempt to be kept. Got: ", err)
+	}
+
+	if err := repo.DeleteLoginAttempt(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.RecordLoginFailure(ctx, RecordLoginFailureParams{
+		Scope:    key.Scope,
+		Key:      key.Key,
+		FailedAt: now.Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteStale(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetLoginAttempt(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected stale attempt to be deleted. Got: ", err)
+	}
+}
+
+func testConcurrentLoginFailures(t *testing.T, repo LoginAttemptStore, key GetLoginAttemptParams) {
+	ctx := context.Background()
+	// Enough failures to reliably interleave reading and writing the count.
+	failures := 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, failures)
+	for range failures {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.RecordLoginFailure(ctx, RecordLoginFailureParams{
+				Scope:    key.Scope,
+				Key:      key.Key,
+				FailedAt: time.Now(),
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	attempt, err := repo.GetLoginAttempt(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Failures != failures {
+		t.Errorf("Expected %d failures. Got: %d", failures, attempt.Failures)
+	}
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+// Errors of the memory repositories, which stand in for the constraints of
+// the database schema.
+var (
+	errUniqueConstraint     = errors.New("UNIQUE constraint failed")
+	errForeignKeyConstraint = errors.New("FOREIGN KEY constraint failed")
+)
+
+// MemoryDB holds the data of the memory repositories, which keep everything
+// in memory to test services and handlers without a database file.
+// Repositories created with the same MemoryDB see each other's data, so
+// deleting a user also deletes everything that belongs to them, like with
+// the foreign keys of the database. It is safe for concurrent use.
+type MemoryDB struct {
+	mu       sync.Mutex
+	users    map[string]models.User
+	sessions map[string]models.Session
+	items    map[string]models.Item
+	// attachments are keyed by item id and kept with their data.
+	attachments map[string][]models.Attachment
+	// revisions are keyed by item id, oldest first.
+	revisions     map[string][]models.ItemRevision
+	apiTokens     map[string]models.ApiToken
+	loginAttempts map[GetLoginAttemptParams]models.LoginAttempt
+	// recoveryCodes are keyed by user id and hold the code hashes.
+	recoveryCodes map[string]map[string]bool
+	// loginChallenges are keyed by token hash.
+	loginChallenges map[string]models.LoginChallenge
+	// workspaces are stored without the role of a user.
+	workspaces map[string]models.Workspace
+	// workspaceMembers are keyed by workspace id and user id and stored
+	// without user name.
+	workspaceMembers map[string]map[string]models.WorkspaceMember
+	shares           map[string]models.Share
+	identities       map[GetIdentityParams]models.Identity
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		users:            map[string]models.User{},
+		sessions:         map[string]models.Session{},
+		items:            map[string]models.Item{},
+		attachments:      map[string][]models.Attachment{},
+		revisions:        map[string][]models.ItemRevision{},
+		apiTokens:        map[string]models.ApiToken{},
+		loginAttempts:    map[GetLoginAttemptParams]models.LoginAttempt{},
+		recoveryCodes:    map[string]map[string]bool{},
+		loginChallenges:  map[string]models.LoginChallenge{},
+		workspaces:       map[string]models.Workspace{},
+		workspaceMembers: map[string]map[string]models.WorkspaceMember{},
+		shares:           map[string]models.Share{},
+		identities:       map[GetIdentityParams]models.Identity{},
+	}
+}
+
+// deleteUser deletes a user with everything that belongs to them. The lock
+// must be held.
+func (m *MemoryDB) deleteUser(userId string) {
+	delete(m.users, userId)
+	for tokenHash, session := range m.sessions {
+		if session.UserId == userId {
+			delete(m.sessions, tokenHash)
+		}
+	}
+	for itemId, item := range m.items {
+		if item.UserId == userId {
+			m.deleteItem(itemId)
+		}
+	}
+	for id, token := range m.apiTokens {
+		if token.UserId == userId {
+			delete(m.apiTokens, id)
+		}
+	}
+	delete(m.recoveryCodes, userId)
+	for tokenHash, challenge := range m.loginChallenges {
+		if challenge.UserId == userId {
+			delete(m.loginChallenges, tokenHash)
+		}
+	}
+	for id, workspace := range m.workspaces {
+		if workspace.OwnerId == userId {
+			m.deleteWorkspace(id)
+		}
+	}
+	for _, members := range m.workspaceMembers {
+		delete(members, userId)
+	}
+	for id, share := range m.shares {
+		if share.UserId == userId {
+			delete(m.shares, id)
+		}
+	}
+	for key, identity := range m.identities {
+		if identity.UserId == userId {
+			delete(m.identities, key)
+		}
+	}
+}
+
+// deleteItem deletes an item with its attachments, revisions and shares. The
+// lock must be held.
+func (m *MemoryDB) deleteItem(itemId string) {
+	delete(m.items, itemId)
+	delete(m.attachments, itemId)
+	delete(m.revisions, itemId)
+	for id, share := range m.shares {
+		if share.ItemId == itemId {
+			delete(m.shares, id)
+		}
+	}
+}
+
+// deleteWorkspace deletes a workspace with its members and items. The lock
+// must be held.
+func (m *MemoryDB) deleteWorkspace(workspaceId string) {
+	delete(m.workspaces, workspaceId)
+	delete(m.workspaceMembers, workspaceId)
+	for itemId, item := range m.items {
+		if item.WorkspaceId == workspaceId {
+			m.deleteItem(itemId)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/michaelhass/cpaw/models"
+)
+
+type MemoryApiTokenRepository struct {
+	db *MemoryDB
+}
+
+func NewMemoryApiTokenRepository(db *MemoryDB) *MemoryApiTokenRepository {
+	return &MemoryApiTokenRepository{db: db}
+}
+
+func (tr *MemoryApiTokenRepository) CreateApiToken(ctx context.Context, arg CreateApiTokenParams) (models.ApiToken, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return models.ApiToken{}, err
+	}
+
+	var expiresAt int64
+	if !arg.ExpiresAt.IsZero() {
+		expiresAt = arg.ExpiresAt.Unix()
+	}
+
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	if _, ok := tr.db.users[arg.UserId]; !ok {
+		return models.ApiToken{}, errForeignKeyConstraint
+	}
+	if _, ok := tr.tokenByHash(arg.TokenHash); ok {
+		return models.ApiToken{}, errUniqueConstraint
+	}
+	token := models.ApiToken{
+		Id:        id.String(),
+		CreatedAt: time.Now().Unix(),
+		UserId:    arg.UserId,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    splitScopes(joinScopes(arg.Scopes)),
+		ExpiresAt: expiresAt,
+	}
+	tr.db.apiTokens[token.Id] = token
+	return token, nil
+}
+
+func (tr *MemoryApiTokenRepository) GetApiTokenByHash(ctx context.Context, tokenHash string) (models.ApiToken, error) {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	token, ok := tr.tokenByHash(tokenHash)
+	if !ok {
+		return models.ApiToken{}, ErrNotFound
+	}
+	return token, nil
+}
+
+// ListApiTokensForUser lists the tokens of a user, newest first.
+func (tr *MemoryApiTokenRepository) ListApiTokensForUser(ctx context.Context, userId string) ([]models.ApiToken, error) {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	tokens := []models.ApiToken{}
+	for _, token := range tr.db.apiTokens {
+		if token.UserId == userId {
+			tokens = append(tokens, token)
+		}
+	}
+	slices.SortFunc(tokens, func(a, b models.ApiToken) int {
+		if byCreation := cmp.Compare(b.CreatedAt, a.CreatedAt); byCreation != 0 {
+			return byCreation
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return tokens, nil
+}
+
+func (tr *MemoryApiTokenRepository) UpdateLastUsed(ctx context.Context, tokenId string, lastUsedAt time.Time) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	if token, ok := tr.db.apiTokens[tokenId]; ok {
+		token.LastUsedAt = lastUsedAt.Unix()
+		tr.db.apiTokens[tokenId] = token
+	}
+	return nil
+}
+
+func (tr *MemoryApiTokenRepository) DeleteApiTokenForUser(ctx context.Context, arg DeleteApiTokenForUserParams) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	token, ok := tr.db.apiTokens[arg.TokenId]
+	if !ok || token.UserId != arg.UserId {
+		return ErrNotFound
+	}
+	delete(tr.db.apiTokens, arg.TokenId)
+	return nil
+}
+
+// tokenByHash must be called with the lock held.
+func (tr *MemoryApiTokenRepository) tokenByHash(tokenHash string) (models.ApiToken, bool) {
+	for _, token := range tr.db.apiTokens {
+		if token.TokenHash == tokenHash {
+			return token, true
+		}
+	}
+	return models.ApiToken{}, false
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+type MemoryIdentityRepository struct {
+	db *MemoryDB
+}
+
+func NewMemoryIdentityRepository(db *MemoryDB) *MemoryIdentityRepository {
+	return &MemoryIdentityRepository{db: db}
+}
+
+func (ir *MemoryIdentityRepository) CreateIdentity(
+	ctx context.Context,
+	arg CreateIdentityParams,
+) (models.Identity, error) {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	if _, ok := ir.db.users[arg.UserId]; !ok {
+		return models.Identity{}, errForeignKeyConstraint
+	}
+	key := GetIdentityParams{Issuer: arg.Issuer, Subject: arg.Subject}
+	if _, ok := ir.db.identities[key]; ok {
+		return models.Identity{}, errUniqueConstraint
+	}
+	identity := models.Identity{
+		Issuer:    arg.Issuer,
+		Subject:   arg.Subject,
+		UserId:    arg.UserId,
+		CreatedAt: time.Now().Unix(),
+	}
+	ir.db.identities[key] = identity
+	return identity, nil
+}
+
+func (ir *MemoryIdentityRepository) GetIdentity(ctx context.Context, arg GetIdentityParams) (models.Identity, error) {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	identity, ok := ir.db.identities[arg]
+	if !ok {
+		return models.Identity{}, ErrNotFound
+	}
+	return identity, nil
+}
@@ -0,0 +1,408 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/michaelhass/cpaw/models"
+)
+
+// MemoryItemRepository searches items like ItemRepository on Postgres, so
+// terms also match within words.
+type MemoryItemRepository struct {
+	db *MemoryDB
+}
+
+func NewMemoryItemRepository(db *MemoryDB) *MemoryItemRepository {
+	return &MemoryItemRepository{db: db}
+}
+
+func (ir *MemoryItemRepository) CreateItem(ctx context.Context, arg CreateItemParams) (models.Item, error) {
+	createdAt := time.Now().Unix()
+	if !arg.CreatedAt.IsZero() {
+		createdAt = arg.CreatedAt.Unix()
+	}
+	var expiresAt int64
+	if !arg.ExpiresAt.IsZero() {
+		expiresAt = arg.ExpiresAt.Unix()
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return models.Item{}, err
+	}
+	item := models.Item{
+		Id:            id.String(),
+		CreatedAt:     createdAt,
+		Content:       arg.Content,
+		UserId:        arg.UserId,
+		ExpiresAt:     expiresAt,
+		BurnAfterRead: arg.BurnAfterRead,
+		WorkspaceId:   arg.WorkspaceId,
+	}
+
+	attachments := []models.Attachment{}
+	for _, attachmentArg := range arg.Attachments {
+		attachmentId, err := uuid.NewRandom()
+		if err != nil {
+			return models.Item{}, err
+		}
+		attachments = append(attachments, models.Attachment{
+			Id:        attachmentId.String(),
+			CreatedAt: createdAt,
+			ItemId:    item.Id,
+			FileName:  attachmentArg.FileName,
+			MimeType:  attachmentArg.MimeType,
+			Size:      int64(len(attachmentArg.Data)),
+			Data:      slices.Clone(attachmentArg.Data),
+		})
+	}
+	// Created items list their attachments in the given order, later reads
+	// by file name.
+	item.Attachments = []models.Attachment{}
+	for _, attachment := range attachments {
+		attachment.Data = nil
+		item.Attachments = append(item.Attachments, attachment)
+	}
+	slices.SortStableFunc(attachments, func(a, b models.Attachment) int {
+		return cmp.Compare(a.FileName, b.FileName)
+	})
+
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	if _, ok := ir.db.users[item.UserId]; !ok {
+		return models.Item{}, errForeignKeyConstraint
+	}
+	if _, ok := ir.db.workspaces[item.WorkspaceId]; len(item.WorkspaceId) > 0 && !ok {
+		return models.Item{}, errForeignKeyConstraint
+	}
+	stored := item
+	stored.Attachments = nil
+	ir.db.items[item.Id] = stored
+	ir.db.attachments[item.Id] = attachments
+
+	return item, nil
+}
+
+func (ir *MemoryItemRepository) GetItemById(ctx context.Context, itemId string) (models.Item, error) {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	item, ok := ir.db.items[itemId]
+	if !ok || isExpired(item, time.Now().Unix()) {
+		return models.Item{}, ErrNotFound
+	}
+	return ir.withAttachments(item), nil
+}
+
+// GetItemForUser returns an unexpired item. Burn after read items are deleted
+// by reading them.
+func (ir *MemoryItemRepository) GetItemForUser(ctx context.Context, arg GetItemForUserParams) (models.Item, error) {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	item, ok := ir.db.items[arg.ItemId]
+	if !ok || item.UserId != arg.UserId || isExpired(item, time.Now().Unix()) {
+		return models.Item{}, ErrNotFound
+	}
+	item = ir.withAttachments(item)
+	if item.BurnAfterRead {
+		ir.db.deleteItem(item.Id)
+	}
+	return item, nil
+}
+
+func (ir *MemoryItemRepository) ListItemsForUser(ctx context.Context, arg ListItemsForUserParams) (models.ItemPage, error) {
+	page := models.ItemPage{Items: []models.Item{}}
+
+	limit := arg.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	createdAt, id := arg.Cursor.queryArgs()
+
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	now := time.Now().Unix()
+	for _, item := range ir.db.items {
+		if !inItemScope(item, arg.UserId, arg.WorkspaceId) || isExpired(item, now) {
+			continue
+		}
+		if item.CreatedAt > createdAt || (item.CreatedAt == createdAt && item.Id >= id) {
+			continue
+		}
+		page.Items = append(page.Items, item)
+	}
+	slices.SortFunc(page.Items, func(a, b models.Item) int {
+		return -compareItems(a, b)
+	})
+
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.NextCursor = newItemCursor(page.Items[limit-1]).String()
+	}
+	for i, item := range page.Items {
+		page.Items[i] = ir.withAttachments(hideBurnAfterReadContent(item))
+	}
+	return page, nil
+}
+
+// ListItemsForUserCreatedSince lists the oldest personal items created at or
+// after the given time first.
+func (ir *MemoryItemRepository) ListItemsForUserCreatedSince(
+	ctx context.Context,
+	arg ListItemsForUserCreatedSinceParams,
+) ([]models.Item, error) {
+	items := []models.Item{}
+
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	now := time.Now().Unix()
+	for _, item := range ir.db.items {
+		if inItemScope(item, arg.UserId, "") && item.CreatedAt >= arg.CreatedAt && !isExpired(item, now) {
+			items = append(items, item)
+		}
+	}
+	slices.SortFunc(items, compareItems)
+
+	if len(items) > arg.Limit {
+		items = items[:max(arg.Limit, 0)]
+	}
+	for i, item := range items {
+		items[i] = ir.withAttachments(hideBurnAfterReadContent(item))
+	}
+	return items, nil
+}
+
+func (ir *MemoryItemRepository) SearchItemsForUser(
+	ctx context.Context,
+	arg SearchItemsForUserParams,
+) ([]models.ItemSearchResult, error) {
+	results := []models.ItemSearchResult{}
+
+	terms := newSearchTerms(arg.Query)
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	now := time.Now().Unix()
+	for _, item := range ir.db.items {
+		if !inItemScope(item, arg.UserId, arg.WorkspaceId) || item.BurnAfterRead || isExpired(item, now) {
+			continue
+		}
+		if !containsSearchTerms(item.Content, terms) {
+			continue
+		}
+		result := models.ItemSearchResult{Item: item}
+		result.Snippet, result.Rank = matchSearchTerms(item.Content, terms)
+		results = append(results, result)
+	}
+
+	// Map iteration is random, so ties are broken like in the database.
+	slices.SortFunc(results, func(a, b models.ItemSearchResult) int {
+		return -compareItems(a.Item, b.Item)
+	})
+	results = sortSearchResults(results, arg.Limit)
+	for i := range results {
+		results[i].Item = ir.withAttachments(results[i].Item)
+	}
+	return results, nil
+}
+
+// UpdateItemForUser replaces the content of an item and keeps the previous
+// content as a revision. Burn after read items can't be updated.
+func (ir *MemoryItemRepository) UpdateItemForUser(ctx context.Context, arg UpdateItemForUserParams) (models.Item, error) {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	now := time.Now().Unix()
+	item, ok := ir.db.items[arg.ItemId]
+	if !ok || item.UserId != arg.UserId || item.BurnAfterRead || isExpired(item, now) {
+		return models.Item{}, ErrNotFound
+	}
+	if item.Content == arg.Content {
+		return ir.withAttachments(item), nil
+	}
+
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return models.Item{}, err
+	}
+	// A revision is dated by when its content was written.
+	ir.db.revisions[item.Id] = append(ir.db.revisions[item.Id], models.ItemRevision{
+		Id:        uuid.String(),
+		CreatedAt: max(item.CreatedAt, item.UpdatedAt),
+		ItemId:    item.Id,
+		Content:   item.Content,
+	})
+
+	item.Content = arg.Content
+	item.UpdatedAt = now
+	ir.db.items[item.Id] = item
+	return ir.withAttachments(item), nil
+}
+
+// ListItemRevisionsForUser lists the previous contents of an item, newest
+// first.
+func (ir *MemoryItemRepository) ListItemRevisionsForUser(
+	ctx context.Context,
+	arg ListItemRevisionsForUserParams,
+) ([]models.ItemRevision, error) {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	revisions := []models.ItemRevision{}
+	if item, ok := ir.db.items[arg.ItemId]; !ok || item.UserId != arg.UserId {
+		return revisions, nil
+	}
+	revisions = append(revisions, ir.db.revisions[arg.ItemId]...)
+	slices.Reverse(revisions)
+	slices.SortStableFunc(revisions, func(a, b models.ItemRevision) int {
+		return cmp.Compare(b.CreatedAt, a.CreatedAt)
+	})
+	return revisions, nil
+}
+
+func (ir *MemoryItemRepository) GetItemRevisionForUser(
+	ctx context.Context,
+	arg GetItemRevisionForUserParams,
+) (models.ItemRevision, error) {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	if item, ok := ir.db.items[arg.ItemId]; !ok || item.UserId != arg.UserId {
+		return models.ItemRevision{}, ErrNotFound
+	}
+	for _, revision := range ir.db.revisions[arg.ItemId] {
+		if revision.Id == arg.RevisionId {
+			return revision, nil
+		}
+	}
+	return models.ItemRevision{}, ErrNotFound
+}
+
+func (ir *MemoryItemRepository) GetAttachmentForUser(
+	ctx context.Context,
+	arg GetAttachmentForUserParams,
+) (models.Attachment, error) {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	item, ok := ir.db.items[arg.ItemId]
+	if !ok || item.UserId != arg.UserId || isExpired(item, time.Now().Unix()) {
+		return models.Attachment{}, ErrNotFound
+	}
+	for _, attachment := range ir.db.attachments[arg.ItemId] {
+		if attachment.Id == arg.AttachmentId {
+			attachment.Data = slices.Clone(attachment.Data)
+			return attachment, nil
+		}
+	}
+	return models.Attachment{}, ErrNotFound
+}
+
+func (ir *MemoryItemRepository) DeleteItemForUser(ctx context.Context, arg DeleteUserItemParams) error {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	if item, ok := ir.db.items[arg.ItemId]; ok && item.UserId == arg.UserId {
+		ir.db.deleteItem(item.Id)
+	}
+	return nil
+}
+
+// DeleteExpired deletes all expired items and returns their ids, owners and
+// workspaces.
+func (ir *MemoryItemRepository) DeleteExpired(ctx context.Context) ([]models.Item, error) {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+
+	items := []models.Item{}
+	now := time.Now().Unix()
+	for _, item := range ir.db.items {
+		if isExpired(item, now) {
+			ir.db.deleteItem(item.Id)
+			items = append(items, models.Item{Id: item.Id, UserId: item.UserId, WorkspaceId: item.WorkspaceId})
+		}
+	}
+	return items, nil
+}
+
+func (ir *MemoryItemRepository) DeleteAll(ctx context.Context) error {
+	ir.db.mu.Lock()
+	defer ir.db.mu.Unlock()
+	for id := range ir.db.items {
+		ir.db.deleteItem(id)
+	}
+	return nil
+}
+
+// withAttachments sets the attachment metadata of an item. The lock must be
+// held.
+func (ir *MemoryItemRepository) withAttachments(item models.Item) models.Item {
+	item.Attachments = []models.Attachment{}
+	for _, attachment := range ir.db.attachments[item.Id] {
+		attachment.Data = nil
+		item.Attachments = append(item.Attachments, attachment)
+	}
+	return item
+}
+
+// inItemScope reports whether an item is a personal item of the user or, if
+// workspaceId is set, an item of the workspace.
+func inItemScope(item models.Item, userId string, workspaceId string) bool {
+	if len(workspaceId) > 0 {
+		return item.WorkspaceId == workspaceId
+	}
+	return len(item.WorkspaceId) == 0 && item.UserId == userId
+}
+
+func isExpired(item models.Item, now int64) bool {
+	return item.ExpiresAt > 0 && item.ExpiresAt <= now
+}
+
+// compareItems orders items by creation like the cursor of ItemCursor.
+func compareItems(a, b models.Item) int {
+	if byCreatedAt := cmp.Compare(a.CreatedAt, b.CreatedAt); byCreatedAt != 0 {
+		return byCreatedAt
+	}
+	return cmp.Compare(a.Id, b.Id)
+}
+
+// containsSearchTerms reports whether content contains every term, ignoring
+// case.
+func containsSearchTerms(content string, terms []string) bool {
+	content = strings.ToLower(content)
+	for _, term := range terms {
+		if !strings.Contains(content, strings.ToLower(term)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortSearchResults orders the results of the memory store by rank and then by
+// creation, newest first, and keeps at most limit results if limit is positive.
+func sortSearchResults(results []models.ItemSearchResult, limit int) []models.ItemSearchResult {
+	slices.SortStableFunc(results, func(a, b models.ItemSearchResult) int {
+		if byRank := cmp.Compare(b.Rank, a.Rank); byRank != 0 {
+			return byRank
+		}
+		return cmp.Compare(b.CreatedAt, a.CreatedAt)
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
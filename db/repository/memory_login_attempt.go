@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+type MemoryLoginAttemptRepository struct {
+	db *MemoryDB
+}
+
+func NewMemoryLoginAttemptRepository(db *MemoryDB) *MemoryLoginAttemptRepository {
+	return &MemoryLoginAttemptRepository{db: db}
+}
+
+func (lr *MemoryLoginAttemptRepository) GetLoginAttempt(
+	ctx context.Context,
+	arg GetLoginAttemptParams,
+) (models.LoginAttempt, error) {
+	lr.db.mu.Lock()
+	defer lr.db.mu.Unlock()
+
+	attempt, ok := lr.db.loginAttempts[arg]
+	if !ok {
+		return models.LoginAttempt{}, ErrNotFound
+	}
+	return attempt, nil
+}
+
+func (lr *MemoryLoginAttemptRepository) RecordLoginFailure(
+	ctx context.Context,
+	arg RecordLoginFailureParams,
+) (models.LoginAttempt, error) {
+	lr.db.mu.Lock()
+	defer lr.db.mu.Unlock()
+
+	key := GetLoginAttemptParams{Scope: arg.Scope, Key: arg.Key}
+	attempt, ok := lr.db.loginAttempts[key]
+	if !ok || attempt.LastFailedAt <= arg.ForgetBefore.Unix() {
+		attempt = models.LoginAttempt{Scope: arg.Scope, Key: arg.Key}
+	}
+	attempt.Failures++
+	attempt.LastFailedAt = arg.FailedAt.Unix()
+	lr.db.loginAttempts[key] = attempt
+	return attempt, nil
+}
+
+func (lr *MemoryLoginAttemptRepository) LockLoginAttempt(ctx context.Context, arg LockLoginAttemptParams) error {
+	lr.db.mu.Lock()
+	defer lr.db.mu.Unlock()
+
+	key := GetLoginAttemptParams{Scope: arg.Scope, Key: arg.Key}
+	attempt, ok := lr.db.loginAttempts[key]
+	if ok && attempt.LockedUntil < arg.LockedUntil.Unix() {
+		attempt.LockedUntil = arg.LockedUntil.Unix()
+		lr.db.loginAttempts[key] = attempt
+	}
+	return nil
+}
+
+func (lr *MemoryLoginAttemptRepository) DeleteLoginAttempt(ctx context.Context, arg GetLoginAttemptParams) error {
+	lr.db.mu.Lock()
+	defer lr.db.mu.Unlock()
+	delete(lr.db.loginAttempts, arg)
+	return nil
+}
+
+// ListLocked lists the keys of a scope that are currently locked, the longest
+// locked first.
+func (lr *MemoryLoginAttemptRepository) ListLocked(
+	ctx context.Context,
+	scope models.LoginAttemptScope,
+) ([]models.LoginAttempt, error) {
+	lr.db.mu.Lock()
+	defer lr.db.mu.Unlock()
+
+	attempts := []models.LoginAttempt{}
+	now := time.Now().Unix()
+	for _, attempt := range lr.db.loginAttempts {
+		if attempt.Scope == scope && attempt.LockedUntil > now {
+			attempts = append(attempts, attempt)
+		}
+	}
+	slices.SortFunc(attempts, func(a, b models.LoginAttempt) int {
+		if byLock := cmp.Compare(b.LockedUntil, a.LockedUntil); byLock != 0 {
+			return byLock
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return attempts, nil
+}
+
+func (lr *MemoryLoginAttemptRepository) DeleteStale(ctx context.Context, failedBefore time.Time) error {
+	lr.db.mu.Lock()
+	defer lr.db.mu.Unlock()
+
+	now := time.Now().Unix()
+	for key, attempt := range lr.db.loginAttempts {
+		if attempt.LastFailedAt <= failedBefore.Unix() && attempt.LockedUntil <= now {
+			delete(lr.db.loginAttempts, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/michaelhass/cpaw/hash"
+	"github.com/michaelhass/cpaw/models"
+)
+
+// MemorySessionRepository keeps sessions by a hash of their token like
+// SessionRepository.
+type MemorySessionRepository struct {
+	db *MemoryDB
+}
+
+func NewMemorySessionRepository(db *MemoryDB) *MemorySessionRepository {
+	return &MemorySessionRepository{db: db}
+}
+
+func (sr *MemorySessionRepository) CreateSession(ctx context.Context, arg CreateSessionParams) (models.Session, error) {
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	if _, ok := sr.db.users[arg.UserId]; !ok {
+		return models.Session{}, errForeignKeyConstraint
+	}
+	tokenHash := hash.NewFromToken(arg.Token)
+	if _, ok := sr.db.sessions[tokenHash]; ok {
+		return models.Session{}, errUniqueConstraint
+	}
+
+	createdAt := time.Now().Unix()
+	session := models.Session{
+		Id:         uuid.String(),
+		CreatedAt:  createdAt,
+		ExpiresAt:  arg.ExpiresAt.Unix(),
+		LastSeenAt: createdAt,
+		UserId:     arg.UserId,
+		UserAgent:  arg.UserAgent,
+		IpAddress:  arg.IpAddress,
+		Remember:   arg.Remember,
+	}
+	sr.db.sessions[tokenHash] = session
+	session.Token = arg.Token
+	return session, nil
+}
+
+func (sr *MemorySessionRepository) GetSessionByToken(ctx context.Context, sessionToken string) (models.Session, error) {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	session, ok := sr.db.sessions[hash.NewFromToken(sessionToken)]
+	if !ok {
+		return models.Session{}, ErrNotFound
+	}
+	session.Token = sessionToken
+	return session, nil
+}
+
+func (sr *MemorySessionRepository) UpdateSessionActivity(ctx context.Context, arg UpdateSessionActivityParams) error {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	tokenHash := hash.NewFromToken(arg.Token)
+	session, ok := sr.db.sessions[tokenHash]
+	if !ok {
+		return nil
+	}
+	session.ExpiresAt = arg.ExpiresAt.Unix()
+	session.LastSeenAt = arg.LastSeenAt.Unix()
+	sr.db.sessions[tokenHash] = session
+	return nil
+}
+
+// ListSessionsForUser lists the unexpired sessions of a user, most recently
+// used first.
+func (sr *MemorySessionRepository) ListSessionsForUser(ctx context.Context, userId string) ([]models.Session, error) {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	sessions := []models.Session{}
+	now := time.Now().Unix()
+	for _, session := range sr.db.sessions {
+		if session.UserId == userId && session.ExpiresAt > now {
+			sessions = append(sessions, session)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b models.Session) int {
+		if byLastSeen := cmp.Compare(b.LastSeenAt, a.LastSeenAt); byLastSeen != 0 {
+			return byLastSeen
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return sessions, nil
+}
+
+func (sr *MemorySessionRepository) DeleteSessionForUser(ctx context.Context, arg DeleteSessionForUserParams) error {
+	deleted := sr.deleteSessions(func(session models.Session) bool {
+		return session.Id == arg.SessionId && session.UserId == arg.UserId
+	})
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (sr *MemorySessionRepository) DeleteOtherSessionsForUser(
+	ctx context.Context,
+	arg DeleteOtherSessionsForUserParams,
+) error {
+	keepTokenHash := hash.NewFromToken(arg.KeepToken)
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	for tokenHash, session := range sr.db.sessions {
+		if session.UserId == arg.UserId && tokenHash != keepTokenHash {
+			delete(sr.db.sessions, tokenHash)
+		}
+	}
+	return nil
+}
+
+func (sr *MemorySessionRepository) DeleteSessionWithToken(ctx context.Context, sessionToken string) error {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+	delete(sr.db.sessions, hash.NewFromToken(sessionToken))
+	return nil
+}
+
+func (sr *MemorySessionRepository) DeleteAll(ctx context.Context) error {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+	clear(sr.db.sessions)
+	return nil
+}
+
+func (sr *MemorySessionRepository) DeleteExpired(ctx context.Context) error {
+	now := time.Now().Unix()
+	sr.deleteSessions(func(session models.Session) bool {
+		return session.ExpiresAt <= now
+	})
+	return nil
+}
+
+// deleteSessions deletes all sessions matching f and returns their count.
+func (sr *MemorySessionRepository) deleteSessions(f func(models.Session) bool) int {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	var count int
+	for tokenHash, session := range sr.db.sessions {
+		if f(session) {
+			delete(sr.db.sessions, tokenHash)
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/michaelhass/cpaw/models"
+)
+
+type MemoryShareRepository struct {
+	db *MemoryDB
+}
+
+func NewMemoryShareRepository(db *MemoryDB) *MemoryShareRepository {
+	return &MemoryShareRepository{db: db}
+}
+
+func (sr *MemoryShareRepository) CreateShare(ctx context.Context, arg CreateShareParams) (models.Share, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return models.Share{}, err
+	}
+
+	var expiresAt int64
+	if !arg.ExpiresAt.IsZero() {
+		expiresAt = arg.ExpiresAt.Unix()
+	}
+
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	_, itemExists := sr.db.items[arg.ItemId]
+	_, userExists := sr.db.users[arg.UserId]
+	if !itemExists || !userExists {
+		return models.Share{}, errForeignKeyConstraint
+	}
+	if _, ok := sr.shareByToken(arg.Token); ok {
+		return models.Share{}, errUniqueConstraint
+	}
+	share := models.Share{
+		Id:           id.String(),
+		CreatedAt:    time.Now().Unix(),
+		ItemId:       arg.ItemId,
+		UserId:       arg.UserId,
+		Token:        arg.Token,
+		ExpiresAt:    expiresAt,
+		MaxViews:     arg.MaxViews,
+		PasswordHash: arg.PasswordHash,
+		HasPassword:  len(arg.PasswordHash) > 0,
+	}
+	sr.db.shares[share.Id] = share
+	return share, nil
+}
+
+func (sr *MemoryShareRepository) GetShareByToken(ctx context.Context, token string) (models.Share, error) {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	share, ok := sr.shareByToken(token)
+	if !ok {
+		return models.Share{}, ErrNotFound
+	}
+	return share, nil
+}
+
+// ListSharesForItem lists the shares of an item, newest first.
+func (sr *MemoryShareRepository) ListSharesForItem(
+	ctx context.Context,
+	arg ListSharesForItemParams,
+) ([]models.Share, error) {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	shares := []models.Share{}
+	for _, share := range sr.db.shares {
+		if share.ItemId == arg.ItemId && share.UserId == arg.UserId {
+			shares = append(shares, share)
+		}
+	}
+	slices.SortFunc(shares, func(a, b models.Share) int {
+		if byCreation := cmp.Compare(b.CreatedAt, a.CreatedAt); byCreation != 0 {
+			return byCreation
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return shares, nil
+}
+
+// CountView increments the view count of a share. It returns ErrNotFound if
+// the share does not exist or has reached its view limit.
+func (sr *MemoryShareRepository) CountView(ctx context.Context, shareId string) error {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	share, ok := sr.db.shares[shareId]
+	if !ok || (share.MaxViews > 0 && share.ViewCount >= share.MaxViews) {
+		return ErrNotFound
+	}
+	share.ViewCount++
+	sr.db.shares[shareId] = share
+	return nil
+}
+
+func (sr *MemoryShareRepository) DeleteShareForUser(ctx context.Context, arg DeleteShareForUserParams) error {
+	sr.db.mu.Lock()
+	defer sr.db.mu.Unlock()
+
+	share, ok := sr.db.shares[arg.ShareId]
+	if !ok || share.ItemId != arg.ItemId || share.UserId != arg.UserId {
+		return ErrNotFound
+	}
+	delete(sr.db.shares, arg.ShareId)
+	return nil
+}
+
+// shareByToken must be called with the lock held.
+func (sr *MemoryShareRepository) shareByToken(token string) (models.Share, bool) {
+	for _, share := range sr.db.shares {
+		if share.Token == token {
+			return share, true
+		}
+	}
+	return models.Share{}, false
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestMemoryDBConcurrentUse is meant to be run with -race.
+func TestMemoryDBConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemoryDB()
+	users := NewMemoryUserRepository(memory)
+	items := NewMemoryItemRepository(memory)
+
+	user, err := users.CreateUser(ctx, CreateUserParams{UserName: "concurrent_user", Password: "pw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 10 {
+				item, err := items.CreateItem(ctx, CreateItemParams{
+					Content: fmt.Sprintf("item %d %d", i, j),
+					UserId:  user.Id,
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_, err = items.UpdateItemForUser(ctx, UpdateItemForUserParams{
+					ItemId:  item.Id,
+					UserId:  user.Id,
+					Content: "updated",
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := items.SearchItemsForUser(ctx, SearchItemsForUserParams{UserId: user.Id, Query: "item"}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	page, err := items.ListItemsForUser(ctx, ListItemsForUserParams{UserId: user.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 80 {
+		t.Errorf("Expected 80 items. Got: %d", len(page.Items))
+	}
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+type MemoryTwoFactorRepository struct {
+	db *MemoryDB
+}
+
+func NewMemoryTwoFactorRepository(db *MemoryDB) *MemoryTwoFactorRepository {
+	return &MemoryTwoFactorRepository{db: db}
+}
+
+func (tr *MemoryTwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, arg ReplaceRecoveryCodesParams) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	if _, ok := tr.db.users[arg.UserId]; !ok {
+		return errForeignKeyConstraint
+	}
+	codes := map[string]bool{}
+	for _, codeHash := range arg.CodeHashes {
+		if codes[codeHash] {
+			return errUniqueConstraint
+		}
+		codes[codeHash] = true
+	}
+	tr.db.recoveryCodes[arg.UserId] = codes
+	return nil
+}
+
+func (tr *MemoryTwoFactorRepository) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	codes := tr.db.recoveryCodes[arg.UserId]
+	if !codes[arg.CodeHash] {
+		return ErrNotFound
+	}
+	delete(codes, arg.CodeHash)
+	return nil
+}
+
+func (tr *MemoryTwoFactorRepository) CountRecoveryCodes(ctx context.Context, userId string) (int, error) {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+	return len(tr.db.recoveryCodes[userId]), nil
+}
+
+func (tr *MemoryTwoFactorRepository) DeleteRecoveryCodes(ctx context.Context, userId string) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+	delete(tr.db.recoveryCodes, userId)
+	return nil
+}
+
+func (tr *MemoryTwoFactorRepository) CreateLoginChallenge(
+	ctx context.Context,
+	arg CreateLoginChallengeParams,
+) (models.LoginChallenge, error) {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	if _, ok := tr.db.users[arg.UserId]; !ok {
+		return models.LoginChallenge{}, errForeignKeyConstraint
+	}
+	if _, ok := tr.db.loginChallenges[arg.TokenHash]; ok {
+		return models.LoginChallenge{}, errUniqueConstraint
+	}
+	challenge := models.LoginChallenge{
+		TokenHash: arg.TokenHash,
+		UserId:    arg.UserId,
+		CreatedAt: time.Now().Unix(),
+		ExpiresAt: arg.ExpiresAt.Unix(),
+		Remember:  arg.Remember,
+		UserAgent: arg.UserAgent,
+		IpAddress: arg.IpAddress,
+	}
+	tr.db.loginChallenges[challenge.TokenHash] = challenge
+	return challenge, nil
+}
+
+func (tr *MemoryTwoFactorRepository) GetLoginChallengeByHash(
+	ctx context.Context,
+	tokenHash string,
+) (models.LoginChallenge, error) {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	challenge, ok := tr.db.loginChallenges[tokenHash]
+	if !ok {
+		return models.LoginChallenge{}, ErrNotFound
+	}
+	return challenge, nil
+}
+
+func (tr *MemoryTwoFactorRepository) DeleteLoginChallenge(ctx context.Context, tokenHash string) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+	delete(tr.db.loginChallenges, tokenHash)
+	return nil
+}
+
+func (tr *MemoryTwoFactorRepository) DeleteExpiredLoginChallenges(ctx context.Context) error {
+	tr.db.mu.Lock()
+	defer tr.db.mu.Unlock()
+
+	now := time.Now().Unix()
+	for tokenHash, challenge := range tr.db.loginChallenges {
+		if challenge.ExpiresAt <= now {
+			delete(tr.db.loginChallenges, tokenHash)
+		}
+	}
+	return nil
+}
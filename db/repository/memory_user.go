@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/michaelhass/cpaw/hash"
+	"github.com/michaelhass/cpaw/models"
+)
+
+type MemoryUserRepository struct {
+	db *MemoryDB
+}
+
+func NewMemoryUserRepository(db *MemoryDB) *MemoryUserRepository {
+	return &MemoryUserRepository{db: db}
+}
+
+func (ur *MemoryUserRepository) GetUserCount(ctx context.Context) (int, error) {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+	return len(ur.db.users), nil
+}
+
+func (ur *MemoryUserRepository) CreateUser(ctx context.Context, arg CreateUserParams) (models.User, error) {
+	role := arg.Role
+	if len(role) == 0 {
+		role = models.UserRole
+	}
+	if !role.IsValid() {
+		return models.User{}, errForeignKeyConstraint
+	}
+
+	passwordHash, err := hash.NewFromPassword(arg.Password)
+	if err != nil {
+		return models.User{}, err
+	}
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	if _, ok := ur.userByName(arg.UserName); ok {
+		return models.User{}, errUniqueConstraint
+	}
+	var identityKey GetIdentityParams
+	if arg.Identity != nil {
+		identityKey = GetIdentityParams{Issuer: arg.Identity.Issuer, Subject: arg.Identity.Subject}
+		if _, ok := ur.db.identities[identityKey]; ok {
+			return models.User{}, errUniqueConstraint
+		}
+	}
+	user := models.User{
+		Id:           uuid.String(),
+		CreatedAt:    time.Now().Unix(),
+		UserName:     arg.UserName,
+		PasswordHash: passwordHash,
+		Role:         role,
+	}
+	ur.db.users[user.Id] = user
+	if arg.Identity != nil {
+		ur.db.identities[identityKey] = models.Identity{
+			Issuer:    identityKey.Issuer,
+			Subject:   identityKey.Subject,
+			UserId:    user.Id,
+			CreatedAt: user.CreatedAt,
+		}
+	}
+	return user, nil
+}
+
+func (ur *MemoryUserRepository) GetUserById(ctx context.Context, id string) (models.User, error) {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	user, ok := ur.db.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (ur *MemoryUserRepository) GetUserByName(ctx context.Context, name string) (models.User, error) {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	user, ok := ur.userByName(name)
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (ur *MemoryUserRepository) ListUsers(ctx context.Context) ([]models.User, error) {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	var users []models.User
+	for _, user := range ur.db.users {
+		users = append(users, user)
+	}
+	slices.SortFunc(users, func(a, b models.User) int {
+		return cmp.Compare(a.UserName, b.UserName)
+	})
+	return users, nil
+}
+
+func (ur *MemoryUserRepository) UpdatePassword(ctx context.Context, args UpdateUserPasswordParams) error {
+	passwordHash, err := hash.NewFromPassword(args.Password)
+	if err != nil {
+		return err
+	}
+	ur.updateUser(args.UserId, func(user *models.User) {
+		user.PasswordHash = passwordHash
+	})
+	return nil
+}
+
+func (ur *MemoryUserRepository) UpdateUserName(ctx context.Context, args UpdateUserNameParams) error {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	if other, ok := ur.userByName(args.UserName); ok && other.Id != args.UserId {
+		return errUniqueConstraint
+	}
+	if user, ok := ur.db.users[args.UserId]; ok {
+		user.UserName = args.UserName
+		ur.db.users[user.Id] = user
+	}
+	return nil
+}
+
+func (ur *MemoryUserRepository) UpdateRole(ctx context.Context, args UpdateUserRoleParams) error {
+	if !args.Role.IsValid() {
+		return errForeignKeyConstraint
+	}
+	ur.updateUser(args.UserId, func(user *models.User) {
+		user.Role = args.Role
+	})
+	return nil
+}
+
+func (ur *MemoryUserRepository) SetTotpSecret(ctx context.Context, args SetTotpSecretParams) error {
+	ur.updateUser(args.UserId, func(user *models.User) {
+		user.TotpSecret = args.Secret
+		user.TwoFactorEnabled = false
+		user.TotpLastStep = 0
+	})
+	return nil
+}
+
+func (ur *MemoryUserRepository) UseTotpStep(ctx context.Context, args UseTotpStepParams) error {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	user, ok := ur.db.users[args.UserId]
+	if !ok || len(user.TotpSecret) == 0 || user.TotpLastStep >= args.Step {
+		return ErrNotFound
+	}
+	user.TotpLastStep = args.Step
+	user.TwoFactorEnabled = user.TwoFactorEnabled || args.Enable
+	ur.db.users[user.Id] = user
+	return nil
+}
+
+func (ur *MemoryUserRepository) DisableTotp(ctx context.Context, userId string) error {
+	ur.updateUser(userId, func(user *models.User) {
+		user.TotpSecret = ""
+		user.TwoFactorEnabled = false
+		user.TotpLastStep = 0
+	})
+	return nil
+}
+
+func (ur *MemoryUserRepository) DeleteUserById(ctx context.Context, id string) error {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+	ur.db.deleteUser(id)
+	return nil
+}
+
+func (ur *MemoryUserRepository) DeleteAll(ctx context.Context) error {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+	for id := range ur.db.users {
+		ur.db.deleteUser(id)
+	}
+	return nil
+}
+
+// userByName must be called with the lock held.
+func (ur *MemoryUserRepository) userByName(name string) (models.User, bool) {
+	for _, user := range ur.db.users {
+		if user.UserName == name {
+			return user, true
+		}
+	}
+	return models.User{}, false
+}
+
+// updateUser applies update to a user if it exists.
+func (ur *MemoryUserRepository) updateUser(id string, update func(*models.User)) {
+	ur.db.mu.Lock()
+	defer ur.db.mu.Unlock()
+
+	user, ok := ur.db.users[id]
+	if !ok {
+		return
+	}
+	update(&user)
+	ur.db.users[id] = user
+}
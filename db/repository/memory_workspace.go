@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/michaelhass/cpaw/models"
+)
+
+type MemoryWorkspaceRepository struct {
+	db *MemoryDB
+}
+
+func NewMemoryWorkspaceRepository(db *MemoryDB) *MemoryWorkspaceRepository {
+	return &MemoryWorkspaceRepository{db: db}
+}
+
+// CreateWorkspace creates a workspace with its owner as first member.
+func (wr *MemoryWorkspaceRepository) CreateWorkspace(
+	ctx context.Context,
+	arg CreateWorkspaceParams,
+) (models.Workspace, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return models.Workspace{}, err
+	}
+
+	wr.db.mu.Lock()
+	defer wr.db.mu.Unlock()
+
+	if _, ok := wr.db.users[arg.OwnerId]; !ok {
+		return models.Workspace{}, errForeignKeyConstraint
+	}
+	workspace := models.Workspace{
+		Id:        id.String(),
+		CreatedAt: time.Now().Unix(),
+		Name:      arg.Name,
+		OwnerId:   arg.OwnerId,
+	}
+	wr.db.workspaces[workspace.Id] = workspace
+	wr.db.workspaceMembers[workspace.Id] = map[string]models.WorkspaceMember{
+		arg.OwnerId: {
+			WorkspaceId: workspace.Id,
+			UserId:      arg.OwnerId,
+			Role:        models.WorkspaceOwnerRole,
+			CreatedAt:   workspace.CreatedAt,
+		},
+	}
+	workspace.Role = models.WorkspaceOwnerRole
+	return workspace, nil
+}
+
+// ListWorkspacesForUser lists the workspaces of a member by name.
+func (wr *MemoryWorkspaceRepository) ListWorkspacesForUser(
+	ctx context.Context,
+	userId string,
+) ([]models.Workspace, error) {
+	wr.db.mu.Lock()
+	defer wr.db.mu.Unlock()
+
+	workspaces := []models.Workspace{}
+	for id, workspace := range wr.db.workspaces {
+		if member, ok := wr.db.workspaceMembers[id][userId]; ok {
+			workspace.Role = member.Role
+			workspaces = append(workspaces, workspace)
+		}
+	}
+	slices.SortFunc(workspaces, func(a, b models.Workspace) int {
+		if byName := cmp.Compare(a.Name, b.Name); byName != 0 {
+			return byName
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return workspaces, nil
+}
+
+// GetWorkspaceForUser returns a workspace the user is a member of together
+// with the user's role. It returns ErrNotFound for non-members.
+func (wr *MemoryWorkspaceRepository) GetWorkspaceForUser(
+	ctx context.Context,
+	arg GetWorkspaceForUserParams,
+) (models.Workspace, error) {
+	wr.db.mu.Lock()
+	defer wr.db.mu.Unlock()
+
+	workspace, ok := wr.db.workspaces[arg.WorkspaceId]
+	member, isMember := wr.db.workspaceMembers[arg.WorkspaceId][arg.UserId]
+	if !ok || !isMember {
+		return models.Workspace{}, ErrNotFound
+	}
+	workspace.Role = member.Role
+	return workspace, nil
+}
+
+// ListMembers lists the owner first and then the members by user name.
+func (wr *MemoryWorkspaceRepository) ListMembers(
+	ctx context.Context,
+	workspaceId string,
+) ([]models.WorkspaceMember, error) {
+	wr.db.mu.Lock()
+	defer wr.db.mu.Unlock()
+
+	members := []models.WorkspaceMember{}
+	for userId, member := range wr.db.workspaceMembers[workspaceId] {
+		member.UserName = wr.db.users[userId].UserName
+		members = append(members, member)
+	}
+	slices.SortFunc(members, func(a, b models.WorkspaceMember) int {
+		if byRole := cmp.Compare(b.Role, a.Role); byRole != 0 {
+			return byRole
+		}
+		return cmp.Compare(a.UserName, b.UserName)
+	})
+	return members, nil
+}
+
+func (wr *MemoryWorkspaceRepository) AddMember(ctx context.Context, arg AddWorkspaceMemberParams) error {
+	wr.db.mu.Lock()
+	defer wr.db.mu.Unlock()
+
+	_, workspaceExists := wr.db.workspaces[arg.WorkspaceId]
+	_, userExists := wr.db.users[arg.UserId]
+	if !workspaceExists || !userExists {
+		return errForeignKeyConstraint
+	}
+	members := wr.db.workspaceMembers[arg.WorkspaceId]
+	if _, ok := members[arg.UserId]; ok {
+		return ErrAlreadyMember
+	}
+	members[arg.UserId] = models.WorkspaceMember{
+		WorkspaceId: arg.WorkspaceId,
+		UserId:      arg.UserId,
+		Role:        arg.Role,
+		CreatedAt:   time.Now().Unix(),
+	}
+	return nil
+}
+
+func (wr *MemoryWorkspaceRepository) RemoveMember(ctx context.Context, arg RemoveWorkspaceMemberParams) error {
+	wr.db.mu.Lock()
+	defer wr.db.mu.Unlock()
+
+	members := wr.db.workspaceMembers[arg.WorkspaceId]
+	if _, ok := members[arg.UserId]; !ok {
+		return ErrNotFound
+	}
+	delete(members, arg.UserId)
+	return nil
+}
+
+// DeleteWorkspace deletes a workspace including its items.
+func (wr *MemoryWorkspaceRepository) DeleteWorkspace(ctx context.Context, workspaceId string) error {
+	wr.db.mu.Lock()
+	defer wr.db.mu.Unlock()
+	wr.db.deleteWorkspace(workspaceId)
+	return nil
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+const (
+	snippetMatchStart = "\x02"
+	snippetMatchEnd   = "\x03"
+)
+
+// newSearchTerms splits free text into the terms of a search.
+func newSearchTerms(text string) []string {
+	return strings.Fields(strings.ReplaceAll(text, `"`, " "))
+}
+
+// newSearchQuery turns free text into a full-text query that matches every
+// term as a prefix, so user input never has to follow the MATCH syntax.
+func newSearchQuery(text string) string {
+	var terms []string
+	for _, term := range newSearchTerms(text) {
+		terms = append(terms, `"`+term+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+func parseSnippet(snippet string) []models.SnippetFragment {
+	fragments := []models.SnippetFragment{}
+	for len(snippet) > 0 {
+		start := strings.Index(snippet, snippetMatchStart)
+		if start < 0 {
+			fragments = append(fragments, models.SnippetFragment{Text: snippet})
+			break
+		}
+		if start > 0 {
+			fragments = append(fragments, models.SnippetFragment{Text: snippet[:start]})
+		}
+		snippet = snippet[start+len(snippetMatchStart):]
+
+		end := strings.Index(snippet, snippetMatchEnd)
+		if end < 0 {
+			end = len(snippet)
+		}
+		fragments = append(fragments, models.SnippetFragment{Text: snippet[:end], Match: true})
+		snippet = strings.TrimPrefix(snippet[end:], snippetMatchEnd)
+	}
+	return fragments
+}
+
+// likeSearchPattern matches a term anywhere in a text with LIKE and ILIKE.
+func likeSearchPattern(term string) string {
+	return "%" + likeEscaper.Replace(term) + "%"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+const (
+	// matchSnippetBefore and matchSnippetAfter are the number of bytes a
+	// snippet shows around the first match.
+	matchSnippetBefore = 48
+	matchSnippetAfter  = 120
+	matchSnippetMarker = "…"
+)
+
+// matchSearchTerms finds the terms in content without a full-text index. It
+// returns a snippet around the first match and a rank, which, like the
+// negated bm25 of the full-text index, grows with the number of matches of
+// each term.
+func matchSearchTerms(content string, terms []string) ([]models.SnippetFragment, float64) {
+	fragments := []models.SnippetFragment{}
+	if len(terms) == 0 {
+		return fragments, 0
+	}
+
+	var (
+		rank     float64
+		patterns []string
+	)
+	for _, term := range terms {
+		pattern := "(?i)" + regexp.QuoteMeta(term)
+		if frequency := float64(len(regexp.MustCompile(pattern).FindAllStringIndex(content, -1))); frequency > 0 {
+			rank += (frequency * 2.2) / (frequency + 1.2)
+		}
+		patterns = append(patterns, regexp.QuoteMeta(term))
+	}
+	// Longer terms first, so a term that contains another one is marked as a
+	// whole.
+	slices.SortStableFunc(patterns, func(a, b string) int { return len(b) - len(a) })
+	matches := regexp.MustCompile("(?i)"+strings.Join(patterns, "|")).FindAllStringIndex(content, -1)
+
+	// Snippets start and end at whole words, but always contain the first
+	// match.
+	first, firstEnd := 0, 0
+	if len(matches) > 0 {
+		first, firstEnd = matches[0][0], matches[0][1]
+	}
+	start, end := max(0, first-matchSnippetBefore), min(len(content), max(first+matchSnippetAfter, firstEnd))
+	if start > 0 {
+		if space := strings.IndexFunc(content[start:first], unicode.IsSpace); space >= 0 {
+			_, size := utf8.DecodeRuneInString(content[start+space:])
+			start += space + size
+		}
+		for start < first && !utf8.RuneStart(content[start]) {
+			start++
+		}
+	}
+	if end < len(content) {
+		for end > firstEnd && !utf8.RuneStart(content[end]) {
+			end--
+		}
+		if space := strings.LastIndexFunc(content[start:end], unicode.IsSpace); start+space >= firstEnd {
+			end = start + space
+		}
+	}
+
+	text := func(text string) {
+		if len(text) > 0 {
+			fragments = append(fragments, models.SnippetFragment{Text: text})
+		}
+	}
+	if start > 0 {
+		text(matchSnippetMarker)
+	}
+	position := start
+	for _, match := range matches {
+		if match[0] < position || match[1] > end {
+			continue
+		}
+		text(content[position:match[0]])
+		fragments = append(fragments, models.SnippetFragment{Text: content[match[0]:match[1]], Match: true})
+		position = match[1]
+	}
+	text(content[position:end])
+	if end < len(content) {
+		text(matchSnippetMarker)
+	}
+	return fragments, rank
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+func TestNewSearchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"whitespace", "   ", ""},
+		{"single term", "foo", `"foo"*`},
+		{"multiple terms", " foo  bar ", `"foo"* "bar"*`},
+		{"quotes", `a"b "`, `"a"* "b"*`},
+		{"operators", "-foo OR bar", `"-foo"* "OR"* "bar"*`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newSearchQuery(tt.input); got != tt.want {
+				t.Errorf("newSearchQuery(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSnippet(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []models.SnippetFragment
+	}{
+		{"empty", "", []models.SnippetFragment{}},
+		{"no match", "abc", []models.SnippetFragment{{Text: "abc"}}},
+		{
+			"match",
+			"a \x02b\x03 c",
+			[]models.SnippetFragment{{Text: "a "}, {Text: "b", Match: true}, {Text: " c"}},
+		},
+		{
+			"leading match",
+			"\x02a\x03\x02b\x03",
+			[]models.SnippetFragment{{Text: "a", Match: true}, {Text: "b", Match: true}},
+		},
+		{
+			"unterminated match",
+			"a \x02b",
+			[]models.SnippetFragment{{Text: "a "}, {Text: "b", Match: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSnippet(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSnippet(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLikeSearchPattern(t *testing.T) {
+	if got, want := likeSearchPattern(`50%_a\b`), `%50\%\_a\\b%`; got != want {
+		t.Errorf("likeSearchPattern() = %q, want %q", got, want)
+	}
+}
+
+func TestMatchSearchTerms(t *testing.T) {
+	long := strings.Repeat("word ", 40)
+
+	tests := []struct {
+		name    string
+		content string
+		terms   []string
+		want    []models.SnippetFragment
+	}{
+		{
+			"match",
+			"Foo bar foobar",
+			[]string{"foo"},
+			[]models.SnippetFragment{
+				{Text: "Foo", Match: true},
+				{Text: " bar "},
+				{Text: "foo", Match: true},
+				{Text: "bar"},
+			},
+		},
+		{
+			"longest term",
+			"foobar",
+			[]string{"foo", "foobar"},
+			[]models.SnippetFragment{{Text: "foobar", Match: true}},
+		},
+		{
+			"shortened",
+			long + "match " + long,
+			[]string{"match"},
+			[]models.SnippetFragment{
+				{Text: "…"},
+				{Text: strings.Repeat("word ", 9)},
+				{Text: "match", Match: true},
+				{Text: " " + strings.TrimSpace(strings.Repeat("word ", 22))},
+				{Text: "…"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rank := matchSearchTerms(tt.content, tt.terms)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchSearchTerms(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+			if rank <= 0 {
+				t.Errorf("Expected positive rank. Got: %f", rank)
+			}
+		})
+	}
+
+	_, rankOne := matchSearchTerms("foo", []string{"foo"})
+	_, rankTwo := matchSearchTerms("foo foo", []string{"foo"})
+	if rankTwo <= rankOne {
+		t.Errorf("Expected rank to grow with matches. Got: %f, %f", rankOne, rankTwo)
+	}
+}
@@ -6,9 +6,14 @@ import (
 	"errors"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/michaelhass/cpaw/hash"
 	"github.com/michaelhass/cpaw/models"
 )
 
+// SessionRepository stores sessions by a hash of their token, so a copy of the
+// database can't be used to take over sessions. All methods take the plain
+// token and hash it themselves.
 type SessionRepository struct {
 	db *sql.DB
 }
@@ -21,51 +26,156 @@ type CreateSessionParams struct {
 	Token     string
 	ExpiresAt time.Time
 	UserId    string
+	Remember  bool
+	UserAgent string
+	IpAddress string
 }
 
+const sessionColumns = "id, token_hash, created_at, expires_at, last_seen_at, user_id, user_agent, ip_address, remember"
+
 const createSessionQuery = `
-INSERT INTO sessions (token, expires_at, user_id)
-VALUES ($1, $2, $3)
-RETURNING token, expires_at, user_id;
-`
+INSERT INTO sessions (id, token_hash, created_at, expires_at, last_seen_at, user_id, user_agent, ip_address, remember)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING ` + sessionColumns + ";"
 
 func (sr *SessionRepository) CreateSession(ctx context.Context, arg CreateSessionParams) (models.Session, error) {
-	var session models.Session
-	expiresAt := arg.ExpiresAt.Unix()
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	createdAt := time.Now().Unix()
 	row := sr.db.QueryRowContext(
 		ctx,
 		createSessionQuery,
-		arg.Token,
-		expiresAt,
+		uuid.String(),
+		hash.NewFromToken(arg.Token),
+		createdAt,
+		arg.ExpiresAt.Unix(),
+		createdAt,
 		arg.UserId,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.Remember,
 	)
-	err := row.Scan(&session.Token, &session.ExpiresAt, &session.UserId)
-	return session, err
+	session, err := scanSession(row)
+	if err != nil {
+		return session, err
+	}
+	session.Token = arg.Token
+	return session, nil
 }
 
 const getSessionByTokenQuery = `
-SELECT token, expires_at, user_id FROM sessions
-WHERE token = $1;
+SELECT ` + sessionColumns + ` FROM sessions
+WHERE token_hash = $1;
 `
 
 func (sr *SessionRepository) GetSessionByToken(ctx context.Context, sessionToken string) (models.Session, error) {
-	var session models.Session
 	row := sr.db.QueryRowContext(
 		ctx,
 		getSessionByTokenQuery,
-		sessionToken,
+		hash.NewFromToken(sessionToken),
 	)
-	err := row.Scan(&session.Token, &session.ExpiresAt, &session.UserId)
+	session, err := scanSession(row)
 	if errors.Is(err, sql.ErrNoRows) {
 		return session, ErrNotFound
+	} else if err != nil {
+		return session, err
 	}
-	return session, err
+	session.Token = sessionToken
+	return session, nil
+}
+
+const updateSessionActivityQuery = "UPDATE sessions SET expires_at = $1, last_seen_at = $2 WHERE token_hash = $3;"
+
+type UpdateSessionActivityParams struct {
+	Token      string
+	ExpiresAt  time.Time
+	LastSeenAt time.Time
+}
+
+func (sr *SessionRepository) UpdateSessionActivity(ctx context.Context, arg UpdateSessionActivityParams) error {
+	_, err := sr.db.ExecContext(
+		ctx,
+		updateSessionActivityQuery,
+		arg.ExpiresAt.Unix(),
+		arg.LastSeenAt.Unix(),
+		hash.NewFromToken(arg.Token),
+	)
+	return err
 }
 
-const deleteSessionWithTokenQuery = "DELETE FROM sessions WHERE token = $1;"
+const listSessionsForUserQuery = `
+SELECT ` + sessionColumns + ` FROM sessions
+WHERE user_id = $1 AND expires_at > $2
+ORDER BY last_seen_at DESC, id;
+`
+
+// ListSessionsForUser lists the unexpired sessions of a user, most recently
+// used first.
+func (sr *SessionRepository) ListSessionsForUser(ctx context.Context, userId string) ([]models.Session, error) {
+	sessions := []models.Session{}
+
+	rows, err := sr.db.QueryContext(ctx, listSessionsForUserQuery, userId, time.Now().Unix())
+	if err != nil {
+		return sessions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+const deleteSessionForUserQuery = "DELETE FROM sessions WHERE id = $1 AND user_id = $2;"
+
+type DeleteSessionForUserParams struct {
+	SessionId string
+	UserId    string
+}
+
+func (sr *SessionRepository) DeleteSessionForUser(ctx context.Context, arg DeleteSessionForUserParams) error {
+	result, err := sr.db.ExecContext(ctx, deleteSessionForUserQuery, arg.SessionId, arg.UserId)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const deleteOtherSessionsForUserQuery = "DELETE FROM sessions WHERE user_id = $1 AND token_hash != $2;"
+
+type DeleteOtherSessionsForUserParams struct {
+	UserId string
+	// KeepToken is the token of the session to keep. If empty, all sessions
+	// of the user are deleted.
+	KeepToken string
+}
+
+func (sr *SessionRepository) DeleteOtherSessionsForUser(
+	ctx context.Context,
+	arg DeleteOtherSessionsForUserParams,
+) error {
+	_, err := sr.db.ExecContext(ctx, deleteOtherSessionsForUserQuery, arg.UserId, hash.NewFromToken(arg.KeepToken))
+	return err
+}
+
+const deleteSessionWithTokenQuery = "DELETE FROM sessions WHERE token_hash = $1;"
 
 func (sr *SessionRepository) DeleteSessionWithToken(ctx context.Context, sessionToken string) error {
-	_, err := sr.db.ExecContext(ctx, deleteSessionWithTokenQuery, sessionToken)
+	_, err := sr.db.ExecContext(ctx, deleteSessionWithTokenQuery, hash.NewFromToken(sessionToken))
 	return err
 }
 
@@ -83,3 +193,23 @@ func (sr *SessionRepository) DeleteExpired(ctx context.Context) error {
 	_, err := sr.db.ExecContext(ctx, deleteExpiredQuery, currentTime)
 	return err
 }
+
+// scanSession leaves the token empty. Only its hash is stored.
+func scanSession(row rowScanner) (models.Session, error) {
+	var (
+		session   models.Session
+		tokenHash string
+	)
+	err := row.Scan(
+		&session.Id,
+		&tokenHash,
+		&session.CreatedAt,
+		&session.ExpiresAt,
+		&session.LastSeenAt,
+		&session.UserId,
+		&session.UserAgent,
+		&session.IpAddress,
+		&session.Remember,
+	)
+	return session, err
+}
@@ -7,49 +7,41 @@ import (
 	"testing"
 	"time"
 
+	"github.com/michaelhass/cpaw/hash"
 	"github.com/michaelhass/cpaw/models"
 )
 
-func createTestSessionRepository(t *testing.T, name string) (*SessionRepository, error) {
-	db, err := prepareTestDb(name)
-	t.Cleanup(cleanUpTestDb(name, db))
-	return NewSessionRespository(db), err
-}
-
 func TestSessionRepository(t *testing.T) {
-	dbName := "SessionRepositoryTest_createUser.db"
-	sessionRepo, err := createTestSessionRepository(t, dbName)
-	userRepo := NewUserRepository(sessionRepo.db)
-	t.Cleanup(cleanUpTestDb(dbName, sessionRepo.db))
-	if err != nil {
-		t.Error(err)
-		return
-	}
+	runWithTestStores(t, "SessionRepositoryTest_createUser.db", func(t *testing.T, stores testStores) {
+		sessionRepo := stores.sessions
+		userRepo := stores.users
 
-	sessionRepoTestFunc := func(f func(*testing.T, models.User)) func(*testing.T) {
-		return func(t *testing.T) {
-			t.Cleanup(func() {
-				userRepo.DeleteAll(context.Background())
-			})
-			testUser, err := userRepo.CreateUser(context.Background(), CreateUserParams{
-				UserName: "Some Name",
-				Password: "pw",
-			})
-			if err != nil {
-				t.Error(err)
-				return
+		sessionRepoTestFunc := func(f func(*testing.T, models.User)) func(*testing.T) {
+			return func(t *testing.T) {
+				t.Cleanup(func() {
+					userRepo.DeleteAll(context.Background())
+				})
+				testUser, err := userRepo.CreateUser(context.Background(), CreateUserParams{
+					UserName: "Some Name",
+					Password: "pw",
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				f(t, testUser)
 			}
-			f(t, testUser)
 		}
-	}
 
-	t.Run("CreateSession", sessionRepoTestFunc(testCreateSession(sessionRepo)))
-	t.Run("GetSessionByToken", sessionRepoTestFunc(testGetSessionByToken(sessionRepo)))
-	t.Run("DeleteSession", sessionRepoTestFunc(testDeleteSession(sessionRepo)))
-	t.Run("DeleteExpiredSessions", sessionRepoTestFunc(testDeleteExpiredSessions(sessionRepo)))
+		t.Run("CreateSession", sessionRepoTestFunc(testCreateSession(sessionRepo)))
+		t.Run("GetSessionByToken", sessionRepoTestFunc(testGetSessionByToken(sessionRepo)))
+		t.Run("DeleteSession", sessionRepoTestFunc(testDeleteSession(sessionRepo)))
+		t.Run("DeleteExpiredSessions", sessionRepoTestFunc(testDeleteExpiredSessions(sessionRepo)))
+		t.Run("ListAndRevokeSessions", sessionRepoTestFunc(testListAndRevokeSessions(sessionRepo)))
+	})
 }
 
-func testCreateSession(repo *SessionRepository) func(*testing.T, models.User) {
+func testCreateSession(repo SessionStore) func(*testing.T, models.User) {
 	return func(t *testing.T, testUser models.User) {
 		ctx := context.Background()
 
@@ -82,10 +74,24 @@ func testCreateSession(repo *SessionRepository) func(*testing.T, models.User) {
 			t.Errorf("'UserId' not stored correctly. Expected: %s. Got: %s.", params.Token, session.Token)
 			return
 		}
+
+		sqlRepo, ok := repo.(*SessionRepository)
+		if !ok {
+			return
+		}
+		var storedToken string
+		row := sqlRepo.db.QueryRowContext(ctx, "SELECT token_hash FROM sessions WHERE id = $1", session.Id)
+		if err := row.Scan(&storedToken); err != nil {
+			t.Error(err)
+			return
+		}
+		if storedToken == params.Token || storedToken != hash.NewFromToken(params.Token) {
+			t.Errorf("Expected hash of token to be stored. Got: %s", storedToken)
+		}
 	}
 }
 
-func testGetSessionByToken(repo *SessionRepository) func(*testing.T, models.User) {
+func testGetSessionByToken(repo SessionStore) func(*testing.T, models.User) {
 	return func(t *testing.T, testUser models.User) {
 		ctx := context.Background()
 
@@ -128,7 +134,7 @@ func testGetSessionByToken(repo *SessionRepository) func(*testing.T, models.User
 	}
 }
 
-func testDeleteSession(repo *SessionRepository) func(*testing.T, models.User) {
+func testDeleteSession(repo SessionStore) func(*testing.T, models.User) {
 	return func(t *testing.T, testUser models.User) {
 		ctx := context.Background()
 
@@ -164,7 +170,7 @@ func testDeleteSession(repo *SessionRepository) func(*testing.T, models.User) {
 	}
 }
 
-func testDeleteExpiredSessions(repo *SessionRepository) func(*testing.T, models.User) {
+func testDeleteExpiredSessions(repo SessionStore) func(*testing.T, models.User) {
 	return func(t *testing.T, testUser models.User) {
 		ctx := context.Background()
 
@@ -211,3 +217,63 @@ func testDeleteExpiredSessions(repo *SessionRepository) func(*testing.T, models.
 		}
 	}
 }
+
+func testListAndRevokeSessions(repo SessionStore) func(*testing.T, models.User) {
+	return func(t *testing.T, testUser models.User) {
+		ctx := context.Background()
+
+		var sessions []models.Session
+		for i := range 3 {
+			session, err := repo.CreateSession(ctx, CreateSessionParams{
+				Token:     fmt.Sprintf("token%d", i),
+				ExpiresAt: time.Now().Add(time.Minute * 15),
+				UserId:    testUser.Id,
+				UserAgent: "test agent",
+				IpAddress: "127.0.0.1",
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			sessions = append(sessions, session)
+		}
+		_, _ = repo.CreateSession(ctx, CreateSessionParams{
+			Token:     "expired",
+			ExpiresAt: time.Now().Add(time.Minute * -1),
+			UserId:    testUser.Id,
+		})
+
+		listed, err := repo.ListSessionsForUser(ctx, testUser.Id)
+		if err != nil || len(listed) != 3 {
+			t.Errorf("Expected 3 unexpired sessions. Got: %v %v", listed, err)
+			return
+		}
+		if len(listed[0].Id) == 0 || listed[0].UserAgent != "test agent" || listed[0].IpAddress != "127.0.0.1" {
+			t.Errorf("Session activity not stored correctly. Got: %v", listed[0])
+		}
+
+		err = repo.DeleteSessionForUser(ctx, DeleteSessionForUserParams{SessionId: sessions[0].Id, UserId: "other"})
+		if !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound' for session of other user. Got: ", err)
+		}
+		err = repo.DeleteSessionForUser(ctx, DeleteSessionForUserParams{SessionId: sessions[0].Id, UserId: testUser.Id})
+		if err != nil {
+			t.Error(err)
+		}
+		if _, err := repo.GetSessionByToken(ctx, sessions[0].Token); !errors.Is(err, ErrNotFound) {
+			t.Error("Session not deleted", err)
+		}
+
+		err = repo.DeleteOtherSessionsForUser(ctx, DeleteOtherSessionsForUserParams{
+			UserId:    testUser.Id,
+			KeepToken: sessions[1].Token,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		listed, err = repo.ListSessionsForUser(ctx, testUser.Id)
+		if err != nil || len(listed) != 1 || listed[0].Id != sessions[1].Id {
+			t.Errorf("Expected only kept session. Got: %v %v", listed, err)
+		}
+	}
+}
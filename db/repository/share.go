@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/michaelhass/cpaw/models"
+)
+
+type ShareRepository struct {
+	db *sql.DB
+}
+
+func NewShareRepository(db *sql.DB) *ShareRepository {
+	return &ShareRepository{db: db}
+}
+
+type CreateShareParams struct {
+	ItemId       string
+	UserId       string
+	Token        string
+	ExpiresAt    time.Time
+	MaxViews     int64
+	PasswordHash string
+}
+
+const createShareQuery = `
+INSERT INTO item_shares (id, created_at, item_id, user_id, token, expires_at, max_views, password_hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, created_at, item_id, user_id, token, expires_at, max_views, view_count, password_hash;
+`
+
+func (sr *ShareRepository) CreateShare(ctx context.Context, arg CreateShareParams) (models.Share, error) {
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return models.Share{}, err
+	}
+
+	var expiresAt int64
+	if !arg.ExpiresAt.IsZero() {
+		expiresAt = arg.ExpiresAt.Unix()
+	}
+
+	row := sr.db.QueryRowContext(
+		ctx,
+		createShareQuery,
+		uuid.String(),
+		time.Now().Unix(),
+		arg.ItemId,
+		arg.UserId,
+		arg.Token,
+		expiresAt,
+		arg.MaxViews,
+		arg.PasswordHash,
+	)
+	return scanShare(row)
+}
+
+const getShareByTokenQuery = `
+SELECT id, created_at, item_id, user_id, token, expires_at, max_views, view_count, password_hash FROM item_shares
+WHERE token = $1;
+`
+
+func (sr *ShareRepository) GetShareByToken(ctx context.Context, token string) (models.Share, error) {
+	row := sr.db.QueryRowContext(ctx, getShareByTokenQuery, token)
+	share, err := scanShare(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return share, ErrNotFound
+	}
+	return share, err
+}
+
+const listSharesForItemQuery = `
+SELECT id, created_at, item_id, user_id, token, expires_at, max_views, view_count, password_hash FROM item_shares
+WHERE item_id = $1 AND user_id = $2
+ORDER BY created_at DESC, id;
+`
+
+type ListSharesForItemParams struct {
+	ItemId string
+	UserId string
+}
+
+func (sr *ShareRepository) ListSharesForItem(ctx context.Context, arg ListSharesForItemParams) ([]models.Share, error) {
+	shares := []models.Share{}
+
+	rows, err := sr.db.QueryContext(ctx, listSharesForItemQuery, arg.ItemId, arg.UserId)
+	if err != nil {
+		return shares, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return shares, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+const countShareViewQuery = `
+UPDATE item_shares SET view_count = view_count + 1
+WHERE id = $1 AND (max_views = 0 OR view_count < max_views);
+`
+
+// CountView increments the view count of a share. It returns ErrNotFound if
+// the share does not exist or has reached its view limit, so concurrent
+// viewers can't exceed the limit.
+func (sr *ShareRepository) CountView(ctx context.Context, shareId string) error {
+	result, err := sr.db.ExecContext(ctx, countShareViewQuery, shareId)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const deleteShareForUserQuery = "DELETE FROM item_shares WHERE id = $1 AND item_id = $2 AND user_id = $3;"
+
+type DeleteShareForUserParams struct {
+	ShareId string
+	ItemId  string
+	UserId  string
+}
+
+func (sr *ShareRepository) DeleteShareForUser(ctx context.Context, arg DeleteShareForUserParams) error {
+	result, err := sr.db.ExecContext(ctx, deleteShareForUserQuery, arg.ShareId, arg.ItemId, arg.UserId)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanShare(row rowScanner) (models.Share, error) {
+	var share models.Share
+	err := row.Scan(
+		&share.Id,
+		&share.CreatedAt,
+		&share.ItemId,
+		&share.UserId,
+		&share.Token,
+		&share.ExpiresAt,
+		&share.MaxViews,
+		&share.ViewCount,
+		&share.PasswordHash,
+	)
+	share.HasPassword = len(share.PasswordHash) > 0
+	return share, err
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+func TestShareRepository(t *testing.T) {
+	runWithTestStores(t, "ShareRepositoryTest.db", func(t *testing.T, stores testStores) {
+		shareRepo, userRepo, itemRepo := stores.shares, stores.users, stores.items
+
+		shareRepoTestFunc := func(f func(*testing.T, models.Item)) func(*testing.T) {
+			return func(t *testing.T) {
+				t.Cleanup(func() {
+					userRepo.DeleteAll(context.Background())
+				})
+				testUser, err := userRepo.CreateUser(context.Background(), CreateUserParams{
+					UserName: "share_user",
+					Password: "pw",
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				testItem, err := itemRepo.CreateItem(context.Background(), CreateItemParams{
+					Content: "shared",
+					UserId:  testUser.Id,
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				f(t, testItem)
+			}
+		}
+
+		t.Run("CreateShare", shareRepoTestFunc(testCreateShare(shareRepo)))
+		t.Run("CountView", shareRepoTestFunc(testCountShareView(shareRepo)))
+		t.Run("DeleteShareForUser", shareRepoTestFunc(testDeleteShareForUser(shareRepo)))
+	})
+}
+
+func testCreateShare(repo ShareStore) func(*testing.T, models.Item) {
+	return func(t *testing.T, testItem models.Item) {
+		ctx := context.Background()
+
+		created, err := repo.CreateShare(ctx, CreateShareParams{
+			ItemId:       testItem.Id,
+			UserId:       testItem.UserId,
+			Token:        "token_1",
+			MaxViews:     3,
+			PasswordHash: "hash",
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !created.HasPassword || created.MaxViews != 3 || created.ViewCount != 0 {
+			t.Errorf("Share not stored correctly. Got: %v", created)
+		}
+
+		share, err := repo.GetShareByToken(ctx, "token_1")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if share != created {
+			t.Errorf("Share did not match. Expected: %v. Got: %v", created, share)
+		}
+
+		shares, err := repo.ListSharesForItem(ctx, ListSharesForItemParams{ItemId: testItem.Id, UserId: "other"})
+		if err != nil || len(shares) != 0 {
+			t.Errorf("Expected no shares for other user. Got: %v, %v", shares, err)
+		}
+
+		if _, err := repo.GetShareByToken(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound'. Got: ", err)
+		}
+	}
+}
+
+func testCountShareView(repo ShareStore) func(*testing.T, models.Item) {
+	return func(t *testing.T, testItem models.Item) {
+		ctx := context.Background()
+
+		share, err := repo.CreateShare(ctx, CreateShareParams{
+			ItemId:   testItem.Id,
+			UserId:   testItem.UserId,
+			Token:    "token_2",
+			MaxViews: 2,
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		for range 2 {
+			if err := repo.CountView(ctx, share.Id); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		if err := repo.CountView(ctx, share.Id); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound' after max views. Got: ", err)
+		}
+
+		share, err = repo.GetShareByToken(ctx, "token_2")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if share.ViewCount != 2 || !share.IsUsedUp() {
+			t.Errorf("Expected used up share. Got: %v", share)
+		}
+	}
+}
+
+func testDeleteShareForUser(repo ShareStore) func(*testing.T, models.Item) {
+	return func(t *testing.T, testItem models.Item) {
+		ctx := context.Background()
+
+		share, err := repo.CreateShare(ctx, CreateShareParams{
+			ItemId: testItem.Id,
+			UserId: testItem.UserId,
+			Token:  "token_3",
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		params := DeleteShareForUserParams{ShareId: share.Id, ItemId: testItem.Id, UserId: "other"}
+		if err := repo.DeleteShareForUser(ctx, params); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound'. Got: ", err)
+		}
+
+		params.UserId = testItem.UserId
+		if err := repo.DeleteShareForUser(ctx, params); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := repo.GetShareByToken(ctx, "token_3"); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound' after deletion. Got: ", err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+// UserStore is implemented by UserRepository and MemoryUserRepository.
+type UserStore interface {
+	GetUserCount(ctx context.Context) (int, error)
+	CreateUser(ctx context.Context, arg CreateUserParams) (models.User, error)
+	GetUserById(ctx context.Context, id string) (models.User, error)
+	GetUserByName(ctx context.Context, name string) (models.User, error)
+	ListUsers(ctx context.Context) ([]models.User, error)
+	UpdatePassword(ctx context.Context, args UpdateUserPasswordParams) error
+	UpdateUserName(ctx context.Context, args UpdateUserNameParams) error
+	UpdateRole(ctx context.Context, args UpdateUserRoleParams) error
+	SetTotpSecret(ctx context.Context, args SetTotpSecretParams) error
+	UseTotpStep(ctx context.Context, args UseTotpStepParams) error
+	DisableTotp(ctx context.Context, userId string) error
+	DeleteUserById(ctx context.Context, id string) error
+	DeleteAll(ctx context.Context) error
+}
+
+// SessionStore is implemented by SessionRepository and
+// MemorySessionRepository.
+type SessionStore interface {
+	CreateSession(ctx context.Context, arg CreateSessionParams) (models.Session, error)
+	GetSessionByToken(ctx context.Context, sessionToken string) (models.Session, error)
+	UpdateSessionActivity(ctx context.Context, arg UpdateSessionActivityParams) error
+	ListSessionsForUser(ctx context.Context, userId string) ([]models.Session, error)
+	DeleteSessionForUser(ctx context.Context, arg DeleteSessionForUserParams) error
+	DeleteOtherSessionsForUser(ctx context.Context, arg DeleteOtherSessionsForUserParams) error
+	DeleteSessionWithToken(ctx context.Context, sessionToken string) error
+	DeleteAll(ctx context.Context) error
+	DeleteExpired(ctx context.Context) error
+}
+
+// ItemStore is implemented by ItemRepository and MemoryItemRepository.
+type ItemStore interface {
+	CreateItem(ctx context.Context, arg CreateItemParams) (models.Item, error)
+	GetItemById(ctx context.Context, itemId string) (models.Item, error)
+	GetItemForUser(ctx context.Context, arg GetItemForUserParams) (models.Item, error)
+	ListItemsForUser(ctx context.Context, arg ListItemsForUserParams) (models.ItemPage, error)
+	ListItemsForUserCreatedSince(ctx context.Context, arg ListItemsForUserCreatedSinceParams) ([]models.Item, error)
+	SearchItemsForUser(ctx context.Context, arg SearchItemsForUserParams) ([]models.ItemSearchResult, error)
+	UpdateItemForUser(ctx context.Context, arg UpdateItemForUserParams) (models.Item, error)
+	ListItemRevisionsForUser(ctx context.Context, arg ListItemRevisionsForUserParams) ([]models.ItemRevision, error)
+	GetItemRevisionForUser(ctx context.Context, arg GetItemRevisionForUserParams) (models.ItemRevision, error)
+	GetAttachmentForUser(ctx context.Context, arg GetAttachmentForUserParams) (models.Attachment, error)
+	DeleteItemForUser(ctx context.Context, arg DeleteUserItemParams) error
+	DeleteExpired(ctx context.Context) ([]models.Item, error)
+	DeleteAll(ctx context.Context) error
+}
+
+// ApiTokenStore is implemented by ApiTokenRepository and
+// MemoryApiTokenRepository.
+type ApiTokenStore interface {
+	CreateApiToken(ctx context.Context, arg CreateApiTokenParams) (models.ApiToken, error)
+	GetApiTokenByHash(ctx context.Context, tokenHash string) (models.ApiToken, error)
+	ListApiTokensForUser(ctx context.Context, userId string) ([]models.ApiToken, error)
+	UpdateLastUsed(ctx context.Context, tokenId string, lastUsedAt time.Time) error
+	DeleteApiTokenForUser(ctx context.Context, arg DeleteApiTokenForUserParams) error
+}
+
+// LoginAttemptStore is implemented by LoginAttemptRepository and
+// MemoryLoginAttemptRepository.
+type LoginAttemptStore interface {
+	GetLoginAttempt(ctx context.Context, arg GetLoginAttemptParams) (models.LoginAttempt, error)
+	RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (models.LoginAttempt, error)
+	LockLoginAttempt(ctx context.Context, arg LockLoginAttemptParams) error
+	DeleteLoginAttempt(ctx context.Context, arg GetLoginAttemptParams) error
+	ListLocked(ctx context.Context, scope models.LoginAttemptScope) ([]models.LoginAttempt, error)
+	DeleteStale(ctx context.Context, failedBefore time.Time) error
+}
+
+// TwoFactorStore is implemented by TwoFactorRepository and
+// MemoryTwoFactorRepository.
+type TwoFactorStore interface {
+	ReplaceRecoveryCodes(ctx context.Context, arg ReplaceRecoveryCodesParams) error
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) error
+	CountRecoveryCodes(ctx context.Context, userId string) (int, error)
+	DeleteRecoveryCodes(ctx context.Context, userId string) error
+	CreateLoginChallenge(ctx context.Context, arg CreateLoginChallengeParams) (models.LoginChallenge, error)
+	GetLoginChallengeByHash(ctx context.Context, tokenHash string) (models.LoginChallenge, error)
+	DeleteLoginChallenge(ctx context.Context, tokenHash string) error
+	DeleteExpiredLoginChallenges(ctx context.Context) error
+}
+
+// WorkspaceStore is implemented by WorkspaceRepository and
+// MemoryWorkspaceRepository.
+type WorkspaceStore interface {
+	CreateWorkspace(ctx context.Context, arg CreateWorkspaceParams) (models.Workspace, error)
+	ListWorkspacesForUser(ctx context.Context, userId string) ([]models.Workspace, error)
+	GetWorkspaceForUser(ctx context.Context, arg GetWorkspaceForUserParams) (models.Workspace, error)
+	ListMembers(ctx context.Context, workspaceId string) ([]models.WorkspaceMember, error)
+	AddMember(ctx context.Context, arg AddWorkspaceMemberParams) error
+	RemoveMember(ctx context.Context, arg RemoveWorkspaceMemberParams) error
+	DeleteWorkspace(ctx context.Context, workspaceId string) error
+}
+
+// ShareStore is implemented by ShareRepository and MemoryShareRepository.
+type ShareStore interface {
+	CreateShare(ctx context.Context, arg CreateShareParams) (models.Share, error)
+	GetShareByToken(ctx context.Context, token string) (models.Share, error)
+	ListSharesForItem(ctx context.Context, arg ListSharesForItemParams) ([]models.Share, error)
+	CountView(ctx context.Context, shareId string) error
+	DeleteShareForUser(ctx context.Context, arg DeleteShareForUserParams) error
+}
+
+// IdentityStore is implemented by IdentityRepository and
+// MemoryIdentityRepository.
+type IdentityStore interface {
+	CreateIdentity(ctx context.Context, arg CreateIdentityParams) (models.Identity, error)
+	GetIdentity(ctx context.Context, arg GetIdentityParams) (models.Identity, error)
+}
+
+var (
+	_ UserStore    = (*UserRepository)(nil)
+	_ UserStore    = (*MemoryUserRepository)(nil)
+	_ SessionStore = (*SessionRepository)(nil)
+	_ SessionStore = (*MemorySessionRepository)(nil)
+	_ ItemStore    = (*ItemRepository)(nil)
+	_ ItemStore    = (*MemoryItemRepository)(nil)
+
+	_ ApiTokenStore     = (*ApiTokenRepository)(nil)
+	_ ApiTokenStore     = (*MemoryApiTokenRepository)(nil)
+	_ LoginAttemptStore = (*LoginAttemptRepository)(nil)
+	_ LoginAttemptStore = (*MemoryLoginAttemptRepository)(nil)
+	_ TwoFactorStore    = (*TwoFactorRepository)(nil)
+	_ TwoFactorStore    = (*MemoryTwoFactorRepository)(nil)
+	_ WorkspaceStore    = (*WorkspaceRepository)(nil)
+	_ WorkspaceStore    = (*MemoryWorkspaceRepository)(nil)
+	_ ShareStore        = (*ShareRepository)(nil)
+	_ ShareStore        = (*MemoryShareRepository)(nil)
+	_ IdentityStore     = (*IdentityRepository)(nil)
+	_ IdentityStore     = (*MemoryIdentityRepository)(nil)
+)
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeleteUserCascades(t *testing.T) {
+	runWithTestStores(t, "StoreTest_deleteUser.db", func(t *testing.T, stores testStores) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			stores.users.DeleteAll(ctx)
+		})
+
+		user, err := stores.users.CreateUser(ctx, CreateUserParams{UserName: "cascade_user", Password: "pw"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = stores.sessions.CreateSession(ctx, CreateSessionParams{
+			Token:     "cascade_token",
+			ExpiresAt: time.Now().Add(time.Minute),
+			UserId:    user.Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		item, err := stores.items.CreateItem(ctx, CreateItemParams{
+			Content: "content",
+			UserId:  user.Id,
+			Attachments: []CreateAttachmentParams{
+				{FileName: "a.txt", MimeType: "text/plain", Data: []byte("a")},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := stores.apiTokens.CreateApiToken(ctx, CreateApiTokenParams{
+			UserId:    user.Id,
+			Name:      "cascade",
+			TokenHash: "cascade_token_hash",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		share, err := stores.shares.CreateShare(ctx, CreateShareParams{
+			ItemId: item.Id,
+			UserId: user.Id,
+			Token:  "cascade_share",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		workspace, err := stores.workspaces.CreateWorkspace(ctx, CreateWorkspaceParams{
+			Name:    "cascade",
+			OwnerId: user.Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		workspaceItem, err := stores.items.CreateItem(ctx, CreateItemParams{
+			Content:     "workspace content",
+			UserId:      user.Id,
+			WorkspaceId: workspace.Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		identity := GetIdentityParams{Issuer: "https://issuer", Subject: "cascade"}
+		_, err = stores.identities.CreateIdentity(ctx, CreateIdentityParams{
+			Issuer:  identity.Issuer,
+			Subject: identity.Subject,
+			UserId:  user.Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = stores.twoFactor.ReplaceRecoveryCodes(ctx, ReplaceRecoveryCodesParams{
+			UserId:     user.Id,
+			CodeHashes: []string{"cascade_code"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = stores.twoFactor.CreateLoginChallenge(ctx, CreateLoginChallengeParams{
+			TokenHash: "cascade_challenge",
+			UserId:    user.Id,
+			ExpiresAt: time.Now().Add(time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := stores.users.DeleteUserById(ctx, user.Id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.sessions.GetSessionByToken(ctx, "cascade_token"); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected session to be deleted with user. Got: ", err)
+		}
+		if _, err := stores.items.GetItemById(ctx, item.Id); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected item to be deleted with user. Got: ", err)
+		}
+		if _, err := stores.apiTokens.GetApiTokenByHash(ctx, token.TokenHash); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected api token to be deleted with user. Got: ", err)
+		}
+		if _, err := stores.shares.GetShareByToken(ctx, share.Token); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected share to be deleted with user. Got: ", err)
+		}
+		if _, err := stores.items.GetItemById(ctx, workspaceItem.Id); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected workspace item to be deleted with owner. Got: ", err)
+		}
+		if _, err := stores.identities.GetIdentity(ctx, identity); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected identity to be deleted with user. Got: ", err)
+		}
+		if count, err := stores.twoFactor.CountRecoveryCodes(ctx, user.Id); err != nil || count != 0 {
+			t.Errorf("Expected recovery codes to be deleted with user. Got: %d %v", count, err)
+		}
+		if _, err := stores.twoFactor.GetLoginChallengeByHash(ctx, "cascade_challenge"); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected login challenge to be deleted with user. Got: ", err)
+		}
+	})
+}
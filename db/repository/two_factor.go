@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+type TwoFactorRepository struct {
+	db *sql.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db}
+}
+
+type ReplaceRecoveryCodesParams struct {
+	UserId     string
+	CodeHashes []string
+}
+
+const (
+	deleteRecoveryCodesQuery = "DELETE FROM recovery_codes WHERE user_id = $1;"
+	createRecoveryCodeQuery  = `
+INSERT INTO recovery_codes (code_hash, user_id, created_at)
+VALUES ($1, $2, $3);
+`
+)
+
+// ReplaceRecoveryCodes invalidates the recovery codes of a user and stores the
+// new ones.
+func (tr *TwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, arg ReplaceRecoveryCodesParams) error {
+	tx, err := tr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, deleteRecoveryCodesQuery, arg.UserId); err != nil {
+		return err
+	}
+	createdAt := time.Now().Unix()
+	for _, codeHash := range arg.CodeHashes {
+		if _, err := tx.ExecContext(ctx, createRecoveryCodeQuery, codeHash, arg.UserId, createdAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type UseRecoveryCodeParams struct {
+	UserId   string
+	CodeHash string
+}
+
+const useRecoveryCodeQuery = "DELETE FROM recovery_codes WHERE user_id = $1 AND code_hash = $2;"
+
+// UseRecoveryCode consumes a recovery code. It returns ErrNotFound if the user
+// has no such code.
+func (tr *TwoFactorRepository) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) error {
+	result, err := tr.db.ExecContext(ctx, useRecoveryCodeQuery, arg.UserId, arg.CodeHash)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const countRecoveryCodesQuery = "SELECT COUNT(1) FROM recovery_codes WHERE user_id = $1;"
+
+func (tr *TwoFactorRepository) CountRecoveryCodes(ctx context.Context, userId string) (int, error) {
+	var count int
+	err := tr.db.QueryRowContext(ctx, countRecoveryCodesQuery, userId).Scan(&count)
+	return count, err
+}
+
+func (tr *TwoFactorRepository) DeleteRecoveryCodes(ctx context.Context, userId string) error {
+	_, err := tr.db.ExecContext(ctx, deleteRecoveryCodesQuery, userId)
+	return err
+}
+
+type CreateLoginChallengeParams struct {
+	TokenHash string
+	UserId    string
+	ExpiresAt time.Time
+	Remember  bool
+	UserAgent string
+	IpAddress string
+}
+
+const loginChallengeColumns = "token_hash, user_id, created_at, expires_at, remember, user_agent, ip_address"
+
+const createLoginChallengeQuery = `
+INSERT INTO login_challenges (` + loginChallengeColumns + `)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING ` + loginChallengeColumns + ";"
+
+func (tr *TwoFactorRepository) CreateLoginChallenge(
+	ctx context.Context,
+	arg CreateLoginChallengeParams,
+) (models.LoginChallenge, error) {
+	row := tr.db.QueryRowContext(
+		ctx,
+		createLoginChallengeQuery,
+		arg.TokenHash,
+		arg.UserId,
+		time.Now().Unix(),
+		arg.ExpiresAt.Unix(),
+		arg.Remember,
+		arg.UserAgent,
+		arg.IpAddress,
+	)
+	return scanLoginChallenge(row)
+}
+
+const getLoginChallengeByHashQuery = `
+SELECT ` + loginChallengeColumns + ` FROM login_challenges
+WHERE token_hash = $1;
+`
+
+func (tr *TwoFactorRepository) GetLoginChallengeByHash(
+	ctx context.Context,
+	tokenHash string,
+) (models.LoginChallenge, error) {
+	row := tr.db.QueryRowContext(ctx, getLoginChallengeByHashQuery, tokenHash)
+	challenge, err := scanLoginChallenge(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return challenge, ErrNotFound
+	}
+	return challenge, err
+}
+
+const deleteLoginChallengeQuery = "DELETE FROM login_challenges WHERE token_hash = $1;"
+
+func (tr *TwoFactorRepository) DeleteLoginChallenge(ctx context.Context, tokenHash string) error {
+	_, err := tr.db.ExecContext(ctx, deleteLoginChallengeQuery, tokenHash)
+	return err
+}
+
+const deleteExpiredLoginChallengesQuery = "DELETE FROM login_challenges WHERE expires_at <= $1;"
+
+func (tr *TwoFactorRepository) DeleteExpiredLoginChallenges(ctx context.Context) error {
+	_, err := tr.db.ExecContext(ctx, deleteExpiredLoginChallengesQuery, time.Now().Unix())
+	return err
+}
+
+func scanLoginChallenge(row rowScanner) (models.LoginChallenge, error) {
+	var challenge models.LoginChallenge
+	err := row.Scan(
+		&challenge.TokenHash,
+		&challenge.UserId,
+		&challenge.CreatedAt,
+		&challenge.ExpiresAt,
+		&challenge.Remember,
+		&challenge.UserAgent,
+		&challenge.IpAddress,
+	)
+	return challenge, err
+}
@@ -32,16 +32,25 @@ func (ur *UserRepository) GetUserCount(ctx context.Context) (int, error) {
 	return count, err
 }
 
+const userColumns = "id, created_at, user_name, password_hash, role, totp_secret, totp_enabled, totp_last_step"
+
 const createUserQuery = `
 INSERT INTO users (id, created_at, user_name, password_hash, role)
 VALUES ($1, $2, $3, $4, $5)
-RETURNING id, created_at, user_name, password_hash, role;
-`
+RETURNING ` + userColumns + ";"
 
 type CreateUserParams struct {
 	UserName string
 	Password string
 	Role     models.Role
+	// Identity, if set, links the new user to the subject of an identity
+	// provider. The user is only created if the identity doesn't exist yet.
+	Identity *UserIdentityParams
+}
+
+type UserIdentityParams struct {
+	Issuer  string
+	Subject string
 }
 
 func (ur *UserRepository) CreateUser(ctx context.Context, arg CreateUserParams) (models.User, error) {
@@ -66,7 +75,25 @@ func (ur *UserRepository) CreateUser(ctx context.Context, arg CreateUserParams)
 		return user, err
 	}
 
-	row := ur.db.QueryRowContext(
+	if arg.Identity == nil {
+		row := ur.db.QueryRowContext(
+			ctx,
+			createUserQuery,
+			id, createdAt,
+			arg.UserName,
+			passwordHash,
+			role,
+		)
+		return scanUser(row)
+	}
+
+	tx, err := ur.db.BeginTx(ctx, nil)
+	if err != nil {
+		return user, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(
 		ctx,
 		createUserQuery,
 		id, createdAt,
@@ -74,33 +101,40 @@ func (ur *UserRepository) CreateUser(ctx context.Context, arg CreateUserParams)
 		passwordHash,
 		role,
 	)
-	err = row.Scan(&user.Id, &user.CreatedAt, &user.UserName, &user.PasswordHash, &user.Role)
-	return user, err
+	if user, err = scanUser(row); err != nil {
+		return user, err
+	}
+	_, err = tx.ExecContext(ctx, createIdentityQuery, arg.Identity.Issuer, arg.Identity.Subject, user.Id, createdAt)
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, tx.Commit()
 }
 
 const getUserByIdQuery = `
-SELECT id, created_at, user_name, password_hash, role FROM users
+SELECT ` + userColumns + ` FROM users
 WHERE id = $1
 LIMIT 1;
 `
 
 func (ur *UserRepository) GetUserById(ctx context.Context, id string) (models.User, error) {
 	row := ur.db.QueryRowContext(ctx, getUserByIdQuery, id)
-	var user models.User
-	err := row.Scan(&user.Id, &user.CreatedAt, &user.UserName, &user.PasswordHash, &user.Role)
+	user, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNotFound
+	}
 	return user, err
 }
 
 const getUserByNameQuery = `
-SELECT id, created_at, user_name, password_hash, role FROM users
+SELECT ` + userColumns + ` FROM users
 WHERE user_name = $1
 LIMIT 1;
 `
 
 func (ur *UserRepository) GetUserByName(ctx context.Context, name string) (models.User, error) {
 	row := ur.db.QueryRowContext(ctx, getUserByNameQuery, name)
-	var user models.User
-	err := row.Scan(&user.Id, &user.CreatedAt, &user.UserName, &user.PasswordHash, &user.Role)
+	user, err := scanUser(row)
 	if errors.Is(err, sql.ErrNoRows) {
 		return user, ErrNotFound
 	}
@@ -108,7 +142,7 @@ func (ur *UserRepository) GetUserByName(ctx context.Context, name string) (model
 }
 
 const listUsersQuery = `
-SELECT id, created_at, user_name, password_hash, role FROM users
+SELECT ` + userColumns + ` FROM users
 ORDER BY user_name;
 `
 
@@ -122,8 +156,8 @@ func (ur *UserRepository) ListUsers(ctx context.Context) ([]models.User, error)
 
 	var users []models.User
 	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.Id, &user.CreatedAt, &user.UserName, &user.PasswordHash, &user.Role); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -162,6 +196,74 @@ func (ur *UserRepository) UpdateUserName(ctx context.Context, args UpdateUserNam
 	return err
 }
 
+type UpdateUserRoleParams struct {
+	UserId string
+	Role   models.Role
+}
+
+const updateUserRoleQuery = "UPDATE users SET role = $1 WHERE id = $2;"
+
+func (ur *UserRepository) UpdateRole(ctx context.Context, args UpdateUserRoleParams) error {
+	_, err := ur.db.ExecContext(ctx, updateUserRoleQuery, args.Role, args.UserId)
+	return err
+}
+
+type SetTotpSecretParams struct {
+	UserId string
+	Secret string
+}
+
+const setTotpSecretQuery = `
+UPDATE users SET totp_secret = $1, totp_enabled = FALSE, totp_last_step = 0
+WHERE id = $2;
+`
+
+// SetTotpSecret stores the secret of an enrollment that has not been confirmed
+// yet and disables two-factor authentication until it is.
+func (ur *UserRepository) SetTotpSecret(ctx context.Context, args SetTotpSecretParams) error {
+	_, err := ur.db.ExecContext(ctx, setTotpSecretQuery, args.Secret, args.UserId)
+	return err
+}
+
+type UseTotpStepParams struct {
+	UserId string
+	Step   int64
+	// Enable turns on two-factor authentication with the first valid code.
+	Enable bool
+}
+
+const useTotpStepQuery = `
+UPDATE users SET totp_last_step = $1, totp_enabled = totp_enabled OR $2
+WHERE id = $3 AND totp_secret != '' AND totp_last_step < $4;
+`
+
+// UseTotpStep records the time step of an accepted code. It returns
+// ErrNotFound if a code of the step or a later one has been used before.
+func (ur *UserRepository) UseTotpStep(ctx context.Context, args UseTotpStepParams) error {
+	result, err := ur.db.ExecContext(ctx, useTotpStepQuery, args.Step, args.Enable, args.UserId, args.Step)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const disableTotpQuery = `
+UPDATE users SET totp_secret = '', totp_enabled = FALSE, totp_last_step = 0
+WHERE id = $1;
+`
+
+func (ur *UserRepository) DisableTotp(ctx context.Context, userId string) error {
+	_, err := ur.db.ExecContext(ctx, disableTotpQuery, userId)
+	return err
+}
+
 const deleteUserByIdQuery = "DELETE FROM users WHERE id = $1;"
 
 func (ur *UserRepository) DeleteUserById(ctx context.Context, id string) error {
@@ -175,3 +277,18 @@ func (ur *UserRepository) DeleteAll(ctx context.Context) error {
 	_, err := ur.db.ExecContext(ctx, deleteAllUsersQuery)
 	return err
 }
+
+func scanUser(row rowScanner) (models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.Id,
+		&user.CreatedAt,
+		&user.UserName,
+		&user.PasswordHash,
+		&user.Role,
+		&user.TotpSecret,
+		&user.TwoFactorEnabled,
+		&user.TotpLastStep,
+	)
+	return user, err
+}
@@ -11,39 +11,30 @@ import (
 	"github.com/michaelhass/cpaw/models"
 )
 
-func createTestUserRepository(t *testing.T, name string) (*UserRepository, error) {
-	db, err := prepareTestDb(name)
-	t.Cleanup(cleanUpTestDb(name, db))
-	return NewUserRepository(db), err
-}
-
 func TestUserRepository(t *testing.T) {
-	dbName := "UserRepositoryTest_createUser.db"
-	repo, err := createTestUserRepository(t, dbName)
-	t.Cleanup(cleanUpTestDb(dbName, repo.db))
-	if err != nil {
-		t.Error(err)
-		return
-	}
-
-	userRepoTestFunc := func(f func(*testing.T)) func(*testing.T) {
-		return func(t *testing.T) {
-			t.Cleanup(func() {
-				repo.DeleteAll(context.Background())
-			})
-			f(t)
+	runWithTestStores(t, "UserRepositoryTest_createUser.db", func(t *testing.T, stores testStores) {
+		repo := stores.users
+
+		userRepoTestFunc := func(f func(*testing.T)) func(*testing.T) {
+			return func(t *testing.T) {
+				t.Cleanup(func() {
+					repo.DeleteAll(context.Background())
+				})
+				f(t)
+			}
 		}
-	}
 
-	t.Run("CreateUser", userRepoTestFunc(testCreateUser(repo)))
-	t.Run("GetUserById", userRepoTestFunc(testGetUserById(repo)))
-	t.Run("GetUserByName", userRepoTestFunc(testGetUserByName(repo)))
-	t.Run("ListUsers", userRepoTestFunc(testListUsers(repo)))
-	t.Run("UpdatePassword", userRepoTestFunc(testUpdatePassword(repo)))
-	t.Run("UpdateName", userRepoTestFunc(testUpdateUserName(repo)))
+		t.Run("CreateUser", userRepoTestFunc(testCreateUser(repo)))
+		t.Run("GetUserById", userRepoTestFunc(testGetUserById(repo)))
+		t.Run("GetUserByName", userRepoTestFunc(testGetUserByName(repo)))
+		t.Run("ListUsers", userRepoTestFunc(testListUsers(repo)))
+		t.Run("UpdatePassword", userRepoTestFunc(testUpdatePassword(repo)))
+		t.Run("UpdateName", userRepoTestFunc(testUpdateUserName(repo)))
+		t.Run("CreateUserWithIdentity", userRepoTestFunc(testCreateUserWithIdentity(repo, stores.identities)))
+	})
 }
 
-func createTestUsers(ctx context.Context, repo *UserRepository, count int) ([]models.User, error) {
+func createTestUsers(ctx context.Context, repo UserStore, count int) ([]models.User, error) {
 	users := make([]models.User, count)
 	for i := range users {
 		var params CreateUserParams
@@ -58,7 +49,7 @@ func createTestUsers(ctx context.Context, repo *UserRepository, count int) ([]mo
 	return users, nil
 }
 
-func testCreateUser(repo *UserRepository) func(*testing.T) {
+func testCreateUser(repo UserStore) func(*testing.T) {
 	return func(t *testing.T) {
 		params := CreateUserParams{
 			UserName: "test_name",
@@ -87,7 +78,7 @@ func testCreateUser(repo *UserRepository) func(*testing.T) {
 	}
 }
 
-func testGetUserById(repo *UserRepository) func(*testing.T) {
+func testGetUserById(repo UserStore) func(*testing.T) {
 	return func(t *testing.T) {
 		ctx := context.Background()
 
@@ -114,7 +105,7 @@ func testGetUserById(repo *UserRepository) func(*testing.T) {
 	}
 }
 
-func testGetUserByName(repo *UserRepository) func(*testing.T) {
+func testGetUserByName(repo UserStore) func(*testing.T) {
 	return func(t *testing.T) {
 		ctx := context.Background()
 
@@ -142,7 +133,7 @@ func testGetUserByName(repo *UserRepository) func(*testing.T) {
 	}
 }
 
-func testListUsers(repo *UserRepository) func(*testing.T) {
+func testListUsers(repo UserStore) func(*testing.T) {
 	return func(t *testing.T) {
 		ctx := context.Background()
 
@@ -159,7 +150,7 @@ func testListUsers(repo *UserRepository) func(*testing.T) {
 	}
 }
 
-func testUpdatePassword(repo *UserRepository) func(*testing.T) {
+func testUpdatePassword(repo UserStore) func(*testing.T) {
 	return func(t *testing.T) {
 		ctx := context.Background()
 
@@ -190,7 +181,7 @@ func testUpdatePassword(repo *UserRepository) func(*testing.T) {
 	}
 }
 
-func testUpdateUserName(repo *UserRepository) func(*testing.T) {
+func testUpdateUserName(repo UserStore) func(*testing.T) {
 	return func(t *testing.T) {
 		ctx := context.Background()
 
@@ -235,3 +226,27 @@ func testUpdateUserName(repo *UserRepository) func(*testing.T) {
 		}
 	}
 }
+
+func testCreateUserWithIdentity(repo UserStore, identities IdentityStore) func(*testing.T) {
+	return func(t *testing.T) {
+		ctx := context.Background()
+		identity := &UserIdentityParams{Issuer: "https://issuer", Subject: "subject"}
+
+		user, err := repo.CreateUser(ctx, CreateUserParams{UserName: "first", Password: "pw", Identity: identity})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := identities.GetIdentity(ctx, GetIdentityParams{Issuer: identity.Issuer, Subject: identity.Subject})
+		if err != nil || got.UserId != user.Id {
+			t.Errorf("Expected identity of user %s. Got: %v, %v", user.Id, got, err)
+		}
+
+		_, err = repo.CreateUser(ctx, CreateUserParams{UserName: "second", Password: "pw", Identity: identity})
+		if err == nil {
+			t.Error("Expected error for existing identity")
+		}
+		if _, err := repo.GetUserByName(ctx, "second"); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected no user for existing identity. Got: ", err)
+		}
+	}
+}
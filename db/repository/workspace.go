@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/michaelhass/cpaw/models"
+)
+
+var ErrAlreadyMember = errors.New("User is already a member")
+
+type WorkspaceRepository struct {
+	db *sql.DB
+}
+
+func NewWorkspaceRepository(db *sql.DB) *WorkspaceRepository {
+	return &WorkspaceRepository{db: db}
+}
+
+type CreateWorkspaceParams struct {
+	Name    string
+	OwnerId string
+}
+
+const createWorkspaceQuery = `
+INSERT INTO workspaces (id, created_at, name, owner_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, name, owner_id;
+`
+
+const addWorkspaceMemberQuery = `
+INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (workspace_id, user_id) DO NOTHING;
+`
+
+// CreateWorkspace creates a workspace with its owner as first member.
+func (wr *WorkspaceRepository) CreateWorkspace(ctx context.Context, arg CreateWorkspaceParams) (models.Workspace, error) {
+	var workspace models.Workspace
+
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return workspace, err
+	}
+	createdAt := time.Now().Unix()
+
+	tx, err := wr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return workspace, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, createWorkspaceQuery, uuid.String(), createdAt, arg.Name, arg.OwnerId)
+	err = row.Scan(&workspace.Id, &workspace.CreatedAt, &workspace.Name, &workspace.OwnerId)
+	if err != nil {
+		return workspace, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		addWorkspaceMemberQuery,
+		workspace.Id,
+		arg.OwnerId,
+		models.WorkspaceOwnerRole,
+		createdAt,
+	)
+	if err != nil {
+		return models.Workspace{}, err
+	}
+	workspace.Role = models.WorkspaceOwnerRole
+
+	return workspace, tx.Commit()
+}
+
+const listWorkspacesForUserQuery = `
+SELECT w.id, w.created_at, w.name, w.owner_id, m.role FROM workspaces w
+INNER JOIN workspace_members m ON m.workspace_id = w.id
+WHERE m.user_id = $1
+ORDER BY w.name, w.id;
+`
+
+func (wr *WorkspaceRepository) ListWorkspacesForUser(ctx context.Context, userId string) ([]models.Workspace, error) {
+	workspaces := []models.Workspace{}
+
+	rows, err := wr.db.QueryContext(ctx, listWorkspacesForUserQuery, userId)
+	if err != nil {
+		return workspaces, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		workspace, err := scanWorkspace(rows)
+		if err != nil {
+			return workspaces, err
+		}
+		workspaces = append(workspaces, workspace)
+	}
+	return workspaces, rows.Err()
+}
+
+const getWorkspaceForUserQuery = `
+SELECT w.id, w.created_at, w.name, w.owner_id, m.role FROM workspaces w
+INNER JOIN workspace_members m ON m.workspace_id = w.id
+WHERE w.id = $1 AND m.user_id = $2;
+`
+
+type GetWorkspaceForUserParams struct {
+	WorkspaceId string
+	UserId      string
+}
+
+// GetWorkspaceForUser returns a workspace the user is a member of together
+// with the user's role. It returns ErrNotFound for non-members.
+func (wr *WorkspaceRepository) GetWorkspaceForUser(
+	ctx context.Context,
+	arg GetWorkspaceForUserParams,
+) (models.Workspace, error) {
+	row := wr.db.QueryRowContext(ctx, getWorkspaceForUserQuery, arg.WorkspaceId, arg.UserId)
+	workspace, err := scanWorkspace(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return workspace, ErrNotFound
+	}
+	return workspace, err
+}
+
+const listWorkspaceMembersQuery = `
+SELECT m.workspace_id, m.user_id, u.user_name, m.role, m.created_at FROM workspace_members m
+INNER JOIN users u ON u.id = m.user_id
+WHERE m.workspace_id = $1
+ORDER BY m.role DESC, u.user_name;
+`
+
+func (wr *WorkspaceRepository) ListMembers(ctx context.Context, workspaceId string) ([]models.WorkspaceMember, error) {
+	members := []models.WorkspaceMember{}
+
+	rows, err := wr.db.QueryContext(ctx, listWorkspaceMembersQuery, workspaceId)
+	if err != nil {
+		return members, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member models.WorkspaceMember
+		err := rows.Scan(
+			&member.WorkspaceId,
+			&member.UserId,
+			&member.UserName,
+			&member.Role,
+			&member.CreatedAt,
+		)
+		if err != nil {
+			return members, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+type AddWorkspaceMemberParams struct {
+	WorkspaceId string
+	UserId      string
+	Role        models.WorkspaceRole
+}
+
+func (wr *WorkspaceRepository) AddMember(ctx context.Context, arg AddWorkspaceMemberParams) error {
+	result, err := wr.db.ExecContext(
+		ctx,
+		addWorkspaceMemberQuery,
+		arg.WorkspaceId,
+		arg.UserId,
+		arg.Role,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAlreadyMember
+	}
+	return nil
+}
+
+const removeWorkspaceMemberQuery = "DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2;"
+
+type RemoveWorkspaceMemberParams struct {
+	WorkspaceId string
+	UserId      string
+}
+
+func (wr *WorkspaceRepository) RemoveMember(ctx context.Context, arg RemoveWorkspaceMemberParams) error {
+	result, err := wr.db.ExecContext(ctx, removeWorkspaceMemberQuery, arg.WorkspaceId, arg.UserId)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const deleteWorkspaceQuery = "DELETE FROM workspaces WHERE id = $1;"
+
+// DeleteWorkspace deletes a workspace including its items.
+func (wr *WorkspaceRepository) DeleteWorkspace(ctx context.Context, workspaceId string) error {
+	_, err := wr.db.ExecContext(ctx, deleteWorkspaceQuery, workspaceId)
+	return err
+}
+
+func scanWorkspace(row rowScanner) (models.Workspace, error) {
+	var workspace models.Workspace
+	err := row.Scan(
+		&workspace.Id,
+		&workspace.CreatedAt,
+		&workspace.Name,
+		&workspace.OwnerId,
+		&workspace.Role,
+	)
+	return workspace, err
+}
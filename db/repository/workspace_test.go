@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+func TestWorkspaceRepository(t *testing.T) {
+	runWithTestStores(t, "WorkspaceRepositoryTest.db", func(t *testing.T, stores testStores) {
+		workspaceRepo, userRepo := stores.workspaces, stores.users
+
+		workspaceRepoTestFunc := func(f func(*testing.T, models.User, models.User)) func(*testing.T) {
+			return func(t *testing.T) {
+				t.Cleanup(func() {
+					userRepo.DeleteAll(context.Background())
+				})
+				owner, err := userRepo.CreateUser(context.Background(), CreateUserParams{
+					UserName: "workspace_owner",
+					Password: "pw",
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				member, err := userRepo.CreateUser(context.Background(), CreateUserParams{
+					UserName: "workspace_member",
+					Password: "pw",
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				f(t, owner, member)
+			}
+		}
+
+		t.Run("Membership", workspaceRepoTestFunc(testWorkspaceMembership(workspaceRepo)))
+		t.Run("Items", workspaceRepoTestFunc(testWorkspaceItems(workspaceRepo, stores.items)))
+	})
+}
+
+func testWorkspaceMembership(repo WorkspaceStore) func(*testing.T, models.User, models.User) {
+	return func(t *testing.T, owner models.User, member models.User) {
+		ctx := context.Background()
+
+		workspace, err := repo.CreateWorkspace(ctx, CreateWorkspaceParams{Name: "team", OwnerId: owner.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if workspace.Role != models.WorkspaceOwnerRole {
+			t.Errorf("Expected owner role. Got: %s", workspace.Role)
+		}
+
+		params := GetWorkspaceForUserParams{WorkspaceId: workspace.Id, UserId: member.Id}
+		if _, err := repo.GetWorkspaceForUser(ctx, params); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound' for non-member. Got: ", err)
+		}
+
+		addParams := AddWorkspaceMemberParams{
+			WorkspaceId: workspace.Id,
+			UserId:      member.Id,
+			Role:        models.WorkspaceMemberRole,
+		}
+		if err := repo.AddMember(ctx, addParams); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := repo.AddMember(ctx, addParams); !errors.Is(err, ErrAlreadyMember) {
+			t.Error("Expected 'ErrAlreadyMember'. Got: ", err)
+		}
+
+		got, err := repo.GetWorkspaceForUser(ctx, params)
+		if err != nil || got.Role != models.WorkspaceMemberRole {
+			t.Errorf("Expected member role. Got: %v %v", got, err)
+		}
+		workspaces, err := repo.ListWorkspacesForUser(ctx, member.Id)
+		if err != nil || len(workspaces) != 1 || workspaces[0].Id != workspace.Id {
+			t.Errorf("Expected workspace of member. Got: %v %v", workspaces, err)
+		}
+		members, err := repo.ListMembers(ctx, workspace.Id)
+		if err != nil || len(members) != 2 || members[0].UserId != owner.Id {
+			t.Errorf("Expected owner and member. Got: %v %v", members, err)
+		}
+
+		removeParams := RemoveWorkspaceMemberParams{WorkspaceId: workspace.Id, UserId: member.Id}
+		if err := repo.RemoveMember(ctx, removeParams); err != nil {
+			t.Error(err)
+		}
+		if err := repo.RemoveMember(ctx, removeParams); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected 'ErrNotFound' for removed member. Got: ", err)
+		}
+	}
+}
+
+func testWorkspaceItems(
+	repo WorkspaceStore,
+	itemRepo ItemStore,
+) func(*testing.T, models.User, models.User) {
+	return func(t *testing.T, owner models.User, member models.User) {
+		ctx := context.Background()
+
+		workspace, err := repo.CreateWorkspace(ctx, CreateWorkspaceParams{Name: "team", OwnerId: owner.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		personal, err := itemRepo.CreateItem(ctx, CreateItemParams{Content: "personal", UserId: owner.Id})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		shared, err := itemRepo.CreateItem(ctx, CreateItemParams{
+			Content:     "shared",
+			UserId:      member.Id,
+			WorkspaceId: workspace.Id,
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if shared.WorkspaceId != workspace.Id {
+			t.Errorf("Expected workspace id %s. Got: %s", workspace.Id, shared.WorkspaceId)
+		}
+
+		page, err := itemRepo.ListItemsForUser(ctx, ListItemsForUserParams{UserId: owner.Id, Limit: 10})
+		if err != nil || len(page.Items) != 1 || page.Items[0].Id != personal.Id {
+			t.Errorf("Expected personal items only. Got: %v %v", page.Items, err)
+		}
+		page, err = itemRepo.ListItemsForUser(ctx, ListItemsForUserParams{
+			UserId:      owner.Id,
+			WorkspaceId: workspace.Id,
+			Limit:       10,
+		})
+		if err != nil || len(page.Items) != 1 || page.Items[0].Id != shared.Id {
+			t.Errorf("Expected workspace items only. Got: %v %v", page.Items, err)
+		}
+		results, err := itemRepo.SearchItemsForUser(ctx, SearchItemsForUserParams{
+			UserId:      owner.Id,
+			WorkspaceId: workspace.Id,
+			Query:       "shared",
+			Limit:       10,
+		})
+		if err != nil || len(results) != 1 || results[0].Id != shared.Id {
+			t.Errorf("Expected workspace search result. Got: %v %v", results, err)
+		}
+
+		if err := repo.DeleteWorkspace(ctx, workspace.Id); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := itemRepo.GetItemById(ctx, shared.Id); !errors.Is(err, ErrNotFound) {
+			t.Error("Expected workspace items to be deleted. Got: ", err)
+		}
+	}
+}
@@ -16,6 +16,10 @@ import (
 //go:embed migrations/*.sql
 var migrationFS embed.FS
 
+// ErrMissingFts5 is returned if SQLite was built without FTS5, which the item
+// search depends on. Build with -tags sqlite_fts5 to include it.
+var ErrMissingFts5 = errors.New("SQLite was built without FTS5, build with -tags sqlite_fts5")
+
 type Sqlite struct {
 	DB        *sql.DB
 	driver    database.Driver
@@ -51,7 +55,9 @@ func NewSqlite(opts ...SqliteOption) (*Sqlite, error) {
 		opt(conf)
 	}
 
-	db, err := sql.Open("sqlite3", conf.dbPath)
+	// Foreign keys are enabled per connection through the DSN so that
+	// cascading deletes also work on pooled connections.
+	db, err := sql.Open("sqlite3", conf.dbPath+"?_foreign_keys=on")
 	sourceDriver, err := iofs.New(migrationFS, "migrations")
 	if err != nil {
 		return nil, err
@@ -71,12 +77,46 @@ func NewSqlite(opts ...SqliteOption) (*Sqlite, error) {
 	}, err
 }
 
+func (s *Sqlite) Backend() Backend {
+	return SqliteBackend
+}
+
+func (s *Sqlite) Conn() *sql.DB {
+	return s.DB
+}
+
 func (s *Sqlite) MigrateUp() error {
+	if err := s.checkFts5(); err != nil {
+		return err
+	}
 	return s.migration.Up()
 }
 
+func (s *Sqlite) checkFts5() error {
+	var enabled bool
+	if err := s.DB.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrMissingFts5
+	}
+	return nil
+}
+
 func (s *Sqlite) MigrateDown() error {
-	return s.migration.Up()
+	return s.migration.Down()
+}
+
+// MigrateSteps applies n migrations, or rolls back -n migrations if n is
+// negative.
+func (s *Sqlite) MigrateSteps(n int) error {
+	return s.migration.Steps(n)
+}
+
+// Version returns the current migration version. Dirty is set if a migration
+// failed halfway and the database needs to be fixed manually.
+func (s *Sqlite) Version() (version uint, dirty bool, err error) {
+	return s.migration.Version()
 }
 
 func (s *Sqlite) Close() error {
@@ -3,53 +3,122 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"io"
+	"log"
+	"mime"
 	"net/http"
 	"time"
 
 	"github.com/michaelhass/cpaw/ctx"
 	"github.com/michaelhass/cpaw/db/repository"
 	"github.com/michaelhass/cpaw/middleware"
+	"github.com/michaelhass/cpaw/models"
 	cmux "github.com/michaelhass/cpaw/mux"
 	"github.com/michaelhass/cpaw/service"
 )
 
 type ApiHandler struct {
-	authService *service.AuthService
-	itemService *service.ItemService
+	authService      *service.AuthService
+	itemService      *service.ItemService
+	shareService     *service.ShareService
+	workspaceService *service.WorkspaceService
+	backupService    *service.BackupService
+	exportService    *service.ExportService
+	config           handlerConfig
 }
 
 func NewApiHandler(
 	authService *service.AuthService,
 	itemService *service.ItemService,
+	shareService *service.ShareService,
+	workspaceService *service.WorkspaceService,
+	backupService *service.BackupService,
+	exportService *service.ExportService,
+	opts ...HandlerOption,
 ) *ApiHandler {
 	return &ApiHandler{
-		authService: authService,
-		itemService: itemService,
+		authService:      authService,
+		itemService:      itemService,
+		shareService:     shareService,
+		workspaceService: workspaceService,
+		backupService:    backupService,
+		exportService:    exportService,
+		config:           newHandlerConfig(opts),
 	}
 }
 
 func (api *ApiHandler) RegisterRoutes(mux *cmux.Mux) {
-	authProtected := middleware.AuthProtected(api.authService, sessionCookieName)
+	authProtected := middleware.AuthProtected(api.authService, api.config.cookie(sessionCookieName))
+	canRead := middleware.RequireScope(models.ItemsReadScope)
+	canWrite := middleware.RequireScope(models.ItemsWriteScope)
+	canManageUsers := middleware.RequirePermission(api.authService, models.ManageUsersPermission)
+	canManageServer := middleware.RequirePermission(api.authService, models.ManageServerPermission)
+	mux.Use(middleware.Csrf(api.config.cookie(csrfCookieName)))
 
 	mux.HandleFunc("GET /auth/signin/", api.handleSignIn)
+	mux.HandleFunc("GET /auth/signin/2fa/", api.handleVerifyTwoFactor)
 	mux.HandleFunc("GET /auth/signout/", api.handleSignOut)
 	mux.Handle(
 		"PUT /auth/",
-		authProtected(http.HandlerFunc(api.handleUpdateUserPassword)),
+		authProtected(middleware.RequireSession(http.HandlerFunc(api.handleUpdateUserPassword))),
 	)
 
+	mux.Handle("GET /events/", authProtected(canRead(http.HandlerFunc(api.handleUserItemEvents))))
+	mux.Handle("GET /sync/", authProtected(canRead(http.HandlerFunc(api.handleSync))))
+	mux.Handle("GET /export/", authProtected(canRead(http.HandlerFunc(api.handleExportUserItems))))
+	mux.Handle("POST /import/", authProtected(canWrite(http.HandlerFunc(api.handleImportUserItems))))
+
+	mux.Group("/users", func(m *cmux.Mux) {
+		m.Use(authProtected, middleware.RequireSession, canManageUsers)
+		m.HandleFunc("GET /", api.handleListUsers)
+		m.HandleFunc("POST /", api.handleCreateUser)
+		m.HandleFunc("DELETE /{userId}/", api.handleDeleteUser)
+		m.HandleFunc("DELETE /{userId}/lock/", api.handleUnlockUser)
+		m.HandleFunc("DELETE /{userId}/2fa/", api.handleResetTwoFactor)
+		m.HandleFunc("GET /export/", api.handleExportAllItems)
+		m.HandleFunc("POST /import/", api.handleImportAllItems)
+	})
+
+	if api.backupService != nil {
+		mux.Handle(
+			"GET /backup/",
+			authProtected(middleware.RequireSession(canManageServer(http.HandlerFunc(api.handleDownloadBackup)))),
+		)
+	}
+
+	mux.Group("/workspaces", func(m *cmux.Mux) {
+		m.Use(authProtected)
+		m.Handle("GET /", canRead(http.HandlerFunc(api.handleListWorkspaces)))
+		m.Handle("GET /{workspaceId}/members/", canRead(http.HandlerFunc(api.handleListWorkspaceMembers)))
+	})
+
 	mux.Group("/items", func(m *cmux.Mux) {
-		m.Use(middleware.AuthProtected(api.authService, sessionCookieName))
-		m.HandleFunc("GET /", api.handleListUserItems)
-		m.HandleFunc("POST /", api.handleCreateItemForUser)
-		m.HandleFunc("GET /{itemId}/", api.handleGetUserItem)
-		m.HandleFunc("DELETE /{itemId}/", api.handleDeleteUserItemById)
+		m.Use(authProtected)
+		m.Handle("GET /", canRead(http.HandlerFunc(api.handleListUserItems)))
+		m.Handle("POST /", canWrite(http.HandlerFunc(api.handleCreateItemForUser)))
+		m.Handle("GET /{itemId}/", canRead(http.HandlerFunc(api.handleGetUserItem)))
+		m.Handle("PUT /{itemId}/", canWrite(http.HandlerFunc(api.handleUpdateUserItem)))
+		m.Handle("PATCH /{itemId}/", canWrite(http.HandlerFunc(api.handleUpdateUserItem)))
+		m.Handle("DELETE /{itemId}/", canWrite(http.HandlerFunc(api.handleDeleteUserItemById)))
+		m.Handle("GET /{itemId}/revisions/", canRead(http.HandlerFunc(api.handleListUserItemRevisions)))
+		m.Handle(
+			"POST /{itemId}/revisions/{revisionId}/restore/",
+			canWrite(http.HandlerFunc(api.handleRestoreUserItemRevision)),
+		)
+		m.Handle(
+			"GET /{itemId}/attachments/{attachmentId}/",
+			canRead(http.HandlerFunc(api.handleGetUserItemAttachment)),
+		)
+		m.Handle("GET /{itemId}/shares/", canRead(http.HandlerFunc(api.handleListItemShares)))
+		m.Handle("POST /{itemId}/shares/", canWrite(http.HandlerFunc(api.handleCreateItemShare)))
+		m.Handle("DELETE /{itemId}/shares/{shareId}/", canWrite(http.HandlerFunc(api.handleRevokeItemShare)))
 	})
 }
 
 type signInRequest struct {
 	UserName string `json:"userName"`
 	Password string `json:"password"`
+	Remember bool   `json:"remember"`
 }
 
 func (api *ApiHandler) handleSignIn(w http.ResponseWriter, r *http.Request) {
@@ -59,18 +128,68 @@ func (api *ApiHandler) handleSignIn(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	authResult, err := api.authService.SignIn(r.Context(), signInRequest.UserName, signInRequest.Password)
-	if err != nil {
+	authResult, err := api.authService.SignIn(r.Context(), service.SignInParams{
+		UserName:  signInRequest.UserName,
+		Password:  signInRequest.Password,
+		Remember:  signInRequest.Remember,
+		UserAgent: r.UserAgent(),
+		IpAddress: remoteIpAddress(r),
+	})
+	if errors.Is(err, service.ErrTooManyLoginAttempts) {
+		writeLoginLocked(w, err)
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	cookie := &http.Cookie{}
-	cookie.Name = sessionCookieName
-	cookie.Value = authResult.Session.Token
-	cookie.Expires = time.Unix(authResult.Session.ExpiresAt, 0)
-	cookie.Path = "/"
-	http.SetCookie(w, cookie)
+	if len(authResult.TwoFactorToken) > 0 {
+		writeJSONResponse(w, twoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			TwoFactorToken:    authResult.TwoFactorToken,
+		}, http.StatusOK)
+		return
+	}
+	middleware.SetSessionCookie(w, api.config.cookie(sessionCookieName), authResult.Session)
+
+	writeJSONResponse(w, authResult.User, http.StatusAccepted)
+}
+
+// twoFactorChallengeResponse asks the client to complete the sign in with the
+// second factor at /auth/signin/2fa/.
+type twoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	TwoFactorToken    string `json:"twoFactorToken"`
+}
+
+type verifyTwoFactorRequest struct {
+	TwoFactorToken string `json:"twoFactorToken"`
+	Code           string `json:"code"`
+}
+
+func (api *ApiHandler) handleVerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var body verifyTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	authResult, err := api.authService.VerifyTwoFactor(r.Context(), service.VerifyTwoFactorParams{
+		Token: body.TwoFactorToken,
+		Code:  body.Code,
+	})
+	if errors.Is(err, service.ErrTooManyLoginAttempts) {
+		writeLoginLocked(w, err)
+		return
+	} else if errors.Is(err, service.ErrInvalidTwoFactorCode) ||
+		errors.Is(err, service.ErrExpiredLoginChallenge) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	middleware.SetSessionCookie(w, api.config.cookie(sessionCookieName), authResult.Session)
 
 	writeJSONResponse(w, authResult.User, http.StatusAccepted)
 }
@@ -88,11 +207,7 @@ func (api *ApiHandler) handleSignOut(w http.ResponseWriter, r *http.Request) {
 
 	token := cookie.Value
 	api.authService.SignOut(r.Context(), token)
-	http.SetCookie(w, &http.Cookie{
-		Name:    sessionCookieName,
-		Value:   "",
-		Expires: time.Now(),
-	})
+	middleware.ClearSessionCookie(w, api.config.cookie(sessionCookieName))
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -113,9 +228,11 @@ func (api *ApiHandler) handleUpdateUserPassword(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	session, _ := ctx.GetSession(r.Context())
 	err := api.authService.UpdatePassword(r.Context(), service.UpdatePasswordParams{
-		UserId:   userId,
-		Password: body.Password,
+		UserId:       userId,
+		Password:     body.Password,
+		SessionToken: session.Token,
 	})
 
 	if errors.Is(err, service.ErrMinPasswordLength) {
@@ -164,16 +281,56 @@ func (api *ApiHandler) handleListUserItems(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	items, err := api.itemService.ListItemsForUser(r.Context(), userId)
+	if query := r.URL.Query().Get("q"); len(query) > 0 {
+		results, err := api.itemService.SearchItemsForUser(r.Context(), service.SearchItemsForUserParams{
+			UserId:      userId,
+			WorkspaceId: r.URL.Query().Get("workspace"),
+			Query:       query,
+		})
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSONResponse(w, results, http.StatusOK)
+		return
+	}
+
+	params, err := parseListItemsParams(r, userId)
 	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	page, err := api.itemService.ListItemsForUser(r.Context(), params)
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	writeJSONResponse(w, items, http.StatusOK)
+	writeJSONResponse(w, listItemsResponseBody{
+		ItemPage: page,
+		Next:     nextPageLink(r, page.NextCursor),
+	}, http.StatusOK)
+}
+
+type listItemsResponseBody struct {
+	models.ItemPage
+	Next string `json:"next,omitempty"`
 }
 
 type createItemRequestBody struct {
 	Content string `json:"content"`
+	// ExpiresIn is the lifetime of the item in seconds.
+	ExpiresIn     int64 `json:"expiresIn"`
+	BurnAfterRead bool  `json:"burnAfterRead"`
+	// WorkspaceId is optional. Items without one are personal items.
+	WorkspaceId string `json:"workspaceId"`
 }
 
 func (api *ApiHandler) handleCreateItemForUser(w http.ResponseWriter, r *http.Request) {
@@ -183,23 +340,135 @@ func (api *ApiHandler) handleCreateItemForUser(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	var body createItemRequestBody
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	params := service.CreateItemsParams{UserId: userId}
+	if isMultipartRequest(r) {
+		attachments, err := parseMultipartAttachments(w, r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		params.Content = r.FormValue("content")
+		params.WorkspaceId = r.FormValue("workspace")
+		params.Attachments = attachments
+		if err := parseItemExpiryForm(r, &params); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	} else {
+		var body createItemRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		params.Content = body.Content
+		params.BurnAfterRead = body.BurnAfterRead
+		params.WorkspaceId = body.WorkspaceId
+		expiresAt, err := expiresAt(body.ExpiresIn)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		params.ExpiresAt = expiresAt
+	}
+
+	item, err := api.itemService.CreateItem(r.Context(), params)
+
+	if isInvalidItemError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, item, http.StatusCreated)
+}
+
+type updateItemRequestBody struct {
+	Content *string `json:"content"`
+}
+
+func (api *ApiHandler) handleUpdateUserItem(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var body updateItemRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Content == nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	item, err := api.itemService.CreateItem(r.Context(), repository.CreateItemParams{
-		Content: body.Content,
+	item, err := api.itemService.UpdateItemForUser(r.Context(), service.UpdateItemForUserParams{
+		ItemId:  r.PathValue("itemId"),
 		UserId:  userId,
+		Content: *body.Content,
 	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, item, http.StatusOK)
+}
 
-	if err != nil {
+func (api *ApiHandler) handleListUserItemRevisions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	revisions, err := api.itemService.ListItemRevisionsForUser(r.Context(), service.ListItemRevisionsForUserParams{
+		ItemId: r.PathValue("itemId"),
+		UserId: userId,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	writeJSONResponse(w, revisions, http.StatusOK)
+}
 
-	writeJSONResponse(w, item, http.StatusCreated)
+func (api *ApiHandler) handleRestoreUserItemRevision(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	item, err := api.itemService.RestoreItemRevision(r.Context(), service.RestoreItemRevisionParams{
+		RevisionId: r.PathValue("revisionId"),
+		ItemId:     r.PathValue("itemId"),
+		UserId:     userId,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, item, http.StatusOK)
 }
 
 func (api *ApiHandler) handleDeleteUserItemById(w http.ResponseWriter, r *http.Request) {
@@ -220,10 +489,336 @@ func (api *ApiHandler) handleDeleteUserItemById(w http.ResponseWriter, r *http.R
 		UserId: userId,
 	})
 
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (api *ApiHandler) handleGetUserItemAttachment(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	attachment, err := api.itemService.GetAttachmentForUser(r.Context(), service.GetAttachmentForUserParams{
+		AttachmentId: r.PathValue("attachmentId"),
+		ItemId:       r.PathValue("itemId"),
+		UserId:       userId,
+	})
+
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeAttachment(w, attachment)
+}
+
+func (api *ApiHandler) handleUserItemEvents(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	events, unsubscribe := api.itemService.SubscribeItemEvents(userId)
+	defer unsubscribe()
+
+	stream, err := newEventStream(w)
+	if err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventStreamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if err := stream.send(string(event.Type), string(data)); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if err := checkAuthentication(r.Context(), api.authService); err != nil {
+				return
+			}
+			if err := stream.keepAlive(); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (api *ApiHandler) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := api.authService.ListUsers(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, users, http.StatusOK)
+}
+
+// handleDownloadBackup sends a consistent copy of the database, which can be
+// restored with 'cpaw restore'.
+func (api *ApiHandler) handleDownloadBackup(w http.ResponseWriter, r *http.Request) {
+	backup, err := api.backupService.OpenBackup(r.Context())
+	if err != nil {
+		log.Println("Error creating backup", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer backup.Close()
+
+	fileName := "cpaw-" + time.Now().UTC().Format("20060102-150405") + ".db"
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, backup)
+}
+
+type createUserRequestBody struct {
+	UserName string      `json:"userName"`
+	Password string      `json:"password"`
+	Role     models.Role `json:"role"`
+}
+
+func (api *ApiHandler) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var body createUserRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	user, err := api.authService.CreateUser(r.Context(), service.CreateUserParams{
+		UserName: body.UserName,
+		Password: body.Password,
+		Role:     body.Role,
+	})
+	if errors.Is(err, service.ErrUserNameInvalidChars) ||
+		errors.Is(err, service.ErrInvalidRole) ||
+		errors.Is(err, service.ErrMinPasswordLength) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	writeJSONResponse(w, user, http.StatusCreated)
+}
+
+func (api *ApiHandler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := api.authService.DeleteUser(r.Context(), service.DeleteUserParams{
+		UserId:    r.PathValue("userId"),
+		DeletedBy: userId,
+	})
+	if errors.Is(err, service.ErrDeleteOwnUser) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (api *ApiHandler) handleListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	workspaces, err := api.workspaceService.ListWorkspacesForUser(r.Context(), userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, workspaces, http.StatusOK)
+}
+
+func (api *ApiHandler) handleListWorkspaceMembers(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	members, err := api.workspaceService.ListMembers(r.Context(), service.GetWorkspaceForUserParams{
+		WorkspaceId: r.PathValue("workspaceId"),
+		UserId:      userId,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, members, http.StatusOK)
+}
+
+func (api *ApiHandler) handleListItemShares(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	shares, err := api.shareService.ListSharesForItem(r.Context(), service.ListSharesForItemParams{
+		ItemId: r.PathValue("itemId"),
+		UserId: userId,
+	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, shares, http.StatusOK)
+}
+
+type createShareRequestBody struct {
+	// ExpiresIn is the lifetime of the share in seconds.
+	ExpiresIn int64  `json:"expiresIn"`
+	MaxViews  int64  `json:"maxViews"`
+	Password  string `json:"password"`
+}
+
+func (api *ApiHandler) handleCreateItemShare(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var body createShareRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	expiresAt, err := expiresAt(body.ExpiresIn)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
 	}
+
+	share, err := api.shareService.CreateShare(r.Context(), service.CreateShareParams{
+		ItemId:    r.PathValue("itemId"),
+		UserId:    userId,
+		ExpiresAt: expiresAt,
+		MaxViews:  body.MaxViews,
+		Password:  body.Password,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if isInvalidShareError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, share, http.StatusCreated)
+}
+
+func (api *ApiHandler) handleRevokeItemShare(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := api.shareService.RevokeShare(r.Context(), service.RevokeShareParams{
+		ShareId: r.PathValue("shareId"),
+		ItemId:  r.PathValue("itemId"),
+		UserId:  userId,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *ApiHandler) handleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := api.authService.UnlockUser(r.Context(), service.UnlockUserParams{
+		UserId:     r.PathValue("userId"),
+		UnlockedBy: userId,
+	})
+	if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (api *ApiHandler) handleResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := api.authService.ResetTwoFactor(r.Context(), service.ResetTwoFactorParams{
+		UserId:  r.PathValue("userId"),
+		ResetBy: userId,
+	})
+	if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
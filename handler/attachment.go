@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/michaelhass/cpaw/models"
+	"github.com/michaelhass/cpaw/service"
+)
+
+func isMultipartRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+func parseMultipartAttachments(w http.ResponseWriter, r *http.Request) ([]service.CreateAttachmentParams, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		return nil, err
+	}
+
+	var attachments []service.CreateAttachmentParams
+	for _, fileHeader := range r.MultipartForm.File[attachmentsField] {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		mimeType := fileHeader.Header.Get("Content-Type")
+		if len(mimeType) == 0 || mimeType == "application/octet-stream" {
+			mimeType = http.DetectContentType(data)
+		}
+
+		attachments = append(attachments, service.CreateAttachmentParams{
+			FileName: fileHeader.Filename,
+			MimeType: mimeType,
+			Data:     data,
+		})
+	}
+	return attachments, nil
+}
+
+func writeAttachment(w http.ResponseWriter, attachment models.Attachment) {
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName})
+	if len(disposition) == 0 {
+		disposition = fmt.Sprintf("attachment; filename=%q", attachment.Id)
+	}
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(attachment.Data)
+}
@@ -1,5 +1,15 @@
 package handler
 
+import "time"
+
 const (
 	sessionCookieName string = "cpaw_session"
+	csrfCookieName    string = "cpaw_csrf"
+	// oidcCookieName keeps state, PKCE verifier and nonce of a single sign-on
+	// until the provider redirects back.
+	oidcCookieName   string        = "cpaw_oidc"
+	oidcCookieMaxAge time.Duration = time.Minute * 10
+	maxUploadSize    int64         = 32 << 20
+	maxImportSize    int64         = 256 << 20
+	attachmentsField string        = "files"
 )
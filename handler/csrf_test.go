@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/michaelhass/cpaw/middleware"
+	"github.com/michaelhass/cpaw/models"
+)
+
+const testCsrfToken string = "test_csrf_token"
+
+// addCsrfToken sends the CSRF cookie along with the matching header, like htmx
+// does on a page of cpaw.
+func addCsrfToken(req *http.Request) {
+	req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCsrfToken})
+	req.Header.Set(middleware.CsrfHeaderName, testCsrfToken)
+}
+
+func TestCsrf(t *testing.T) {
+	server := newUserTestServer(t)
+
+	send := func(t *testing.T, req *http.Request) *http.Response {
+		t.Helper()
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: server.sessions[models.AdminRole]})
+		client := &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		io.Copy(io.Discard, res.Body)
+		return res
+	}
+	newRequest := func(t *testing.T, method, path, body string) *http.Request {
+		t.Helper()
+		req, err := http.NewRequest(method, server.url+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(body) > 0 {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		return req
+	}
+
+	t.Run("IssuesCookie", func(t *testing.T) {
+		res := send(t, newRequest(t, http.MethodGet, "/settings/sessions/", ""))
+		var cookie *http.Cookie
+		for _, c := range res.Cookies() {
+			if c.Name == csrfCookieName {
+				cookie = c
+			}
+		}
+		if cookie == nil || len(cookie.Value) == 0 {
+			t.Fatal("Expected CSRF cookie")
+		}
+		if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("Expected HttpOnly and SameSite=Lax cookie. Got: %v", cookie)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		prepare func(*http.Request)
+		body    string
+		want    int
+	}{
+		{"MissingToken", func(*http.Request) {}, "", http.StatusForbidden},
+		{"MissingCookie", func(req *http.Request) {
+			req.Header.Set(middleware.CsrfHeaderName, testCsrfToken)
+		}, "", http.StatusForbidden},
+		{"WrongToken", func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCsrfToken})
+			req.Header.Set(middleware.CsrfHeaderName, "forged")
+		}, "", http.StatusForbidden},
+		{"Header", addCsrfToken, "", http.StatusSeeOther},
+		{"FormField", func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCsrfToken})
+		}, middleware.CsrfFormField + "=" + testCsrfToken, http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRequest(t, http.MethodPost, "/signout/", tt.body)
+			tt.prepare(req)
+			if res := send(t, req); res.StatusCode != tt.want {
+				t.Errorf("Expected status %d. Got: %d", tt.want, res.StatusCode)
+			}
+		})
+	}
+}
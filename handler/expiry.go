@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/michaelhass/cpaw/service"
+)
+
+var errInvalidExpiresIn = errors.New("Invalid expiration.")
+
+// expiresAt converts the lifetime of a new item in seconds into its
+// expiration time. 0 means the item does not expire.
+func expiresAt(seconds int64) (time.Time, error) {
+	if seconds < 0 {
+		return time.Time{}, errInvalidExpiresIn
+	}
+	if seconds == 0 {
+		return time.Time{}, nil
+	}
+	return time.Now().Add(time.Duration(seconds) * time.Second), nil
+}
+
+// parseItemExpiryForm reads the optional "expires_in" and "burn_after_read"
+// form fields.
+func parseItemExpiryForm(r *http.Request, params *service.CreateItemsParams) error {
+	if value := r.FormValue("expires_in"); len(value) > 0 {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errInvalidExpiresIn
+		}
+		if params.ExpiresAt, err = expiresAt(seconds); err != nil {
+			return err
+		}
+	}
+	params.BurnAfterRead = r.FormValue("burn_after_read") == "true"
+	return nil
+}
+
+func isInvalidItemError(err error) bool {
+	return errors.Is(err, service.ErrItemExpiresAt) ||
+		errors.Is(err, service.ErrBurnAfterReadAttachments) ||
+		errors.Is(err, service.ErrBurnAfterReadMissingContent)
+}
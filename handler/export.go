@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/michaelhass/cpaw/ctx"
+	"github.com/michaelhass/cpaw/service"
+)
+
+// handleExportUserItems sends the personal items of the user. The "format"
+// query parameter is either "jsonl" or "zip", which also contains attachments.
+func (api *ApiHandler) handleExportUserItems(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	api.writeExport(w, r, userId)
+}
+
+// handleExportAllItems sends the personal items of all users.
+func (api *ApiHandler) handleExportAllItems(w http.ResponseWriter, r *http.Request) {
+	api.writeExport(w, r, "")
+}
+
+func (api *ApiHandler) writeExport(w http.ResponseWriter, r *http.Request, userId string) {
+	format := service.ExportFormat(r.URL.Query().Get("format"))
+	if len(format) == 0 {
+		format = service.ZipExportFormat
+	}
+	if !format.IsValid() {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(service.ErrInvalidExportFormat.Error()))
+		return
+	}
+
+	// The export is written to a temporary file rather than memory, which
+	// may not fit all attachments. A failure still results in an error
+	// status.
+	file, err := os.CreateTemp("", "cpaw-export-*")
+	if err != nil {
+		log.Println("Error exporting items", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	err = api.exportService.ExportItems(r.Context(), service.ExportItemsParams{
+		UserId: userId,
+		Format: format,
+	}, file)
+	var size int64
+	if err == nil {
+		size, err = file.Seek(0, io.SeekCurrent)
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		log.Println("Error exporting items", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "application/zip"
+	if format == service.JsonLinesExportFormat {
+		contentType = "application/jsonl"
+	}
+	fileName := "cpaw-export-" + time.Now().UTC().Format("20060102-150405") + "." + string(format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, file)
+}
+
+// handleImportUserItems imports an export, which is sent as request body, as
+// personal items of the user.
+func (api *ApiHandler) handleImportUserItems(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	api.importItems(w, r, userId)
+}
+
+// handleImportAllItems imports an export for the users with the exported user
+// names.
+func (api *ApiHandler) handleImportAllItems(w http.ResponseWriter, r *http.Request) {
+	api.importItems(w, r, "")
+}
+
+func (api *ApiHandler) importItems(w http.ResponseWriter, r *http.Request, userId string) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	result, err := api.exportService.ImportItems(r.Context(), service.ImportItemsParams{
+		UserId: userId,
+		Data:   data,
+	})
+	if errors.Is(err, service.ErrInvalidImport) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		log.Println("Error importing items", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, result, http.StatusOK)
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/michaelhass/cpaw/db/repository"
+)
+
+func TestExport(t *testing.T) {
+	server := newTestServer(t, testServerOptions{users: []testServerUser{{name: "export_user"}}})
+	_, err := server.items.CreateItem(context.Background(), repository.CreateItemParams{
+		Content: "exported",
+		UserId:  server.users["export_user"].Id,
+		Attachments: []repository.CreateAttachmentParams{
+			{FileName: "a.txt", MimeType: "text/plain", Data: []byte("attachment")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(t *testing.T, format string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.url+"/api/v1/export/?format="+format, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+server.tokens["export_user"])
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, body
+	}
+
+	t.Run("Zip", func(t *testing.T) {
+		res, body := get(t, "zip")
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200. Got: %d", res.StatusCode)
+		}
+		if res.Header.Get("Content-Length") != strconv.Itoa(len(body)) {
+			t.Errorf("Expected content length %d. Got: %s", len(body), res.Header.Get("Content-Length"))
+		}
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(archive.File) != 2 {
+			t.Errorf("Expected items and 1 attachment. Got: %d files", len(archive.File))
+		}
+	})
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		if res, _ := get(t, "csv"); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400. Got: %d", res.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/michaelhass/cpaw/middleware"
+	"github.com/michaelhass/cpaw/service"
+)
+
+const oidcCookiePath string = "/signin/oidc/"
+
+// setOidcCookie keeps the values of a started single sign-on in the browser,
+// which returns them to the callback.
+func setOidcCookie(w http.ResponseWriter, cookie middleware.Cookie, authRequest service.OidcAuthRequest) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookie.Name,
+		Value:    strings.Join([]string{authRequest.State, authRequest.Verifier, authRequest.Nonce}, "."),
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   cookie.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// popOidcCookie returns the values of the single sign-on, whose state matches
+// the callback, and removes the cookie.
+func popOidcCookie(w http.ResponseWriter, r *http.Request, cookie middleware.Cookie) (service.OidcAuthRequest, bool) {
+	var authRequest service.OidcAuthRequest
+
+	c, err := r.Cookie(cookie.Name)
+	if err != nil {
+		return authRequest, false
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookie.Name,
+		Path:     oidcCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cookie.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	values := strings.Split(c.Value, ".")
+	if len(values) != 3 {
+		return authRequest, false
+	}
+	state := r.URL.Query().Get("state")
+	if len(state) == 0 || subtle.ConstantTimeCompare([]byte(state), []byte(values[0])) != 1 {
+		return authRequest, false
+	}
+	authRequest.State = values[0]
+	authRequest.Verifier = values[1]
+	authRequest.Nonce = values[2]
+	return authRequest, true
+}
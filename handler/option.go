@@ -0,0 +1,30 @@
+package handler
+
+import "github.com/michaelhass/cpaw/middleware"
+
+// HandlerOption configures the template and API handlers.
+type HandlerOption func(*handlerConfig)
+
+type handlerConfig struct {
+	secureCookies bool
+}
+
+// WithSecureCookies only lets browsers send the cookies of the handler over
+// HTTPS.
+func WithSecureCookies(secure bool) HandlerOption {
+	return func(conf *handlerConfig) {
+		conf.secureCookies = secure
+	}
+}
+
+func newHandlerConfig(opts []HandlerOption) handlerConfig {
+	var conf handlerConfig
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	return conf
+}
+
+func (conf handlerConfig) cookie(name string) middleware.Cookie {
+	return middleware.Cookie{Name: name, Secure: conf.secureCookies}
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSecureCookies(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		server := newTestServer(t, testServerOptions{
+			users:          []testServerUser{{name: "cookie_user"}},
+			handlerOptions: []HandlerOption{WithSecureCookies(secure)},
+		})
+
+		req, err := http.NewRequest(
+			http.MethodGet,
+			server.url+"/api/v1/auth/signin/",
+			strings.NewReader(`{"userName":"cookie_user","password":"password"}`),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusAccepted {
+			t.Fatalf("Expected status 202. Got: %d", res.StatusCode)
+		}
+
+		names := map[string]bool{}
+		for _, cookie := range res.Cookies() {
+			names[cookie.Name] = true
+			if cookie.Secure != secure {
+				t.Errorf("Expected cookie %s with Secure=%t. Got: %v", cookie.Name, secure, cookie)
+			}
+		}
+		if !names[sessionCookieName] || !names[csrfCookieName] {
+			t.Errorf("Expected session and CSRF cookie. Got: %v", res.Cookies())
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/service"
+)
+
+var errInvalidLimit = errors.New("Invalid limit.")
+
+func parseListItemsParams(r *http.Request, userId string) (service.ListItemsForUserParams, error) {
+	query := r.URL.Query()
+	params := service.ListItemsForUserParams{
+		UserId:      userId,
+		WorkspaceId: query.Get("workspace"),
+	}
+
+	cursor, err := repository.ParseItemCursor(query.Get("cursor"))
+	if err != nil {
+		return params, err
+	}
+	params.Cursor = cursor
+
+	if limit := query.Get("limit"); len(limit) > 0 {
+		params.Limit, err = strconv.Atoi(limit)
+		if err != nil || params.Limit <= 0 {
+			return params, errInvalidLimit
+		}
+	}
+	return params, nil
+}
+
+// nextPageLink returns the request's original URL pointing at the page that
+// starts after nextCursor.
+func nextPageLink(r *http.Request, nextCursor string) string {
+	if len(nextCursor) == 0 {
+		return ""
+	}
+	link, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		return ""
+	}
+	query := link.Query()
+	query.Set("cursor", nextCursor)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/middleware"
+	"github.com/michaelhass/cpaw/models"
+	"github.com/michaelhass/cpaw/mux"
+	"github.com/michaelhass/cpaw/service"
+)
+
+// testPassword is the password of the users of a test server.
+const testPassword string = "password"
+
+type testServerUser struct {
+	name string
+	role models.Role
+}
+
+type testServerOptions struct {
+	// users are created with testPassword and signed in.
+	users          []testServerUser
+	handlerOptions []HandlerOption
+}
+
+// testServer serves the template handler at / and the API handler at /api/v1
+// with services on a memory store.
+type testServer struct {
+	url           string
+	items         repository.ItemStore
+	authService   *service.AuthService
+	itemService   *service.ItemService
+	shareService  *service.ShareService
+	exportService *service.ExportService
+	// users and tokens map user names to the users and their session tokens.
+	users  map[string]models.User
+	tokens map[string]string
+}
+
+// newTestAuthService creates an AuthService with memory repositories.
+func newTestAuthService(memory *repository.MemoryDB) *service.AuthService {
+	return service.NewAuthService(
+		repository.NewMemorySessionRepository(memory),
+		repository.NewMemoryUserRepository(memory),
+		repository.NewMemoryApiTokenRepository(memory),
+		repository.NewMemoryLoginAttemptRepository(memory),
+		repository.NewMemoryTwoFactorRepository(memory),
+	)
+}
+
+func newTestServer(t *testing.T, opts testServerOptions) testServer {
+	t.Helper()
+
+	memory := repository.NewMemoryDB()
+	users := repository.NewMemoryUserRepository(memory)
+	workspaces := repository.NewMemoryWorkspaceRepository(memory)
+	s := testServer{
+		items:       repository.NewMemoryItemRepository(memory),
+		authService: newTestAuthService(memory),
+		users:       map[string]models.User{},
+		tokens:      map[string]string{},
+	}
+	s.itemService = service.NewItemService(s.items, workspaces, service.NewItemEventHub())
+	s.shareService = service.NewShareService(
+		repository.NewMemoryShareRepository(memory),
+		s.items,
+		repository.NewMemoryLoginAttemptRepository(memory),
+	)
+	s.exportService = service.NewExportService(s.items, users)
+	workspaceService := service.NewWorkspaceService(workspaces, users)
+
+	ctx := context.Background()
+	for _, user := range opts.users {
+		created, err := s.authService.CreateUser(ctx, service.CreateUserParams{
+			UserName: user.name,
+			Password: testPassword,
+			Role:     user.role,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		authResult, err := s.authService.SignIn(ctx, service.SignInParams{UserName: user.name, Password: testPassword})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.users[user.name] = created
+		s.tokens[user.name] = authResult.Session.Token
+	}
+
+	mainMux := mux.NewDefaultMux()
+	mainMux.Group("", func(m *mux.Mux) {
+		m.Use(middleware.AddTrailingSlash)
+		NewTemplateHandler(
+			s.authService,
+			s.itemService,
+			s.shareService,
+			workspaceService,
+			nil,
+			opts.handlerOptions...,
+		).RegisterRoutes(m)
+	})
+	mainMux.Group("/api/v1", func(m *mux.Mux) {
+		m.Use(middleware.AddTrailingSlash)
+		NewApiHandler(
+			s.authService,
+			s.itemService,
+			s.shareService,
+			workspaceService,
+			nil,
+			s.exportService,
+			opts.handlerOptions...,
+		).RegisterRoutes(m)
+	})
+	server := httptest.NewServer(mainMux)
+	t.Cleanup(server.Close)
+
+	s.url = server.URL
+	return s
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/michaelhass/cpaw/ctx"
+	"github.com/michaelhass/cpaw/service"
+)
+
+// checkAuthentication returns an error if the session or API token, which
+// authenticated a request, has been revoked or has expired since. Streams
+// check it periodically, as they outlive the authentication of the request.
+func checkAuthentication(c context.Context, authService *service.AuthService) error {
+	if apiToken, ok := ctx.GetApiToken(c); ok {
+		return authService.CheckApiToken(c, apiToken)
+	}
+	if session, ok := ctx.GetSession(c); ok {
+		return authService.CheckSession(c, session.Token)
+	}
+	return nil
+}
+
+// remoteIpAddress returns the IP address of the client without its port.
+func remoteIpAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeLoginLocked responds to attempts on a locked user name, IP address or
+// share and tells the client when to retry.
+func writeLoginLocked(w http.ResponseWriter, err error) {
+	setRetryAfter(w, err)
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte(err.Error()))
+}
+
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var lockedErr *service.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		retryAfter := int(math.Ceil(lockedErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+}
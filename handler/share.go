@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/michaelhass/cpaw/service"
+)
+
+var errInvalidMaxViews = errors.New("Invalid max. views.")
+
+// parseShareForm reads the optional "expires_in", "max_views" and "password"
+// form fields.
+func parseShareForm(r *http.Request, params *service.CreateShareParams) error {
+	if value := r.FormValue("expires_in"); len(value) > 0 {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errInvalidExpiresIn
+		}
+		if params.ExpiresAt, err = expiresAt(seconds); err != nil {
+			return err
+		}
+	}
+	if value := r.FormValue("max_views"); len(value) > 0 {
+		maxViews, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errInvalidMaxViews
+		}
+		params.MaxViews = maxViews
+	}
+	params.Password = r.FormValue("password")
+	return nil
+}
+
+func isInvalidShareError(err error) bool {
+	return errors.Is(err, service.ErrShareExpiresAt) ||
+		errors.Is(err, service.ErrShareMaxViews) ||
+		errors.Is(err, service.ErrShareBurnAfterRead)
+}
+
+// sharePassword returns the password of a raw share request, which is sent
+// with basic auth, e.g. curl -u :password.
+func sharePassword(r *http.Request) string {
+	_, password, _ := r.BasicAuth()
+	return password
+}
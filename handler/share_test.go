@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/michaelhass/cpaw/middleware"
+	"github.com/michaelhass/cpaw/models"
+	"github.com/michaelhass/cpaw/service"
+)
+
+type shareTestServer struct {
+	testServer
+	item models.Item
+}
+
+func newShareTestServer(t *testing.T) shareTestServer {
+	server := newTestServer(t, testServerOptions{users: []testServerUser{{name: "share_user"}}})
+	item, err := server.itemService.CreateItem(context.Background(), service.CreateItemsParams{
+		Content: "shared content",
+		UserId:  server.users["share_user"].Id,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return shareTestServer{testServer: server, item: item}
+}
+
+func (s shareTestServer) createShare(t *testing.T, params service.CreateShareParams) models.Share {
+	t.Helper()
+	params.ItemId = s.item.Id
+	params.UserId = s.item.UserId
+	share, err := s.shareService.CreateShare(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return share
+}
+
+// request sends form values as POST request, if given, and a share password
+// with basic auth.
+func (s shareTestServer) request(t *testing.T, path string, form url.Values, password string) (int, string) {
+	t.Helper()
+
+	method, body := http.MethodGet, io.Reader(nil)
+	if form != nil {
+		// Like the password form of the share page, send the CSRF token as
+		// form field.
+		form.Set(middleware.CsrfFormField, testCsrfToken)
+		method, body = http.MethodPost, strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, s.url+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if form != nil {
+		req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCsrfToken})
+	}
+	if len(password) > 0 {
+		req.SetBasicAuth("", password)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(data)
+}
+
+func TestShare(t *testing.T) {
+	server := newShareTestServer(t)
+
+	t.Run("UnknownToken", func(t *testing.T) {
+		status, _ := server.request(t, "/s/unknown", nil, "")
+		if status != http.StatusNotFound {
+			t.Errorf("Expected status 404. Got: %d", status)
+		}
+	})
+
+	t.Run("MaxViews", func(t *testing.T) {
+		share := server.createShare(t, service.CreateShareParams{MaxViews: 2})
+		sharePath := "/s/" + share.Token
+
+		status, body := server.request(t, sharePath, nil, "")
+		if status != http.StatusOK || !strings.Contains(body, "shared content") {
+			t.Errorf("Expected shared content. Got: %d %s", status, body)
+		}
+		status, body = server.request(t, sharePath+"/raw", nil, "")
+		if status != http.StatusOK || body != "shared content" {
+			t.Errorf("Expected raw shared content. Got: %d %s", status, body)
+		}
+		status, _ = server.request(t, sharePath+"/raw", nil, "")
+		if status != http.StatusNotFound {
+			t.Errorf("Expected status 404 after max views. Got: %d", status)
+		}
+	})
+
+	t.Run("Password", func(t *testing.T) {
+		share := server.createShare(t, service.CreateShareParams{Password: "secret"})
+		sharePath := "/s/" + share.Token
+
+		status, body := server.request(t, sharePath, nil, "")
+		if status != http.StatusOK || strings.Contains(body, "shared content") {
+			t.Errorf("Expected password form. Got: %d %s", status, body)
+		}
+
+		status, body = server.request(t, sharePath, url.Values{"password": {"wrong"}}, "")
+		if status != http.StatusUnauthorized || strings.Contains(body, "shared content") {
+			t.Errorf("Expected status 401. Got: %d %s", status, body)
+		}
+
+		status, body = server.request(t, sharePath, url.Values{"password": {"secret"}}, "")
+		if status != http.StatusOK || !strings.Contains(body, "shared content") {
+			t.Errorf("Expected shared content. Got: %d %s", status, body)
+		}
+
+		status, _ = server.request(t, sharePath+"/raw", nil, "")
+		if status != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 without password. Got: %d", status)
+		}
+		status, body = server.request(t, sharePath+"/raw", nil, "secret")
+		if status != http.StatusOK || body != "shared content" {
+			t.Errorf("Expected raw shared content. Got: %d %s", status, body)
+		}
+	})
+
+	t.Run("PasswordLockout", func(t *testing.T) {
+		share := server.createShare(t, service.CreateShareParams{Password: "secret"})
+		sharePath := "/s/" + share.Token
+
+		for range service.MaxSharePasswordFailures {
+			status, _ := server.request(t, sharePath+"/raw", nil, "wrong")
+			if status != http.StatusUnauthorized {
+				t.Fatalf("Expected status 401. Got: %d", status)
+			}
+		}
+		// The first failure beyond the allowed ones locks the share.
+		status, _ := server.request(t, sharePath, url.Values{"password": {"wrong"}}, "")
+		if status != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401. Got: %d", status)
+		}
+
+		status, body := server.request(t, sharePath, url.Values{"password": {"secret"}}, "")
+		if status != http.StatusTooManyRequests || strings.Contains(body, "shared content") {
+			t.Errorf("Expected status 429 with the right password. Got: %d %s", status, body)
+		}
+		status, _ = server.request(t, sharePath+"/raw", nil, "secret")
+		if status != http.StatusTooManyRequests {
+			t.Errorf("Expected raw share to be locked. Got: %d", status)
+		}
+
+		other := server.createShare(t, service.CreateShareParams{Password: "secret"})
+		status, body = server.request(t, "/s/"+other.Token+"/raw", nil, "secret")
+		if status != http.StatusOK || body != "shared content" {
+			t.Errorf("Expected other share to be unaffected. Got: %d %s", status, body)
+		}
+	})
+
+	t.Run("BurnAfterRead", func(t *testing.T) {
+		ctx := context.Background()
+		item, err := server.itemService.CreateItem(ctx, service.CreateItemsParams{
+			Content:       "secret",
+			UserId:        server.item.UserId,
+			BurnAfterRead: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = server.shareService.CreateShare(ctx, service.CreateShareParams{
+			ItemId: item.Id,
+			UserId: item.UserId,
+		})
+		if !errors.Is(err, service.ErrShareBurnAfterRead) {
+			t.Error("Expected 'ErrShareBurnAfterRead'. Got: ", err)
+		}
+	})
+}
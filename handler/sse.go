@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// eventStreamKeepAliveInterval is also the interval in which streams check
+// that the client is still signed in.
+var eventStreamKeepAliveInterval time.Duration = time.Second * 30
+
+type eventStream struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+}
+
+func newEventStream(w http.ResponseWriter) (*eventStream, error) {
+	stream := &eventStream{
+		w:          w,
+		controller: http.NewResponseController(w),
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	return stream, stream.controller.Flush()
+}
+
+func (s *eventStream) send(event string, data string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	if _, err := s.w.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
+
+func (s *eventStream) keepAlive() error {
+	if _, err := s.w.Write([]byte(": keep-alive\n\n")); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
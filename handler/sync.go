@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/michaelhass/cpaw/clipsync"
+	"github.com/michaelhass/cpaw/ctx"
+	"github.com/michaelhass/cpaw/models"
+	"github.com/michaelhass/cpaw/service"
+)
+
+const (
+	syncHandshakeTimeout time.Duration = time.Second * 10
+	syncWriteTimeout     time.Duration = time.Second * 10
+	maxSyncReplayCount   int           = 500
+)
+
+// syncHeartbeatInterval is also the interval in which sync sessions check that
+// the client is still signed in.
+var syncHeartbeatInterval time.Duration = clipsync.HeartbeatInterval
+
+const errMissingWriteScope string = "Missing scope " + string(models.ItemsWriteScope)
+
+var (
+	errHeartbeatTimeout = errors.New("Heartbeat timeout")
+	errSignedOut        = errors.New("Signed out")
+)
+
+func (api *ApiHandler) handleSync(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		Subprotocols: []string{clipsync.Subprotocol},
+	})
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+
+	if conn.Subprotocol() != clipsync.Subprotocol {
+		conn.Close(websocket.StatusPolicyViolation, "Unsupported subprotocol")
+		return
+	}
+	conn.SetReadLimit(clipsync.MaxMessageSize)
+
+	session := &syncSession{
+		conn:        conn,
+		authService: api.authService,
+		itemService: api.itemService,
+		userId:      userId,
+		canWrite:    ctx.HasScope(r.Context(), models.ItemsWriteScope),
+	}
+	err = session.run(r.Context())
+
+	switch {
+	case errors.Is(err, errHeartbeatTimeout), errors.Is(err, errSignedOut):
+		conn.Close(websocket.StatusPolicyViolation, err.Error())
+	case r.Context().Err() != nil:
+		conn.Close(websocket.StatusGoingAway, "")
+	default:
+		conn.Close(websocket.StatusNormalClosure, "")
+	}
+}
+
+type syncSession struct {
+	conn        *websocket.Conn
+	authService *service.AuthService
+	itemService *service.ItemService
+	userId      string
+	canWrite    bool
+}
+
+func (s *syncSession) run(parent context.Context) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	helloCtx, cancelHello := context.WithTimeout(ctx, syncHandshakeTimeout)
+	var hello clipsync.Message
+	err := wsjson.Read(helloCtx, s.conn, &hello)
+	cancelHello()
+	if err != nil {
+		return err
+	}
+	if hello.Type != clipsync.HelloMessage {
+		return s.write(ctx, clipsync.Message{Type: clipsync.ErrorMessage, Error: "Expected hello"})
+	}
+	if hello.Version != clipsync.ProtocolVersion {
+		return s.write(ctx, clipsync.Message{Type: clipsync.ErrorMessage, Error: "Unsupported protocol version"})
+	}
+
+	events, unsubscribe := s.itemService.SubscribeItemEvents(s.userId)
+	defer unsubscribe()
+
+	missed, resumed := s.missedItems(ctx, hello.LastItemId)
+	welcome := clipsync.Message{Type: clipsync.WelcomeMessage, Version: clipsync.ProtocolVersion, Resumed: resumed}
+	if err := s.write(ctx, welcome); err != nil {
+		return err
+	}
+	for _, item := range missed {
+		msg := clipsync.Message{Type: clipsync.ItemCreatedMessage, ItemId: item.Id, Item: &item}
+		if err := s.write(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	incoming := make(chan clipsync.Message)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			var msg clipsync.Message
+			if err := wsjson.Read(ctx, s.conn, &msg); err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case incoming <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(syncHeartbeatInterval)
+	defer heartbeat.Stop()
+	lastSeen := time.Now()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			msg, ok := clipsync.NewItemEventMessage(event)
+			if !ok {
+				continue
+			}
+			if err := s.write(ctx, msg); err != nil {
+				return err
+			}
+		case msg := <-incoming:
+			lastSeen = time.Now()
+			reply, ok := s.handle(ctx, msg)
+			if !ok {
+				continue
+			}
+			if err := s.write(ctx, reply); err != nil {
+				return err
+			}
+		case err := <-readErr:
+			return err
+		case <-heartbeat.C:
+			if time.Since(lastSeen) > clipsync.HeartbeatTimeout {
+				return errHeartbeatTimeout
+			}
+			if err := checkAuthentication(ctx, s.authService); err != nil {
+				return errSignedOut
+			}
+			if err := s.write(ctx, clipsync.Message{Type: clipsync.PingMessage}); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// missedItems returns the items created since lastItemId, oldest first. It
+// reports false if the stream can not be resumed from lastItemId.
+func (s *syncSession) missedItems(ctx context.Context, lastItemId string) ([]models.Item, bool) {
+	if len(lastItemId) == 0 {
+		return nil, false
+	}
+
+	// GetItemForUser would delete a burn after read item, which the client
+	// has only been told about but not read.
+	lastItem, err := s.itemService.GetItemForUpdate(ctx, service.GetItemForUserParams{
+		ItemId: lastItemId,
+		UserId: s.userId,
+	})
+	if err != nil {
+		return nil, false
+	}
+
+	items, err := s.itemService.ListItemsForUserCreatedSince(ctx, service.ListItemsForUserCreatedSinceParams{
+		UserId:    s.userId,
+		CreatedAt: lastItem.CreatedAt,
+		Limit:     maxSyncReplayCount + 1,
+	})
+	if err != nil || len(items) > maxSyncReplayCount {
+		return nil, false
+	}
+
+	missed := []models.Item{}
+	for _, item := range items {
+		if item.Id != lastItemId {
+			missed = append(missed, item)
+		}
+	}
+	return missed, true
+}
+
+func (s *syncSession) handle(ctx context.Context, msg clipsync.Message) (clipsync.Message, bool) {
+	switch msg.Type {
+	case clipsync.PingMessage:
+		return clipsync.Message{Type: clipsync.PongMessage}, true
+	case clipsync.PongMessage:
+		return clipsync.Message{}, false
+	case clipsync.CreateItemMessage:
+		if !s.canWrite {
+			return syncErrorMessage(msg, errMissingWriteScope), true
+		}
+		item, err := s.itemService.CreateItem(ctx, service.CreateItemsParams{
+			Content: msg.Content,
+			UserId:  s.userId,
+		})
+		if err != nil {
+			return syncErrorMessage(msg, "Unable to create item"), true
+		}
+		return clipsync.Message{
+			Type:      clipsync.AckMessage,
+			RequestId: msg.RequestId,
+			ItemId:    item.Id,
+			Item:      &item,
+		}, true
+	case clipsync.DeleteItemMessage:
+		if !s.canWrite {
+			return syncErrorMessage(msg, errMissingWriteScope), true
+		}
+		err := s.itemService.DeleteItemForUser(ctx, service.DeleteUserItemParams{
+			ItemId: msg.ItemId,
+			UserId: s.userId,
+		})
+		if err != nil {
+			return syncErrorMessage(msg, "Unable to delete item"), true
+		}
+		return clipsync.Message{
+			Type:      clipsync.AckMessage,
+			RequestId: msg.RequestId,
+			ItemId:    msg.ItemId,
+		}, true
+	default:
+		return syncErrorMessage(msg, "Unsupported message type"), true
+	}
+}
+
+func (s *syncSession) write(ctx context.Context, msg clipsync.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, syncWriteTimeout)
+	defer cancel()
+	return wsjson.Write(ctx, s.conn, msg)
+}
+
+func syncErrorMessage(request clipsync.Message, message string) clipsync.Message {
+	return clipsync.Message{
+		Type:      clipsync.ErrorMessage,
+		RequestId: request.RequestId,
+		Error:     message,
+	}
+}
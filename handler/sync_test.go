@@ -0,0 +1,297 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/michaelhass/cpaw/clipsync"
+	"github.com/michaelhass/cpaw/models"
+	"github.com/michaelhass/cpaw/service"
+)
+
+type syncTestServer struct {
+	testServer
+	token string
+	user  models.User
+}
+
+func newSyncTestServer(t *testing.T) syncTestServer {
+	server := newTestServer(t, testServerOptions{users: []testServerUser{{name: "sync_user"}}})
+	return syncTestServer{
+		testServer: server,
+		token:      server.tokens["sync_user"],
+		user:       server.users["sync_user"],
+	}
+}
+
+func nextSyncEvent(t *testing.T, client *clipsync.Client) clipsync.Message {
+	t.Helper()
+	select {
+	case msg, ok := <-client.Events():
+		if !ok {
+			t.Fatal("Events closed:", client.Err())
+		}
+		return msg
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for event")
+	}
+	return clipsync.Message{}
+}
+
+func TestSync(t *testing.T) {
+	server := newSyncTestServer(t)
+	ctx := context.Background()
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		_, err := clipsync.Dial(ctx, server.url, clipsync.DialOptions{Token: "invalid"})
+		if err == nil {
+			t.Error("Expected error for invalid token")
+		}
+	})
+
+	t.Run("CreateAndDelete", func(t *testing.T) {
+		first, err := clipsync.Dial(ctx, server.url, clipsync.DialOptions{Token: server.token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer first.Close()
+		second, err := clipsync.Dial(ctx, server.url, clipsync.DialOptions{Token: server.token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer second.Close()
+
+		item, err := first.CreateItem(ctx, "from first")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Content != "from first" || item.UserId != server.user.Id {
+			t.Errorf("Unexpected item: %v", item)
+		}
+
+		for _, client := range []*clipsync.Client{first, second} {
+			msg := nextSyncEvent(t, client)
+			if msg.Type != clipsync.ItemCreatedMessage || msg.ItemId != item.Id || msg.Item == nil {
+				t.Errorf("Expected item_created for %s. Got: %v", item.Id, msg)
+			}
+			if client.LastItemId() != item.Id {
+				t.Errorf("Expected last item id %s. Got: %s", item.Id, client.LastItemId())
+			}
+		}
+
+		if err := second.DeleteItem(ctx, item.Id); err != nil {
+			t.Fatal(err)
+		}
+		msg := nextSyncEvent(t, first)
+		if msg.Type != clipsync.ItemDeletedMessage || msg.ItemId != item.Id {
+			t.Errorf("Expected item_deleted for %s. Got: %v", item.Id, msg)
+		}
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		create := func(content string) models.Item {
+			item, err := server.itemService.CreateItem(ctx, service.CreateItemsParams{
+				Content: content,
+				UserId:  server.user.Id,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return item
+		}
+
+		lastSeen := create("seen")
+		missed := create("missed")
+
+		client, err := clipsync.Dial(ctx, server.url, clipsync.DialOptions{
+			Token:      server.token,
+			LastItemId: lastSeen.Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		if !client.Resumed() {
+			t.Fatal("Expected resumed stream")
+		}
+		msg := nextSyncEvent(t, client)
+		if msg.Type != clipsync.ItemCreatedMessage || msg.ItemId != missed.Id {
+			t.Errorf("Expected replay of %s. Got: %v", missed.Id, msg)
+		}
+
+		unknown, err := clipsync.Dial(ctx, server.url, clipsync.DialOptions{
+			Token:      server.token,
+			LastItemId: "unknown",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unknown.Close()
+		if unknown.Resumed() {
+			t.Error("Expected stream not to be resumed for unknown item")
+		}
+	})
+
+	t.Run("ResumeFromBurnAfterRead", func(t *testing.T) {
+		secret, err := server.itemService.CreateItem(ctx, service.CreateItemsParams{
+			Content:       "secret",
+			UserId:        server.user.Id,
+			BurnAfterRead: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client, err := clipsync.Dial(ctx, server.url, clipsync.DialOptions{
+			Token:      server.token,
+			LastItemId: secret.Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		if !client.Resumed() {
+			t.Error("Expected resumed stream")
+		}
+		item, err := server.itemService.GetItemForUser(ctx, service.GetItemForUserParams{
+			ItemId: secret.Id,
+			UserId: server.user.Id,
+		})
+		if err != nil || item.Content != "secret" {
+			t.Errorf("Expected burn after read item to be unread after resuming. Got: %v, %v", item, err)
+		}
+	})
+
+	t.Run("ApiTokenScopes", func(t *testing.T) {
+		result, err := server.authService.CreateApiToken(ctx, service.CreateApiTokenParams{
+			UserId: server.user.Id,
+			Name:   "read only",
+			Scopes: []models.Scope{models.ItemsReadScope},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client, err := clipsync.Dial(ctx, server.url, clipsync.DialOptions{Token: result.Token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		if _, err := client.CreateItem(ctx, "not allowed"); err == nil {
+			t.Error("Expected error creating item with read only token")
+		}
+
+		err = server.authService.RevokeApiToken(ctx, service.RevokeApiTokenParams{
+			TokenId: result.ApiToken.Id,
+			UserId:  server.user.Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clipsync.Dial(ctx, server.url, clipsync.DialOptions{Token: result.Token}); err == nil {
+			t.Error("Expected error for revoked token")
+		}
+	})
+
+	t.Run("UnsupportedVersion", func(t *testing.T) {
+		conn, _, err := websocket.Dial(ctx, server.url+clipsync.Path, &websocket.DialOptions{
+			HTTPHeader:   map[string][]string{"Authorization": {"Bearer " + server.token}},
+			Subprotocols: []string{clipsync.Subprotocol},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.CloseNow()
+
+		if err := wsjson.Write(ctx, conn, clipsync.Message{Type: clipsync.HelloMessage, Version: 99}); err != nil {
+			t.Fatal(err)
+		}
+		var msg clipsync.Message
+		if err := wsjson.Read(ctx, conn, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != clipsync.ErrorMessage {
+			t.Errorf("Expected error message. Got: %v", msg)
+		}
+	})
+}
+
+func TestStreamsCloseAfterSignOut(t *testing.T) {
+	keepAliveInterval, heartbeatInterval := eventStreamKeepAliveInterval, syncHeartbeatInterval
+	eventStreamKeepAliveInterval, syncHeartbeatInterval = time.Millisecond*50, time.Millisecond*50
+	t.Cleanup(func() {
+		eventStreamKeepAliveInterval, syncHeartbeatInterval = keepAliveInterval, heartbeatInterval
+	})
+
+	server := newSyncTestServer(t)
+	ctx := context.Background()
+
+	signIn := func(t *testing.T) string {
+		t.Helper()
+		result, err := server.authService.SignIn(ctx, service.SignInParams{UserName: "sync_user", Password: "password"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Session.Token
+	}
+
+	t.Run("Events", func(t *testing.T) {
+		token := signIn(t)
+		req, err := http.NewRequest(http.MethodGet, server.url+"/api/v1/events/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if err := server.authService.SignOut(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+		closed := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, res.Body)
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(time.Second * 5):
+			t.Error("Expected event stream to close after sign out")
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		token := signIn(t)
+		client, err := clipsync.Dial(ctx, server.url, clipsync.DialOptions{Token: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		if err := server.authService.SignOut(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+		timeout := time.After(time.Second * 5)
+		for {
+			select {
+			case _, ok := <-client.Events():
+				if !ok {
+					return
+				}
+			case <-timeout:
+				t.Fatal("Expected sync session to close after sign out")
+			}
+		}
+	})
+}
@@ -4,9 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/a-h/templ"
+
 	"github.com/michaelhass/cpaw/ctx"
+	"github.com/michaelhass/cpaw/db/repository"
 	"github.com/michaelhass/cpaw/middleware"
 	"github.com/michaelhass/cpaw/models"
 	cmux "github.com/michaelhass/cpaw/mux"
@@ -15,43 +20,97 @@ import (
 )
 
 type TemplateHandler struct {
-	authService *service.AuthService
-	itemService *service.ItemService
+	authService      *service.AuthService
+	itemService      *service.ItemService
+	shareService     *service.ShareService
+	workspaceService *service.WorkspaceService
+	// oidcService is nil unless single sign-on is configured.
+	oidcService *service.OidcService
+	config      handlerConfig
 }
 
 func NewTemplateHandler(
 	authService *service.AuthService,
 	itemService *service.ItemService,
+	shareService *service.ShareService,
+	workspaceService *service.WorkspaceService,
+	oidcService *service.OidcService,
+	opts ...HandlerOption,
 ) *TemplateHandler {
 	return &TemplateHandler{
-		authService: authService,
-		itemService: itemService,
+		authService:      authService,
+		itemService:      itemService,
+		shareService:     shareService,
+		workspaceService: workspaceService,
+		oidcService:      oidcService,
+		config:           newHandlerConfig(opts),
 	}
 }
 
 func (th *TemplateHandler) RegisterRoutes(mux *cmux.Mux) {
 	indexRedirectPath := "/"
-	authProtectedRedirect := middleware.AuthProtectedRedirect(th.authService, sessionCookieName, indexRedirectPath)
-	mux.Use(middleware.SetAuthenticatedUserCtx(th.authService, sessionCookieName))
+	authProtectedRedirect := middleware.AuthProtectedRedirect(
+		th.authService,
+		th.config.cookie(sessionCookieName),
+		indexRedirectPath,
+	)
+	canManageUsers := middleware.RequirePermission(th.authService, models.ManageUsersPermission)
+	mux.Use(middleware.Csrf(th.config.cookie(csrfCookieName)))
+	mux.Use(middleware.SetAuthenticatedUserCtx(th.authService, th.config.cookie(sessionCookieName)))
 	mux.HandleFunc("/", th.handleIndexPage)
 
 	mux.HandleFunc("POST /signin/", th.handleSignIn(indexRedirectPath))
+	mux.HandleFunc("POST /signin/2fa/", th.handleVerifyTwoFactor(indexRedirectPath))
+	mux.HandleFunc("GET /signin/oidc/", th.handleOidcSignIn)
+	mux.HandleFunc("GET /signin/oidc/callback/", th.handleOidcCallback(indexRedirectPath))
 	mux.HandleFunc("POST /signout/", th.handleSignOut(indexRedirectPath))
 
+	mux.Handle("GET /events/", authProtectedRedirect(http.HandlerFunc(th.handleItemEvents)))
+
+	mux.HandleFunc("GET /s/{token}/", th.handleSharePage)
+	mux.HandleFunc("POST /s/{token}/", th.handleSharePage)
+	mux.HandleFunc("GET /s/{token}/raw/", th.handleRawShare)
+
 	mux.Group("/items", func(items *cmux.Mux) {
 		items.Use(authProtectedRedirect)
 		items.HandleFunc("GET /", th.handleGetItems)
 		items.HandleFunc("POST /", th.handleCreateItem)
+		items.HandleFunc("GET /{itemId}/", th.handleGetItem)
+		items.HandleFunc("PUT /{itemId}/", th.handleUpdateItem)
+		items.HandleFunc("GET /{itemId}/edit/", th.handleEditItemForm)
+		items.HandleFunc("GET /{itemId}/revisions/", th.handleGetItemRevisions)
+		items.HandleFunc("POST /{itemId}/revisions/{revisionId}/restore/", th.handleRestoreItemRevision)
 		items.HandleFunc("DELETE /{itemId}/", th.handleDeleteItem)
+		items.HandleFunc("GET /{itemId}/attachments/{attachmentId}/", th.handleGetItemAttachment)
+		items.HandleFunc("GET /{itemId}/shares/", th.handleGetItemShares)
+		items.HandleFunc("POST /{itemId}/shares/", th.handleCreateItemShare)
+		items.HandleFunc("DELETE /{itemId}/shares/{shareId}/", th.handleRevokeItemShare)
 	})
 
 	mux.Group("/settings", func(settings *cmux.Mux) {
 		settings.Use(authProtectedRedirect)
 		settings.HandleFunc("GET /", th.handleSettingsPage)
 		settings.HandleFunc("PUT /auth/password/", th.handleUpdateUserPassword)
-		settings.HandleFunc("GET /auth/users/", th.handleGetUsers)
-		settings.HandleFunc("POST /auth/users/", th.handleCreateUser)
-		settings.HandleFunc("DELETE /auth/users/{userId}/", th.handleDeleteUserById)
+		settings.Handle("GET /auth/users/", canManageUsers(http.HandlerFunc(th.handleGetUsers)))
+		settings.Handle("POST /auth/users/", canManageUsers(http.HandlerFunc(th.handleCreateUser)))
+		settings.Handle("DELETE /auth/users/{userId}/", canManageUsers(http.HandlerFunc(th.handleDeleteUserById)))
+		settings.Handle("DELETE /auth/users/{userId}/lock/", canManageUsers(http.HandlerFunc(th.handleUnlockUser)))
+		settings.Handle("DELETE /auth/users/{userId}/2fa/", canManageUsers(http.HandlerFunc(th.handleResetTwoFactor)))
+		settings.HandleFunc("POST /2fa/", th.handleBeginTotpEnrollment)
+		settings.HandleFunc("POST /2fa/confirm/", th.handleConfirmTotpEnrollment)
+		settings.HandleFunc("POST /2fa/disable/", th.handleDisableTwoFactor)
+		settings.HandleFunc("GET /sessions/", th.handleGetSessions)
+		settings.HandleFunc("DELETE /sessions/", th.handleSignOutOtherSessions)
+		settings.HandleFunc("DELETE /sessions/{sessionId}/", th.handleRevokeSession)
+		settings.HandleFunc("GET /tokens/", th.handleGetApiTokens)
+		settings.HandleFunc("POST /tokens/", th.handleCreateApiToken)
+		settings.HandleFunc("DELETE /tokens/{tokenId}/", th.handleRevokeApiToken)
+		settings.HandleFunc("GET /workspaces/", th.handleGetWorkspaces)
+		settings.HandleFunc("POST /workspaces/", th.handleCreateWorkspace)
+		settings.HandleFunc("DELETE /workspaces/{workspaceId}/", th.handleDeleteWorkspace)
+		settings.HandleFunc("GET /workspaces/{workspaceId}/members/", th.handleGetWorkspaceMembers)
+		settings.HandleFunc("POST /workspaces/{workspaceId}/members/", th.handleAddWorkspaceMember)
+		settings.HandleFunc("DELETE /workspaces/{workspaceId}/members/{userId}/", th.handleRemoveWorkspaceMember)
 	})
 }
 
@@ -59,31 +118,133 @@ func (th *TemplateHandler) handleIndexPage(w http.ResponseWriter, r *http.Reques
 	context := r.Context()
 	user, _ := ctx.GetUser(context)
 	viewData := views.IndexPageData{
-		User: user,
+		User:        user,
+		OidcEnabled: th.oidcService != nil,
+	}
+
+	if len(user.Id) > 0 {
+		viewData.Workspaces, _ = th.workspaceService.ListWorkspacesForUser(context, user.Id)
+	}
+	if workspaceId := r.URL.Query().Get("workspace"); len(workspaceId) > 0 && len(user.Id) > 0 {
+		workspace, err := th.workspaceService.GetWorkspaceForUser(context, service.GetWorkspaceForUserParams{
+			WorkspaceId: workspaceId,
+			UserId:      user.Id,
+		})
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		viewData.Workspace = workspace
 	}
+
 	indexPage := views.IndexPage(viewData)
 	indexPage.Render(context, w)
 }
 
 func (th *TemplateHandler) handleSignIn(onSuccesRedirect string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var (
-			user     = r.FormValue("username")
-			password = r.FormValue("password")
-		)
-
-		authResult, err := th.authService.SignIn(r.Context(), user, password)
-		if err != nil {
+		authResult, err := th.authService.SignIn(r.Context(), service.SignInParams{
+			UserName:  r.FormValue("username"),
+			Password:  r.FormValue("password"),
+			Remember:  r.FormValue("remember") == "true",
+			UserAgent: r.UserAgent(),
+			IpAddress: remoteIpAddress(r),
+		})
+		if errors.Is(err, service.ErrTooManyLoginAttempts) {
+			writeLoginLocked(w, err)
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			w.Write([]byte(fmt.Sprintf("Invalid credentials")))
 			return
 		}
-		cookie := &http.Cookie{}
-		cookie.Name = sessionCookieName
-		cookie.Value = authResult.Session.Token
-		cookie.Expires = time.Unix(authResult.Session.ExpiresAt, 0)
-		cookie.Path = "/"
-		http.SetCookie(w, cookie)
+		if len(authResult.TwoFactorToken) > 0 {
+			views.TwoFactorSignInForm(authResult.TwoFactorToken).Render(r.Context(), w)
+			return
+		}
+		middleware.SetSessionCookie(w, th.config.cookie(sessionCookieName), authResult.Session)
+
+		http.Redirect(w, r, onSuccesRedirect, http.StatusSeeOther)
+	}
+}
+
+func (th *TemplateHandler) handleOidcSignIn(w http.ResponseWriter, r *http.Request) {
+	if th.oidcService == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	authRequest, err := th.oidcService.BeginSignIn()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	setOidcCookie(w, th.config.cookie(oidcCookieName), authRequest)
+	http.Redirect(w, r, authRequest.URL, http.StatusFound)
+}
+
+func (th *TemplateHandler) handleOidcCallback(onSuccesRedirect string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if th.oidcService == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		authRequest, ok := popOidcCookie(w, r, th.config.cookie(oidcCookieName))
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Single sign-on expired. Please try again"))
+			return
+		}
+		if providerError := r.URL.Query().Get("error"); len(providerError) > 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(service.ErrOidcSignIn.Error() + ": " + providerError))
+			return
+		}
+
+		authResult, err := th.oidcService.SignIn(r.Context(), service.OidcSignInParams{
+			Code:      r.URL.Query().Get("code"),
+			Verifier:  authRequest.Verifier,
+			Nonce:     authRequest.Nonce,
+			UserAgent: r.UserAgent(),
+			IpAddress: remoteIpAddress(r),
+		})
+		if errors.Is(err, service.ErrOidcSignIn) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(service.ErrOidcSignIn.Error()))
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		middleware.SetSessionCookie(w, th.config.cookie(sessionCookieName), authResult.Session)
+
+		http.Redirect(w, r, onSuccesRedirect, http.StatusSeeOther)
+	}
+}
+
+func (th *TemplateHandler) handleVerifyTwoFactor(onSuccesRedirect string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authResult, err := th.authService.VerifyTwoFactor(r.Context(), service.VerifyTwoFactorParams{
+			Token: r.FormValue("token"),
+			Code:  r.FormValue("code"),
+		})
+		if errors.Is(err, service.ErrTooManyLoginAttempts) {
+			writeLoginLocked(w, err)
+			return
+		} else if errors.Is(err, service.ErrInvalidTwoFactorCode) ||
+			errors.Is(err, service.ErrExpiredLoginChallenge) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(err.Error()))
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		middleware.SetSessionCookie(w, th.config.cookie(sessionCookieName), authResult.Session)
 
 		http.Redirect(w, r, onSuccesRedirect, http.StatusSeeOther)
 	}
@@ -98,11 +259,7 @@ func (th *TemplateHandler) handleSignOut(redirectTo string) http.HandlerFunc {
 			th.authService.SignOut(r.Context(), token)
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:    sessionCookieName,
-			Value:   "",
-			Expires: time.Now(),
-		})
+		middleware.ClearSessionCookie(w, th.config.cookie(sessionCookieName))
 		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
 	}
 }
@@ -115,8 +272,28 @@ func (th *TemplateHandler) handleGetItems(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	items, _ := th.itemService.ListItemsForUser(context, userId)
-	itemsList := views.ItemList(items)
+	if query := r.FormValue("q"); len(query) > 0 {
+		results, _ := th.itemService.SearchItemsForUser(context, service.SearchItemsForUserParams{
+			UserId:      userId,
+			WorkspaceId: r.FormValue("workspace"),
+			Query:       query,
+		})
+		views.SearchResultList(results).Render(context, w)
+		return
+	}
+
+	params, err := parseListItemsParams(r, userId)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	page, _ := th.itemService.ListItemsForUser(context, params)
+	if !params.Cursor.IsZero() {
+		views.ItemListPage(page).Render(context, w)
+		return
+	}
+	itemsList := views.ItemList(page)
 	itemsList.Render(r.Context(), w)
 }
 
@@ -128,21 +305,51 @@ func (th *TemplateHandler) handleCreateItem(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	content := r.FormValue("content")
-	item, err := th.itemService.CreateItem(context, service.CreateItemsParams{
-		Content: content,
-		UserId:  userId,
-	})
+	var attachments []service.CreateAttachmentParams
+	if isMultipartRequest(r) {
+		var err error
+		attachments, err = parseMultipartAttachments(w, r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
 
-	if err != nil {
+	params := service.CreateItemsParams{
+		Content:     r.FormValue("content"),
+		UserId:      userId,
+		WorkspaceId: r.FormValue("workspace"),
+		Attachments: attachments,
+	}
+	if err := parseItemExpiryForm(r, &params); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	item, err := th.itemService.CreateItem(context, params)
+	if isInvalidItemError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	views.Item(item).Render(context, w)
+	// The response must not reveal a burn after read item, showing it would
+	// not burn it.
+	if item.BurnAfterRead {
+		item.Content = ""
+	}
+	views.ItemUpsert(item).Render(context, w)
 }
 
-func (th *TemplateHandler) handleDeleteItem(w http.ResponseWriter, r *http.Request) {
+// handleGetItem renders a single item. Burn after read items are revealed and
+// deleted by this.
+func (th *TemplateHandler) handleGetItem(w http.ResponseWriter, r *http.Request) {
 	context := r.Context()
 	userId, ok := ctx.GetUserId(context)
 	if !ok || len(userId) == 0 {
@@ -150,106 +357,945 @@ func (th *TemplateHandler) handleDeleteItem(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	itemId := r.PathValue("itemId")
-	err := th.itemService.DeleteItemForUser(context, service.DeleteUserItemParams{
-		ItemId: itemId,
+	item, err := th.itemService.GetItemForUser(context, service.GetItemForUserParams{
+		ItemId: r.PathValue("itemId"),
 		UserId: userId,
 	})
-	if err != nil {
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
+	if item.BurnAfterRead {
+		views.RevealedItem(item).Render(context, w)
+		return
+	}
+	views.Item(item).Render(context, w)
 }
 
-func (th *TemplateHandler) handleSettingsPage(w http.ResponseWriter, r *http.Request) {
+func (th *TemplateHandler) handleEditItemForm(w http.ResponseWriter, r *http.Request) {
 	context := r.Context()
-	user, _ := ctx.GetUser(context)
-	viewData := views.SettingsPageData{
-		User: user,
+	userId, ok := ctx.GetUserId(context)
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
 	}
-	settingsPage := views.SettingsPage(viewData)
-	settingsPage.Render(context, w)
+
+	item, err := th.itemService.GetItemForUpdate(context, service.GetItemForUserParams{
+		ItemId: r.PathValue("itemId"),
+		UserId: userId,
+	})
+	if errors.Is(err, repository.ErrNotFound) || item.BurnAfterRead {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	views.ItemEditForm(item).Render(context, w)
 }
 
-func (th *TemplateHandler) handleUpdateUserPassword(w http.ResponseWriter, r *http.Request) {
-	userId, ok := ctx.GetUserId(r.Context())
+func (th *TemplateHandler) handleUpdateItem(w http.ResponseWriter, r *http.Request) {
+	context := r.Context()
+	userId, ok := ctx.GetUserId(context)
 	if !ok || len(userId) == 0 {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	password := r.FormValue("password")
-	err := th.authService.UpdatePassword(r.Context(), service.UpdatePasswordParams{
-		UserId:   userId,
-		Password: password,
+	item, err := th.itemService.UpdateItemForUser(context, service.UpdateItemForUserParams{
+		ItemId:  r.PathValue("itemId"),
+		UserId:  userId,
+		Content: r.FormValue("content"),
 	})
-
-	if errors.Is(err, service.ErrMinPasswordLength) {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error()))
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
 		return
 	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
-	w.Write([]byte("Password updated"))
+	views.Item(item).Render(context, w)
 }
 
-func (th *TemplateHandler) handleCreateUser(w http.ResponseWriter, r *http.Request) {
-	currentUserId, ok := ctx.GetUserId(r.Context())
-	if !ok || len(currentUserId) == 0 {
+func (th *TemplateHandler) handleGetItemRevisions(w http.ResponseWriter, r *http.Request) {
+	context := r.Context()
+	userId, ok := ctx.GetUserId(context)
+	if !ok || len(userId) == 0 {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	username := r.FormValue("username")
-	password := r.FormValue("password")
-	role := models.Role(r.FormValue("role"))
+	itemId := r.PathValue("itemId")
+	revisions, err := th.itemService.ListItemRevisionsForUser(context, service.ListItemRevisionsForUserParams{
+		ItemId: itemId,
+		UserId: userId,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	user, err := th.authService.CreateUser(r.Context(), service.CreateUserParams{
-		UserName: username,
-		Password: password,
-		Role:     role,
+	views.ItemRevisions(itemId, revisions).Render(context, w)
+}
+
+func (th *TemplateHandler) handleRestoreItemRevision(w http.ResponseWriter, r *http.Request) {
+	context := r.Context()
+	userId, ok := ctx.GetUserId(context)
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	item, err := th.itemService.RestoreItemRevision(context, service.RestoreItemRevisionParams{
+		RevisionId: r.PathValue("revisionId"),
+		ItemId:     r.PathValue("itemId"),
+		UserId:     userId,
 	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
+	views.Item(item).Render(context, w)
+}
+
+func (th *TemplateHandler) handleItemEvents(w http.ResponseWriter, r *http.Request) {
+	context := r.Context()
+	userId, ok := ctx.GetUserId(context)
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Every page shows either the personal items or the items of a single
+	// workspace.
+	workspaceId := r.URL.Query().Get("workspace")
+	events, unsubscribe := th.itemService.SubscribeItemEvents(userId)
+	defer unsubscribe()
+
+	stream, err := newEventStream(w)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
-	userRow := views.SettingsUserRow(newSettingsUserRowData(user, currentUserId))
-	userRow.Render(r.Context(), w)
+	keepAlive := time.NewTicker(eventStreamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.WorkspaceId != workspaceId {
+				continue
+			}
+			var component templ.Component
+			switch event.Type {
+			case models.ItemCreatedEvent:
+				component = views.ItemUpsert(*event.Item)
+			case models.ItemDeletedEvent:
+				component = views.ItemRemoval(event.ItemId)
+			case models.ItemUpdatedEvent:
+				component = views.ItemReplacement(*event.Item)
+			default:
+				continue
+			}
+			var data strings.Builder
+			if err := component.Render(context, &data); err != nil {
+				continue
+			}
+			if err := stream.send(string(event.Type), data.String()); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if err := checkAuthentication(context, th.authService); err != nil {
+				return
+			}
+			if err := stream.keepAlive(); err != nil {
+				return
+			}
+		case <-context.Done():
+			return
+		}
+	}
 }
 
-func (th *TemplateHandler) handleDeleteUserById(w http.ResponseWriter, r *http.Request) {
-	err := th.authService.DeleteUserById(r.Context(), r.PathValue("userId"))
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+func (th *TemplateHandler) handleDeleteItem(w http.ResponseWriter, r *http.Request) {
+	context := r.Context()
+	userId, ok := ctx.GetUserId(context)
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	itemId := r.PathValue("itemId")
+	err := th.itemService.DeleteItemForUser(context, service.DeleteUserItemParams{
+		ItemId: itemId,
+		UserId: userId,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+
 	w.WriteHeader(http.StatusAccepted)
 }
 
-func (th *TemplateHandler) handleGetUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := th.authService.ListUsers(r.Context())
-	if err != nil {
+func (th *TemplateHandler) handleGetItemAttachment(w http.ResponseWriter, r *http.Request) {
+	context := r.Context()
+	userId, ok := ctx.GetUserId(context)
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	attachment, err := th.itemService.GetAttachmentForUser(context, service.GetAttachmentForUserParams{
+		AttachmentId: r.PathValue("attachmentId"),
+		ItemId:       r.PathValue("itemId"),
+		UserId:       userId,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	currentUserId, _ := ctx.GetUserId(r.Context())
+	writeAttachment(w, attachment)
+}
 
-	var viewData []views.SettingsUserRowData
-	for _, user := range users {
-		viewData = append(viewData, newSettingsUserRowData(user, currentUserId))
+func (th *TemplateHandler) handleGetItemShares(w http.ResponseWriter, r *http.Request) {
+	context := r.Context()
+	userId, ok := ctx.GetUserId(context)
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
 	}
-	rows := views.SettingsUserRows(viewData)
-	rows.Render(r.Context(), w)
+
+	itemId := r.PathValue("itemId")
+	shares, err := th.shareService.ListSharesForItem(context, service.ListSharesForItemParams{
+		ItemId: itemId,
+		UserId: userId,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	views.ItemShares(itemId, shares).Render(context, w)
+}
+
+func (th *TemplateHandler) handleCreateItemShare(w http.ResponseWriter, r *http.Request) {
+	context := r.Context()
+	userId, ok := ctx.GetUserId(context)
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	itemId := r.PathValue("itemId")
+	params := service.CreateShareParams{ItemId: itemId, UserId: userId}
+	if err := parseShareForm(r, &params); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	_, err := th.shareService.CreateShare(context, params)
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if isInvalidShareError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	th.handleGetItemShares(w, r)
+}
+
+func (th *TemplateHandler) handleRevokeItemShare(w http.ResponseWriter, r *http.Request) {
+	context := r.Context()
+	userId, ok := ctx.GetUserId(context)
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := th.shareService.RevokeShare(context, service.RevokeShareParams{
+		ShareId: r.PathValue("shareId"),
+		ItemId:  r.PathValue("itemId"),
+		UserId:  userId,
+	})
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleSharePage shows a shared item to anyone with the link. Password
+// protected shares are only viewed, and counted, once the password has been
+// posted.
+func (th *TemplateHandler) handleSharePage(w http.ResponseWriter, r *http.Request) {
+	context := r.Context()
+	pageData := views.SharePageData{Token: r.PathValue("token")}
+
+	share, err := th.shareService.GetShare(context, pageData.Token)
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		views.SharePage(pageData).Render(context, w)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if share.HasPassword && r.Method != http.MethodPost {
+		pageData.PasswordRequired = true
+		views.SharePage(pageData).Render(context, w)
+		return
+	}
+
+	item, err := th.shareService.ViewShare(context, service.ViewShareParams{
+		Token:    pageData.Token,
+		Password: r.FormValue("password"),
+	})
+	if errors.Is(err, service.ErrSharePassword) {
+		pageData.PasswordRequired = true
+		pageData.Error = err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		views.SharePage(pageData).Render(context, w)
+		return
+	} else if errors.Is(err, service.ErrTooManyLoginAttempts) {
+		pageData.PasswordRequired = true
+		pageData.Error = err.Error()
+		setRetryAfter(w, err)
+		w.WriteHeader(http.StatusTooManyRequests)
+		views.SharePage(pageData).Render(context, w)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		views.SharePage(pageData).Render(context, w)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	pageData.Item = &item
+	views.SharePage(pageData).Render(context, w)
+}
+
+func (th *TemplateHandler) handleRawShare(w http.ResponseWriter, r *http.Request) {
+	item, err := th.shareService.ViewShare(r.Context(), service.ViewShareParams{
+		Token:    r.PathValue("token"),
+		Password: sharePassword(r),
+	})
+	if errors.Is(err, service.ErrSharePassword) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="cpaw share"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if errors.Is(err, service.ErrTooManyLoginAttempts) {
+		writeLoginLocked(w, err)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write([]byte(item.Content))
+}
+
+func (th *TemplateHandler) handleSettingsPage(w http.ResponseWriter, r *http.Request) {
+	context := r.Context()
+	user, _ := ctx.GetUser(context)
+	viewData := views.SettingsPageData{
+		User: user,
+	}
+	if user.TwoFactorEnabled {
+		count, err := th.authService.CountRecoveryCodes(context, user.Id)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		viewData.RecoveryCodeCount = count
+	}
+	settingsPage := views.SettingsPage(viewData)
+	settingsPage.Render(context, w)
+}
+
+func (th *TemplateHandler) handleUpdateUserPassword(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	session, _ := ctx.GetSession(r.Context())
+	password := r.FormValue("password")
+	err := th.authService.UpdatePassword(r.Context(), service.UpdatePasswordParams{
+		UserId:       userId,
+		Password:     password,
+		SessionToken: session.Token,
+	})
+
+	if errors.Is(err, service.ErrMinPasswordLength) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Trigger", views.SessionsChangedEvent)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("Password updated"))
+}
+
+func (th *TemplateHandler) handleBeginTotpEnrollment(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := th.authService.BeginTotpEnrollment(r.Context(), userId)
+	if isInvalidTwoFactorError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	qrCode, err := totpQRCode(enrollment.URL)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	views.SettingsTwoFactorEnrollment(qrCode, enrollment.Secret).Render(r.Context(), w)
+}
+
+func (th *TemplateHandler) handleConfirmTotpEnrollment(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := th.authService.ConfirmTotpEnrollment(r.Context(), service.ConfirmTotpEnrollmentParams{
+		UserId: userId,
+		Code:   r.FormValue("code"),
+	})
+	if isInvalidTwoFactorError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	views.SettingsTwoFactorRecoveryCodes(codes).Render(r.Context(), w)
+}
+
+func (th *TemplateHandler) handleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := th.authService.DisableTwoFactor(r.Context(), service.DisableTwoFactorParams{
+		UserId:   userId,
+		Password: r.FormValue("password"),
+	})
+	if isInvalidTwoFactorError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	views.SettingsTwoFactor(false, 0).Render(r.Context(), w)
+}
+
+func (th *TemplateHandler) handleGetSessions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := th.authService.ListSessions(r.Context(), userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	current, _ := ctx.GetSession(r.Context())
+	views.SettingsSessionRows(sessions, current.Id).Render(r.Context(), w)
+}
+
+func (th *TemplateHandler) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := th.authService.RevokeSession(r.Context(), service.RevokeSessionParams{
+		SessionId: r.PathValue("sessionId"),
+		UserId:    userId,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (th *TemplateHandler) handleSignOutOtherSessions(w http.ResponseWriter, r *http.Request) {
+	session, ok := ctx.GetSession(r.Context())
+	if !ok || len(session.UserId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := th.authService.SignOutOtherSessions(r.Context(), service.SignOutOtherSessionsParams{
+		UserId:    session.UserId,
+		KeepToken: session.Token,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("HX-Trigger", views.SessionsChangedEvent)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (th *TemplateHandler) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	currentUserId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(currentUserId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	username := r.FormValue("username")
+	password := r.FormValue("password")
+	role := models.Role(r.FormValue("role"))
+
+	user, err := th.authService.CreateUser(r.Context(), service.CreateUserParams{
+		UserName: username,
+		Password: password,
+		Role:     role,
+	})
+
+	if errors.Is(err, service.ErrMinPasswordLength) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	userRow := views.SettingsUserRow(newSettingsUserRowData(user, currentUserId))
+	userRow.Render(r.Context(), w)
+}
+
+func (th *TemplateHandler) handleDeleteUserById(w http.ResponseWriter, r *http.Request) {
+	currentUserId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(currentUserId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := th.authService.DeleteUser(r.Context(), service.DeleteUserParams{
+		UserId:    r.PathValue("userId"),
+		DeletedBy: currentUserId,
+	})
+	if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (th *TemplateHandler) handleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	currentUserId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(currentUserId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userId := r.PathValue("userId")
+	err := th.authService.UnlockUser(r.Context(), service.UnlockUserParams{
+		UserId:     userId,
+		UnlockedBy: currentUserId,
+	})
+	if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := th.authService.GetUserById(r.Context(), userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	views.SettingsUserRow(newSettingsUserRowData(user, currentUserId)).Render(r.Context(), w)
+}
+
+func (th *TemplateHandler) handleResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	currentUserId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(currentUserId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userId := r.PathValue("userId")
+	err := th.authService.ResetTwoFactor(r.Context(), service.ResetTwoFactorParams{
+		UserId:  userId,
+		ResetBy: currentUserId,
+	})
+	if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := th.authService.GetUserById(r.Context(), userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	views.SettingsUserRow(newSettingsUserRowData(user, currentUserId)).Render(r.Context(), w)
+}
+
+func (th *TemplateHandler) handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := th.authService.ListUsers(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	locked, err := th.authService.ListLockedUserNames(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	lockedUntil := map[string]int64{}
+	for _, attempt := range locked {
+		lockedUntil[attempt.Key] = attempt.LockedUntil
+	}
+
+	currentUserId, _ := ctx.GetUserId(r.Context())
+
+	var viewData []views.SettingsUserRowData
+	for _, user := range users {
+		rowData := newSettingsUserRowData(user, currentUserId)
+		rowData.LockedUntil = lockedUntil[user.UserName]
+		viewData = append(viewData, rowData)
+	}
+	rows := views.SettingsUserRows(viewData)
+	rows.Render(r.Context(), w)
+}
+
+func (th *TemplateHandler) handleGetApiTokens(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := th.authService.ListApiTokens(r.Context(), userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	views.SettingsApiTokenRows(tokens).Render(r.Context(), w)
+}
+
+func (th *TemplateHandler) handleCreateApiToken(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var scopes []models.Scope
+	for _, scope := range r.Form["scopes"] {
+		scopes = append(scopes, models.Scope(scope))
+	}
+
+	var expiresAt time.Time
+	if days := r.FormValue("expires_in_days"); len(days) > 0 {
+		count, err := strconv.Atoi(days)
+		if err != nil || count <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid expiration"))
+			return
+		}
+		expiresAt = time.Now().AddDate(0, 0, count)
+	}
+
+	result, err := th.authService.CreateApiToken(r.Context(), service.CreateApiTokenParams{
+		UserId:    userId,
+		Name:      r.FormValue("name"),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if errors.Is(err, service.ErrApiTokenName) ||
+		errors.Is(err, service.ErrApiTokenScopes) ||
+		errors.Is(err, service.ErrApiTokenExpiresAt) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Trigger", views.ApiTokenCreatedEvent)
+	w.WriteHeader(http.StatusCreated)
+	views.SettingsApiTokenCreated(result.Token, result.ApiToken).Render(r.Context(), w)
+}
+
+func (th *TemplateHandler) handleRevokeApiToken(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := th.authService.RevokeApiToken(r.Context(), service.RevokeApiTokenParams{
+		TokenId: r.PathValue("tokenId"),
+		UserId:  userId,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (th *TemplateHandler) handleGetWorkspaces(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	workspaces, err := th.workspaceService.ListWorkspacesForUser(r.Context(), userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	views.SettingsWorkspaceRows(workspaces, userId).Render(r.Context(), w)
+}
+
+func (th *TemplateHandler) handleCreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	_, err := th.workspaceService.CreateWorkspace(r.Context(), service.CreateWorkspaceParams{
+		Name:    r.FormValue("name"),
+		OwnerId: userId,
+	})
+	if isInvalidWorkspaceError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Trigger", views.WorkspacesChangedEvent)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (th *TemplateHandler) handleDeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := th.workspaceService.DeleteWorkspace(r.Context(), service.GetWorkspaceForUserParams{
+		WorkspaceId: r.PathValue("workspaceId"),
+		UserId:      userId,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (th *TemplateHandler) handleGetWorkspaceMembers(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	th.renderWorkspaceMembers(w, r, userId)
+}
+
+func (th *TemplateHandler) handleAddWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := th.workspaceService.AddMember(r.Context(), service.AddWorkspaceMemberParams{
+		WorkspaceId: r.PathValue("workspaceId"),
+		UserId:      userId,
+		MemberName:  r.FormValue("username"),
+	})
+	if isInvalidWorkspaceError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	th.renderWorkspaceMembers(w, r, userId)
+}
+
+func (th *TemplateHandler) handleRemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	userId, ok := ctx.GetUserId(r.Context())
+	if !ok || len(userId) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := th.workspaceService.RemoveMember(r.Context(), service.RemoveWorkspaceMemberParams{
+		WorkspaceId: r.PathValue("workspaceId"),
+		UserId:      userId,
+		MemberId:    r.PathValue("userId"),
+	})
+	if isInvalidWorkspaceError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrPermissionDenied) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (th *TemplateHandler) renderWorkspaceMembers(w http.ResponseWriter, r *http.Request, userId string) {
+	params := service.GetWorkspaceForUserParams{
+		WorkspaceId: r.PathValue("workspaceId"),
+		UserId:      userId,
+	}
+	workspace, err := th.workspaceService.GetWorkspaceForUser(r.Context(), params)
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	members, err := th.workspaceService.ListMembers(r.Context(), params)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	views.SettingsWorkspaceMembers(workspace, members).Render(r.Context(), w)
 }
 
 func newSettingsUserRowData(user models.User, currentUserId string) views.SettingsUserRowData {
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/skip2/go-qrcode"
+
+	"github.com/michaelhass/cpaw/service"
+)
+
+const totpQRCodeSize int = 256
+
+// totpQRCode renders the otpauth URL of an enrollment as PNG data URL, so the
+// secret never leaves the server for rendering.
+func totpQRCode(url string) (string, error) {
+	png, err := qrcode.Encode(url, qrcode.Medium, totpQRCodeSize)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
+func isInvalidTwoFactorError(err error) bool {
+	return errors.Is(err, service.ErrTwoFactorEnabled) ||
+		errors.Is(err, service.ErrTwoFactorNotEnrolled) ||
+		errors.Is(err, service.ErrInvalidTwoFactorCode) ||
+		errors.Is(err, service.ErrInvalidCredentials)
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michaelhass/cpaw/models"
+	"github.com/michaelhass/cpaw/service"
+	"github.com/michaelhass/cpaw/totp"
+)
+
+func TestTwoFactorSignIn(t *testing.T) {
+	server := newUserTestServer(t)
+	ctx := context.Background()
+
+	session, err := server.authService.VerifyToken(ctx, server.sessions[models.UserRole])
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollment, err := server.authService.BeginTotpEnrollment(ctx, session.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	recoveryCodes, err := server.authService.ConfirmTotpEnrollment(ctx, service.ConfirmTotpEnrollmentParams{
+		UserId: session.UserId,
+		Code:   code,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(t *testing.T, method, path, contentType, body string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.url+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		addCsrfToken(req)
+		client := &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return res, string(resBody)
+	}
+	hasSessionCookie := func(res *http.Response) bool {
+		for _, cookie := range res.Cookies() {
+			if cookie.Name == sessionCookieName && len(cookie.Value) > 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	userName := string(models.UserRole) + "_user"
+
+	t.Run("Template", func(t *testing.T) {
+		res, body := send(t, http.MethodPost, "/signin/", "application/x-www-form-urlencoded",
+			"username="+userName+"&password=password")
+		if res.StatusCode != http.StatusOK || hasSessionCookie(res) {
+			t.Fatalf("Expected second step without session. Got: %d", res.StatusCode)
+		}
+		if !strings.Contains(body, `hx-post="/signin/2fa"`) {
+			t.Fatal("Expected two-factor form. Got: ", body)
+		}
+	})
+
+	t.Run("Api", func(t *testing.T) {
+		res, body := send(t, http.MethodGet, "/api/v1/auth/signin/", "application/json",
+			`{"userName": "`+userName+`", "password": "password"}`)
+		if res.StatusCode != http.StatusOK || hasSessionCookie(res) {
+			t.Fatalf("Expected second step without session. Got: %d", res.StatusCode)
+		}
+		var challenge twoFactorChallengeResponse
+		if err := json.Unmarshal([]byte(body), &challenge); err != nil || !challenge.TwoFactorRequired {
+			t.Fatalf("Expected two-factor challenge. Got: %s %v", body, err)
+		}
+
+		verifyBody, _ := json.Marshal(verifyTwoFactorRequest{TwoFactorToken: challenge.TwoFactorToken, Code: "000000"})
+		res, _ = send(t, http.MethodGet, "/api/v1/auth/signin/2fa/", "application/json", string(verifyBody))
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 for invalid code. Got: %d", res.StatusCode)
+		}
+
+		verifyBody, _ = json.Marshal(verifyTwoFactorRequest{
+			TwoFactorToken: challenge.TwoFactorToken,
+			Code:           recoveryCodes[0],
+		})
+		res, _ = send(t, http.MethodGet, "/api/v1/auth/signin/2fa/", "application/json", string(verifyBody))
+		if res.StatusCode != http.StatusAccepted || !hasSessionCookie(res) {
+			t.Errorf("Expected session after second factor. Got: %d", res.StatusCode)
+		}
+	})
+
+	t.Run("Enrollment", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, server.url+"/settings/2fa/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: server.sessions[models.AdminRole]})
+		addCsrfToken(req)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusOK || !strings.Contains(string(body), `src="data:image/png;base64,`) {
+			t.Errorf("Expected QR code. Got: %d %s", res.StatusCode, body)
+		}
+	})
+}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/michaelhass/cpaw/models"
+	"github.com/michaelhass/cpaw/service"
+)
+
+type userTestServer struct {
+	testServer
+	// sessions maps roles to session tokens of users with that role.
+	sessions map[models.Role]string
+}
+
+func newUserTestServer(t *testing.T) userTestServer {
+	var users []testServerUser
+	for _, role := range models.AllRoles() {
+		users = append(users, testServerUser{name: string(role) + "_user", role: role})
+	}
+	server := newTestServer(t, testServerOptions{users: users})
+
+	sessions := map[models.Role]string{}
+	for _, user := range users {
+		sessions[user.role] = server.tokens[user.name]
+	}
+	return userTestServer{testServer: server, sessions: sessions}
+}
+
+// createVictim creates a user, which a test tries to delete.
+func (s userTestServer) createVictim(t *testing.T) models.User {
+	t.Helper()
+	user, err := s.authService.CreateUser(context.Background(), service.CreateUserParams{
+		UserName: "victim_" + strings.ReplaceAll(t.Name(), "/", "_"),
+		Password: "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// request sends a request with the session of a user with the given role. An
+// empty role sends an anonymous request. Redirects are not followed.
+func (s userTestServer) request(t *testing.T, role models.Role, method, path, contentType, body string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, s.url+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token, ok := s.sessions[role]; ok {
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	}
+	addCsrfToken(req)
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	return res.StatusCode
+}
+
+func TestUserManagementPermissions(t *testing.T) {
+	server := newUserTestServer(t)
+
+	const (
+		formContentType = "application/x-www-form-urlencoded"
+		jsonContentType = "application/json"
+	)
+
+	type route struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		// deletes reports whether path needs the id of a user to delete.
+		deletes bool
+	}
+	type expectation struct {
+		anonymous int
+		user      int
+		admin     int
+	}
+
+	tests := []struct {
+		route route
+		want  expectation
+	}{
+		{
+			route{name: "TemplateList", method: http.MethodGet, path: "/settings/auth/users/"},
+			expectation{anonymous: http.StatusSeeOther, user: http.StatusForbidden, admin: http.StatusOK},
+		},
+		{
+			route{
+				name:        "TemplateCreate",
+				method:      http.MethodPost,
+				path:        "/settings/auth/users/",
+				contentType: formContentType,
+				body:        "username=%s&password=password&role=admin",
+			},
+			expectation{anonymous: http.StatusSeeOther, user: http.StatusForbidden, admin: http.StatusAccepted},
+		},
+		{
+			route{name: "TemplateDelete", method: http.MethodDelete, path: "/settings/auth/users/", deletes: true},
+			expectation{anonymous: http.StatusSeeOther, user: http.StatusForbidden, admin: http.StatusAccepted},
+		},
+		{
+			route{name: "ApiList", method: http.MethodGet, path: "/api/v1/users/"},
+			expectation{anonymous: http.StatusUnauthorized, user: http.StatusForbidden, admin: http.StatusOK},
+		},
+		{
+			route{
+				name:        "ApiCreate",
+				method:      http.MethodPost,
+				path:        "/api/v1/users/",
+				contentType: jsonContentType,
+				body:        `{"userName": "%s", "password": "password", "role": "admin"}`,
+			},
+			expectation{anonymous: http.StatusUnauthorized, user: http.StatusForbidden, admin: http.StatusCreated},
+		},
+		{
+			route{name: "ApiDelete", method: http.MethodDelete, path: "/api/v1/users/", deletes: true},
+			expectation{anonymous: http.StatusUnauthorized, user: http.StatusForbidden, admin: http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		for role, want := range map[models.Role]int{
+			"":               tt.want.anonymous,
+			models.UserRole:  tt.want.user,
+			models.AdminRole: tt.want.admin,
+		} {
+			name := tt.route.name + "/" + string(role)
+			if len(role) == 0 {
+				name = tt.route.name + "/anonymous"
+			}
+			t.Run(name, func(t *testing.T) {
+				path, body := tt.route.path, tt.route.body
+				if strings.Contains(body, "%s") {
+					body = strings.Replace(body, "%s", "created_"+strings.ReplaceAll(t.Name(), "/", "_"), 1)
+				}
+				var victim models.User
+				if tt.route.deletes {
+					victim = server.createVictim(t)
+					path += victim.Id + "/"
+				}
+
+				got := server.request(t, role, tt.route.method, path, tt.route.contentType, body)
+				if got != want {
+					t.Errorf("Expected status %d. Got: %d", want, got)
+				}
+
+				if tt.route.deletes && got != http.StatusOK && got != http.StatusAccepted {
+					if _, err := server.authService.GetUserById(context.Background(), victim.Id); err != nil {
+						t.Error("Expected user not to be deleted. Got: ", err)
+					}
+				}
+			})
+		}
+	}
+
+	t.Run("AdminDeletesItself", func(t *testing.T) {
+		admin, err := server.authService.VerifyToken(context.Background(), server.sessions[models.AdminRole])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := server.request(t, models.AdminRole, http.MethodDelete, "/api/v1/users/"+admin.UserId+"/", "", "")
+		if got != http.StatusBadRequest {
+			t.Errorf("Expected status 400. Got: %d", got)
+		}
+	})
+}
+
+func TestSignInLockout(t *testing.T) {
+	server := newUserTestServer(t)
+
+	signIn := func(t *testing.T, method, path, contentType, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, server.url+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		addCsrfToken(req)
+		client := &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	userName := string(models.UserRole) + "_user"
+	for range service.MaxUserNameLoginFailures + 1 {
+		res := signIn(t, http.MethodPost, "/signin/", "application/x-www-form-urlencoded",
+			"username="+userName+"&password=wrong")
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401. Got: %d", res.StatusCode)
+		}
+	}
+
+	for _, tt := range []struct {
+		name, method, path, contentType, body string
+	}{
+		{"Template", http.MethodPost, "/signin/", "application/x-www-form-urlencoded",
+			"username=" + userName + "&password=password"},
+		{"Api", http.MethodGet, "/api/v1/auth/signin/", "application/json",
+			`{"userName": "` + userName + `", "password": "password"}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res := signIn(t, tt.method, tt.path, tt.contentType, tt.body)
+			if res.StatusCode != http.StatusTooManyRequests {
+				t.Errorf("Expected status 429. Got: %d", res.StatusCode)
+			}
+			if len(res.Header.Get("Retry-After")) == 0 {
+				t.Error("Expected 'Retry-After' header")
+			}
+		})
+	}
+}
+
+func TestCreateUserPasswordLength(t *testing.T) {
+	server := newUserTestServer(t)
+
+	for _, tt := range []struct {
+		name, path, contentType, body string
+	}{
+		{"Template", "/settings/auth/users/", "application/x-www-form-urlencoded",
+			"username=short_template&password=a&role=user"},
+		{"Api", "/api/v1/users/", "application/json",
+			`{"userName": "short_api", "password": "a", "role": "user"}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := server.request(t, models.AdminRole, http.MethodPost, tt.path, tt.contentType, tt.body)
+			if got != http.StatusBadRequest {
+				t.Errorf("Expected status 400. Got: %d", got)
+			}
+		})
+	}
+
+	users, err := server.authService.ListUsers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != len(models.AllRoles()) {
+		t.Errorf("Expected no user with short password. Got: %v", users)
+	}
+}
@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/service"
+)
+
+func isInvalidWorkspaceError(err error) bool {
+	return errors.Is(err, service.ErrWorkspaceName) ||
+		errors.Is(err, service.ErrWorkspaceOwnerLeave) ||
+		errors.Is(err, service.ErrUnknownUser) ||
+		errors.Is(err, repository.ErrAlreadyMember)
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
@@ -12,6 +14,8 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/michaelhass/cpaw/cli"
+	"github.com/michaelhass/cpaw/config"
 	"github.com/michaelhass/cpaw/db"
 	"github.com/michaelhass/cpaw/db/repository"
 	"github.com/michaelhass/cpaw/handler"
@@ -23,38 +27,122 @@ import (
 )
 
 func main() {
-	db, err := db.NewSqlite(
-		db.WithDbName("cpaw"),
-		db.WithDbPath("cpaw.db"),
-	)
+	if len(os.Args) < 2 || os.Args[1] == "serve" {
+		var args []string
+		if len(os.Args) > 2 {
+			args = os.Args[2:]
+		}
+		serve(args)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	env := cli.Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	if err := cli.Run(ctx, env, append(cli.ClientCommands(), cli.AdminCommands()...), os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func serve(args []string) {
+	conf, err := config.Load(args, os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		log.Fatal(err)
+		return
+	}
+
+	database, err := conf.OpenDatabase()
 	if err != nil {
 		log.Fatal(err)
 		return
 	}
 
 	defer func() {
-		db.Close()
+		database.Close()
 		log.Println("DB closed")
 	}()
 
-	if err := db.SetUp(); err != nil {
+	if err := database.SetUp(); err != nil {
 		log.Fatal(err)
 		return
 	}
 
-	userRepository := repository.NewUserRepository(db.DB)
-	sessionRespository := repository.NewSessionRespository(db.DB)
-	itemRepository := repository.NewItemRepository(db.DB)
-
-	authService := service.NewAuthService(sessionRespository, userRepository)
-	itemService := service.NewItemService(itemRepository)
+	conn := database.Conn()
+	userRepository := repository.NewUserRepository(conn)
+	sessionRespository := repository.NewSessionRespository(conn)
+	itemRepository := repository.NewItemRepository(conn, repository.WithBackend(database.Backend()))
+	apiTokenRepository := repository.NewApiTokenRepository(conn)
+	shareRepository := repository.NewShareRepository(conn)
+	workspaceRepository := repository.NewWorkspaceRepository(conn)
+	loginAttemptRepository := repository.NewLoginAttemptRepository(conn)
+	twoFactorRepository := repository.NewTwoFactorRepository(conn)
+
+	authService := service.NewAuthService(
+		sessionRespository,
+		userRepository,
+		apiTokenRepository,
+		loginAttemptRepository,
+		twoFactorRepository,
+		service.WithAuthConfig(conf.AuthConfig()),
+	)
+	itemService := service.NewItemService(
+		itemRepository,
+		workspaceRepository,
+		service.NewItemEventHub(),
+		service.WithItemCleanUpInterval(conf.Auth.CleanUpInterval),
+	)
+	shareService := service.NewShareService(shareRepository, itemRepository, loginAttemptRepository)
+	workspaceService := service.NewWorkspaceService(workspaceRepository, userRepository)
 
 	cancelAuthCleanUp := authService.RunPeriodicCleanUpTask(context.Background())
 	defer func() {
 		cancelAuthCleanUp()
 	}()
 
-	initialUser, err := authService.SetUp(context.Background(), createInitialUser)
+	cancelItemCleanUp := itemService.RunPeriodicCleanUpTask(context.Background())
+	defer func() {
+		cancelItemCleanUp()
+	}()
+
+	// Backups copy the SQLite database file. Postgres has its own tools.
+	var backupService *service.BackupService
+	if sqlite, ok := database.(*db.Sqlite); ok {
+		backupService = service.NewBackupService(sqlite, conf.BackupConfig())
+		if conf.BackupConfig().IsEnabled() {
+			cancelBackups := backupService.RunPeriodicBackupTask(context.Background())
+			defer func() {
+				cancelBackups()
+			}()
+		}
+	} else if conf.BackupConfig().IsEnabled() {
+		log.Println("Scheduled backups are only supported for SQLite")
+	}
+
+	var oidcService *service.OidcService
+	if oidcConfig := conf.OidcConfig(); oidcConfig.IsEnabled() {
+		oidcService, err = service.NewOidcService(
+			context.Background(),
+			oidcConfig,
+			authService,
+			repository.NewIdentityRepository(conn),
+		)
+		if err != nil {
+			log.Fatal("Error setting up single sign-on: ", err)
+			return
+		}
+		log.Println("Single sign-on enabled with issuer", oidcConfig.Issuer)
+	}
+
+	initialUser, err := authService.SetUp(context.Background(), func() service.CreateUserParams {
+		if len(conf.InitialUser.Name) > 0 {
+			return service.CreateUserParams{UserName: conf.InitialUser.Name, Password: conf.InitialUser.Password}
+		}
+		return createInitialUser()
+	})
 	if err != nil {
 		log.Fatal("Error setting up auth services: ", err)
 		return
@@ -68,21 +156,35 @@ func main() {
 	mainMux.Use(middleware.Logger)
 	mainMux.Use(middleware.Recover)
 
-	mainMux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	mainMux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(conf.StaticDir))))
 	mainMux.Group("", func(m *mux.Mux) {
 		m.Use(middleware.AddTrailingSlash)
-		templateHandler := handler.NewTemplateHandler(authService, itemService)
+		templateHandler := handler.NewTemplateHandler(
+			authService,
+			itemService,
+			shareService,
+			workspaceService,
+			oidcService,
+			handler.WithSecureCookies(conf.SecureCookies),
+		)
 		templateHandler.RegisterRoutes(m)
 	})
 
 	mainMux.Group("/api/v1", func(apiMux *mux.Mux) {
 		apiMux.Use(middleware.AddTrailingSlash)
-		apiHandler := handler.NewApiHandler(authService, itemService)
+		apiHandler := handler.NewApiHandler(
+			authService,
+			itemService,
+			shareService,
+			workspaceService,
+			backupService,
+			service.NewExportService(itemRepository, userRepository),
+			handler.WithSecureCookies(conf.SecureCookies),
+		)
 		apiHandler.RegisterRoutes(apiMux)
 	})
 
-	const addr string = ":3000"
-	listenAndServe(addr, mainMux)
+	listenAndServe(conf.Addr, mainMux)
 }
 
 func listenAndServe(addr string, mux *mux.Mux) {
@@ -1,7 +1,11 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/michaelhass/cpaw/ctx"
 	"github.com/michaelhass/cpaw/models"
@@ -9,9 +13,42 @@ import (
 	"github.com/michaelhass/cpaw/service"
 )
 
-func getValidSessionFromCookie(authService *service.AuthService, r *http.Request, cookieName string) (models.Session, error) {
+// SetSessionCookie stores the session token in a cookie that expires together
+// with the session. Scripts can't read the cookie.
+func SetSessionCookie(w http.ResponseWriter, cookie Cookie, session models.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookie.Name,
+		Value:    session.Token,
+		Expires:  time.Unix(session.ExpiresAt, 0),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   cookie.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func ClearSessionCookie(w http.ResponseWriter, cookie Cookie) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookie.Name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cookie.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// getValidSessionFromCookie verifies the session of the cookie and refreshes
+// the cookie if the session has been renewed.
+func getValidSessionFromCookie(
+	authService *service.AuthService,
+	w http.ResponseWriter,
+	r *http.Request,
+	cookie Cookie,
+) (models.Session, error) {
 	var session models.Session
-	c, err := r.Cookie(cookieName)
+	c, err := r.Cookie(cookie.Name)
 	if err != nil {
 		return session, err
 	}
@@ -22,46 +59,94 @@ func getValidSessionFromCookie(authService *service.AuthService, r *http.Request
 	}
 
 	session, err = authService.VerifyToken(r.Context(), c.Value)
-	return session, err
+	if err != nil {
+		return session, err
+	}
+	if session.Renewed {
+		SetSessionCookie(w, cookie, session)
+	}
+	return session, nil
+}
+
+// authenticate accepts a personal API token or session token as bearer token
+// and falls back to the session cookie.
+func authenticate(
+	authService *service.AuthService,
+	w http.ResponseWriter,
+	r *http.Request,
+	cookie Cookie,
+) (context.Context, error) {
+	token, ok := bearerToken(r)
+	if ok && service.IsApiToken(token) {
+		apiToken, err := authService.VerifyApiToken(r.Context(), token)
+		if err != nil {
+			return nil, err
+		}
+		c := ctx.WithUserId(r.Context(), apiToken.UserId)
+		return ctx.WithApiToken(c, apiToken), nil
+	}
+
+	var (
+		session models.Session
+		err     error
+	)
+	if ok {
+		session, err = authService.VerifyToken(r.Context(), token)
+	} else {
+		session, err = getValidSessionFromCookie(authService, w, r, cookie)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := ctx.WithUserId(r.Context(), session.UserId)
+	return ctx.WithSession(c, session), nil
 }
 
-func AuthProtected(authService *service.AuthService, cookieName string) mux.MiddlewareFunc {
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, len(token) > 0
+}
+
+func AuthProtected(authService *service.AuthService, cookie Cookie) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			session, err := getValidSessionFromCookie(authService, r, cookieName)
+			authCtx, err := authenticate(authService, w, r, cookie)
 			if err != nil {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
-			ctx := ctx.WithUserId(r.Context(), session.UserId)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(authCtx))
 		})
 	}
 }
 
 func AuthProtectedRedirect(
 	authService *service.AuthService,
-	cookieName string,
+	cookie Cookie,
 	redirectTo string,
 ) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			session, err := getValidSessionFromCookie(authService, r, cookieName)
+			session, err := getValidSessionFromCookie(authService, w, r, cookie)
 			if err != nil {
 				http.Redirect(w, r, redirectTo, http.StatusSeeOther)
 				return
 			}
 
-			ctx := ctx.WithUserId(r.Context(), session.UserId)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			c := ctx.WithUserId(r.Context(), session.UserId)
+			next.ServeHTTP(w, r.WithContext(ctx.WithSession(c, session)))
 		})
 	}
 }
 
-func SetAuthenticatedUserCtx(authService *service.AuthService, cookieName string) mux.MiddlewareFunc {
+func SetAuthenticatedUserCtx(authService *service.AuthService, cookie Cookie) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			session, err := getValidSessionFromCookie(authService, r, cookieName)
+			session, err := getValidSessionFromCookie(authService, w, r, cookie)
 			if err != nil {
 				next.ServeHTTP(w, r)
 				return
@@ -77,3 +162,50 @@ func SetAuthenticatedUserCtx(authService *service.AuthService, cookieName string
 		})
 	}
 }
+
+func RequireScope(scope models.Scope) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !ctx.HasScope(r.Context(), scope) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePermission rejects requests of users whose role does not grant the
+// permission. It has to run after the user has been authenticated.
+func RequirePermission(authService *service.AuthService, permission models.Permission) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userId, ok := ctx.GetUserId(r.Context())
+			if !ok || len(userId) == 0 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			err := authService.Authorize(r.Context(), userId, permission)
+			if errors.Is(err, service.ErrPermissionDenied) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects requests that are authenticated with a personal API
+// token, for example to keep tokens from changing account credentials.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ctx.GetApiToken(r.Context()); ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
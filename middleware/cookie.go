@@ -0,0 +1,8 @@
+package middleware
+
+// Cookie names a cookie the server issues. A secure cookie is only sent over
+// HTTPS, which the server can't tell by itself behind a reverse proxy.
+type Cookie struct {
+	Name   string
+	Secure bool
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"mime"
+	"net/http"
+
+	"github.com/michaelhass/cpaw/ctx"
+	"github.com/michaelhass/cpaw/mux"
+)
+
+const (
+	CsrfHeaderName  string = "X-CSRF-Token"
+	CsrfFormField   string = "csrf_token"
+	csrfTokenLength int    = 32
+)
+
+// Csrf protects cookie authenticated requests against cross-site request
+// forgery with a double submit cookie. It issues a random token in the cookie,
+// which unsafe requests have to repeat in the X-CSRF-Token header or the
+// csrf_token form field. Pages read the token with ctx.GetCsrfToken.
+//
+// Requests with a bearer token are exempt, because browsers never attach it on
+// their own.
+func Csrf(cookie Cookie) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := ""
+			if c, err := r.Cookie(cookie.Name); err == nil && len(c.Value) > 0 {
+				token = c.Value
+			}
+
+			if !isSafeMethod(r.Method) {
+				if _, ok := bearerToken(r); !ok && !isValidCsrfToken(r, token) {
+					w.WriteHeader(http.StatusForbidden)
+					w.Write([]byte("Invalid CSRF token. Please reload the page"))
+					return
+				}
+			}
+
+			if len(token) == 0 {
+				var err error
+				if token, err = generateCsrfToken(); err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				http.SetCookie(w, &http.Cookie{
+					Name:     cookie.Name,
+					Value:    token,
+					Path:     "/",
+					HttpOnly: true,
+					Secure:   cookie.Secure,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+			next.ServeHTTP(w, r.WithContext(ctx.WithCsrfToken(r.Context(), token)))
+		})
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// isValidCsrfToken compares the token of the cookie with the one of the
+// request. Only url encoded forms are parsed, so handlers can still limit the
+// size of multipart uploads.
+func isValidCsrfToken(r *http.Request, token string) bool {
+	if len(token) == 0 {
+		return false
+	}
+	requestToken := r.Header.Get(CsrfHeaderName)
+	if len(requestToken) == 0 {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "application/x-www-form-urlencoded" {
+			requestToken = r.PostFormValue(CsrfFormField)
+		}
+	}
+	return subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) == 1
+}
+
+func generateCsrfToken() (string, error) {
+	randomValues := make([]byte, csrfTokenLength)
+	if _, err := rand.Read(randomValues); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomValues), nil
+}
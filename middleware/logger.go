@@ -23,6 +23,10 @@ func (r *statusResponseWriter) WriteHeader(statusCode int) {
 	r.ResponseWriter.WriteHeader(statusCode)
 }
 
+func (r *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func newStatusResponseWriter(w http.ResponseWriter) *statusResponseWriter {
 	return &statusResponseWriter{
 		ResponseWriter: w,
@@ -0,0 +1,37 @@
+package models
+
+import "slices"
+
+const ApiTokenPrefix string = "cpaw_pat_"
+
+type Scope string
+
+const (
+	ItemsReadScope  Scope = "items:read"
+	ItemsWriteScope Scope = "items:write"
+)
+
+var allScopes = []Scope{ItemsReadScope, ItemsWriteScope}
+
+func AllScopes() []Scope {
+	return allScopes
+}
+
+func (s Scope) IsValid() bool {
+	return slices.Contains(allScopes, s)
+}
+
+type ApiToken struct {
+	Id         string  `json:"id"`
+	CreatedAt  int64   `json:"createdAt"`
+	UserId     string  `json:"userId"`
+	Name       string  `json:"name"`
+	TokenHash  string  `json:"-"`
+	Scopes     []Scope `json:"scopes"`
+	LastUsedAt int64   `json:"lastUsedAt"`
+	ExpiresAt  int64   `json:"expiresAt"`
+}
+
+func (t ApiToken) HasScope(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
@@ -0,0 +1,11 @@
+package models
+
+type Attachment struct {
+	Id        string `json:"id"`
+	CreatedAt int64  `json:"createdAt"`
+	ItemId    string `json:"itemId"`
+	FileName  string `json:"fileName"`
+	MimeType  string `json:"mimeType"`
+	Size      int64  `json:"size"`
+	Data      []byte `json:"-"`
+}
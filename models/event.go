@@ -0,0 +1,18 @@
+package models
+
+type ItemEventType string
+
+const (
+	ItemCreatedEvent ItemEventType = "item_created"
+	ItemDeletedEvent ItemEventType = "item_deleted"
+	ItemUpdatedEvent ItemEventType = "item_updated"
+)
+
+type ItemEvent struct {
+	Type   ItemEventType `json:"type"`
+	ItemId string        `json:"itemId"`
+	UserId string        `json:"userId"`
+	// WorkspaceId is empty for events of personal items.
+	WorkspaceId string `json:"workspaceId,omitempty"`
+	Item        *Item  `json:"item,omitempty"`
+}
@@ -0,0 +1,37 @@
+package models
+
+// ExportedItem is a line of an export. See package service for the format.
+type ExportedItem struct {
+	Id        string `json:"id"`
+	CreatedAt int64  `json:"createdAt"`
+	UpdatedAt int64  `json:"updatedAt,omitempty"`
+	// ExpiresAt is a unix timestamp. 0 means the item does not expire.
+	ExpiresAt int64  `json:"expiresAt,omitempty"`
+	UserName  string `json:"userName"`
+	Content   string `json:"content"`
+	// ContentHash identifies items with the same content and attachments.
+	ContentHash string               `json:"contentHash"`
+	Attachments []ExportedAttachment `json:"attachments,omitempty"`
+}
+
+type ExportedAttachment struct {
+	Id       string `json:"id"`
+	FileName string `json:"fileName"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+	// Path is the file with the data of the attachment in zip exports.
+	Path string `json:"path,omitempty"`
+}
+
+type ImportResult struct {
+	Imported  int              `json:"imported"`
+	Conflicts []ImportConflict `json:"conflicts"`
+}
+
+// ImportConflict is an item that was not imported.
+type ImportConflict struct {
+	// Line is the line of the item in items.jsonl, starting at 1.
+	Line   int    `json:"line"`
+	ItemId string `json:"itemId,omitempty"`
+	Reason string `json:"reason"`
+}
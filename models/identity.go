@@ -0,0 +1,9 @@
+package models
+
+// Identity links a user to the account of an external identity provider.
+type Identity struct {
+	Issuer    string `json:"issuer"`
+	Subject   string `json:"subject"`
+	UserId    string `json:"userId"`
+	CreatedAt int64  `json:"createdAt"`
+}
@@ -5,4 +5,27 @@ type Item struct {
 	CreatedAt int64  `json:"createdAt"`
 	Content   string `json:"content"`
 	UserId    string `json:"userId"`
+	// ExpiresAt is a unix timestamp. 0 means the item does not expire.
+	ExpiresAt int64 `json:"expiresAt"`
+	// BurnAfterRead items are deleted once their content has been read. Their
+	// content is empty in listings.
+	BurnAfterRead bool `json:"burnAfterRead"`
+	// UpdatedAt is a unix timestamp. 0 means the item has never been edited.
+	UpdatedAt int64 `json:"updatedAt"`
+	// WorkspaceId is empty for personal items.
+	WorkspaceId string       `json:"workspaceId,omitempty"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+// ItemRevision is a previous content of an item.
+type ItemRevision struct {
+	Id        string `json:"id"`
+	CreatedAt int64  `json:"createdAt"`
+	ItemId    string `json:"itemId"`
+	Content   string `json:"content"`
+}
+
+type ItemPage struct {
+	Items      []Item `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
@@ -0,0 +1,19 @@
+package models
+
+// LoginAttemptScope is what failed sign in attempts are counted for.
+type LoginAttemptScope string
+
+const (
+	UserNameLoginAttemptScope  LoginAttemptScope = "user"
+	IpAddressLoginAttemptScope LoginAttemptScope = "ip"
+	// ShareLoginAttemptScope counts wrong passwords of a share by its id.
+	ShareLoginAttemptScope LoginAttemptScope = "share"
+)
+
+type LoginAttempt struct {
+	Scope        LoginAttemptScope `json:"scope"`
+	Key          string            `json:"key"`
+	Failures     int               `json:"failures"`
+	LastFailedAt int64             `json:"lastFailedAt"`
+	LockedUntil  int64             `json:"lockedUntil"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// LoginChallenge is a sign in with valid credentials, which still has to pass
+// the second factor before a session is created.
+type LoginChallenge struct {
+	TokenHash string `json:"-"`
+	UserId    string `json:"userId"`
+	CreatedAt int64  `json:"createdAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+	Remember  bool   `json:"remember"`
+	UserAgent string `json:"userAgent"`
+	IpAddress string `json:"ipAddress"`
+}
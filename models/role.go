@@ -9,12 +9,35 @@ const (
 	UserRole  Role = "user"
 )
 
+// allRoles is ordered from the most to the least privileged role.
 var allRoles = []Role{AdminRole, UserRole}
 
 func AllRoles() []Role {
 	return allRoles
 }
 
-func (r Role) isValid() bool {
+func (r Role) IsValid() bool {
 	return slices.Contains(allRoles, r)
 }
+
+// Permission grants access to operations beyond a user's own data.
+type Permission string
+
+const (
+	// ManageUsersPermission allows listing, creating and deleting users.
+	ManageUsersPermission Permission = "users:manage"
+	// ManageServerPermission allows operating the server, e.g. downloading
+	// backups of the database.
+	ManageServerPermission Permission = "server:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	AdminRole: {ManageUsersPermission, ManageServerPermission},
+	UserRole:  {},
+}
+
+// HasPermission reports whether the role grants the permission. Unknown roles
+// grant nothing.
+func (r Role) HasPermission(permission Permission) bool {
+	return slices.Contains(rolePermissions[r], permission)
+}
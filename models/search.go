@@ -0,0 +1,12 @@
+package models
+
+type ItemSearchResult struct {
+	Item
+	Snippet []SnippetFragment `json:"snippet"`
+	Rank    float64           `json:"rank"`
+}
+
+type SnippetFragment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match"`
+}
@@ -1,7 +1,17 @@
 package models
 
 type Session struct {
-	Token     string `json:"token"`
-	ExpiresAt int64  `json:"expiresAt"`
-	UserId    string `json:"userId"`
+	// Id identifies a session without revealing its token.
+	Id         string `json:"id"`
+	Token      string `json:"-"`
+	CreatedAt  int64  `json:"createdAt"`
+	ExpiresAt  int64  `json:"expiresAt"`
+	LastSeenAt int64  `json:"lastSeenAt"`
+	UserId     string `json:"userId"`
+	UserAgent  string `json:"userAgent"`
+	IpAddress  string `json:"ipAddress"`
+	// Remember marks sessions of trusted devices, which last longer.
+	Remember bool `json:"remember"`
+	// Renewed is set if verifying the session has extended its expiration.
+	Renewed bool `json:"-"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Share makes a single item readable without an account through its token.
+type Share struct {
+	Id        string `json:"id"`
+	CreatedAt int64  `json:"createdAt"`
+	ItemId    string `json:"itemId"`
+	UserId    string `json:"userId"`
+	Token     string `json:"token"`
+	// ExpiresAt is a unix timestamp. 0 means the share does not expire.
+	ExpiresAt int64 `json:"expiresAt"`
+	// MaxViews limits how often the item can be viewed. 0 means unlimited.
+	MaxViews     int64  `json:"maxViews"`
+	ViewCount    int64  `json:"viewCount"`
+	PasswordHash string `json:"-"`
+	HasPassword  bool   `json:"hasPassword"`
+}
+
+func (s Share) IsExpired() bool {
+	return s.ExpiresAt > 0 && time.Now().Unix() >= s.ExpiresAt
+}
+
+func (s Share) IsUsedUp() bool {
+	return s.MaxViews > 0 && s.ViewCount >= s.MaxViews
+}
+
+func (s Share) IsActive() bool {
+	return !s.IsExpired() && !s.IsUsedUp()
+}
@@ -6,4 +6,11 @@ type User struct {
 	UserName     string `json:"userName"`
 	PasswordHash string `json:"-"`
 	Role         Role   `json:"role"`
+	// TotpSecret is set once the user starts enrolling an authenticator app,
+	// but only used for signing in after TwoFactorEnabled has been confirmed.
+	TotpSecret       string `json:"-"`
+	TwoFactorEnabled bool   `json:"twoFactorEnabled"`
+	// TotpLastStep is the time step of the last accepted code, which can't be
+	// used again.
+	TotpLastStep int64 `json:"-"`
 }
@@ -0,0 +1,26 @@
+package models
+
+type WorkspaceRole string
+
+const (
+	WorkspaceOwnerRole  WorkspaceRole = "owner"
+	WorkspaceMemberRole WorkspaceRole = "member"
+)
+
+// Workspace is a clipboard shared by its members.
+type Workspace struct {
+	Id        string `json:"id"`
+	CreatedAt int64  `json:"createdAt"`
+	Name      string `json:"name"`
+	OwnerId   string `json:"ownerId"`
+	// Role is the role of the user the workspace has been loaded for.
+	Role WorkspaceRole `json:"role,omitempty"`
+}
+
+type WorkspaceMember struct {
+	WorkspaceId string        `json:"workspaceId"`
+	UserId      string        `json:"userId"`
+	UserName    string        `json:"userName"`
+	Role        WorkspaceRole `json:"role"`
+	CreatedAt   int64         `json:"createdAt"`
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/hash"
+	"github.com/michaelhass/cpaw/models"
+)
+
+const (
+	DefaultApiTokenLength           int           = 32
+	DefaultApiTokenLastUsedInterval time.Duration = time.Minute
+	MaxApiTokenNameLength           int           = 64
+)
+
+var (
+	ErrExpiredApiToken   = errors.New("Expired API token")
+	ErrInvalidApiToken   = errors.New("Invalid API token")
+	ErrApiTokenName      = errors.New("Please provide a name of max. 64 characters")
+	ErrApiTokenScopes    = errors.New("Please select at least one valid scope")
+	ErrApiTokenExpiresAt = errors.New("Expiration date must be in the future")
+)
+
+type CreateApiTokenParams struct {
+	UserId    string
+	Name      string
+	Scopes    []models.Scope
+	ExpiresAt time.Time
+}
+
+type CreateApiTokenResult struct {
+	ApiToken models.ApiToken
+	// Token is the plain text token. It is not stored and can only be shown
+	// to the user once.
+	Token string
+}
+
+func (as *AuthService) CreateApiToken(ctx context.Context, params CreateApiTokenParams) (CreateApiTokenResult, error) {
+	var result CreateApiTokenResult
+
+	name := strings.TrimSpace(params.Name)
+	if len(name) == 0 || len(name) > MaxApiTokenNameLength {
+		return result, ErrApiTokenName
+	}
+	if len(params.Scopes) == 0 {
+		return result, ErrApiTokenScopes
+	}
+	for _, scope := range params.Scopes {
+		if !scope.IsValid() {
+			return result, ErrApiTokenScopes
+		}
+	}
+	if !params.ExpiresAt.IsZero() && params.ExpiresAt.Before(time.Now()) {
+		return result, ErrApiTokenExpiresAt
+	}
+
+	token, err := generateApiToken(DefaultApiTokenLength)
+	if err != nil {
+		return result, err
+	}
+
+	apiToken, err := as.apiTokens.CreateApiToken(ctx, repository.CreateApiTokenParams{
+		UserId:    params.UserId,
+		Name:      name,
+		TokenHash: hash.NewFromToken(token),
+		Scopes:    params.Scopes,
+		ExpiresAt: params.ExpiresAt,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	result.ApiToken = apiToken
+	result.Token = token
+	return result, nil
+}
+
+func (as *AuthService) ListApiTokens(ctx context.Context, userId string) ([]models.ApiToken, error) {
+	return as.apiTokens.ListApiTokensForUser(ctx, userId)
+}
+
+type RevokeApiTokenParams = repository.DeleteApiTokenForUserParams
+
+func (as *AuthService) RevokeApiToken(ctx context.Context, params RevokeApiTokenParams) error {
+	return as.apiTokens.DeleteApiTokenForUser(ctx, params)
+}
+
+// VerifyApiToken returns the stored token for a plain text token. The last
+// used time is only updated once per DefaultApiTokenLastUsedInterval to avoid
+// a write for every request.
+func (as *AuthService) VerifyApiToken(ctx context.Context, token string) (models.ApiToken, error) {
+	if !IsApiToken(token) {
+		return models.ApiToken{}, ErrInvalidApiToken
+	}
+
+	apiToken, err := as.apiTokens.GetApiTokenByHash(ctx, hash.NewFromToken(token))
+	if err != nil {
+		return models.ApiToken{}, err
+	}
+	if IsApiTokenExpired(apiToken) {
+		return models.ApiToken{}, ErrExpiredApiToken
+	}
+
+	now := time.Now()
+	if now.Sub(time.Unix(apiToken.LastUsedAt, 0)) >= DefaultApiTokenLastUsedInterval {
+		if err := as.apiTokens.UpdateLastUsed(ctx, apiToken.Id, now); err != nil {
+			log.Println("Error updating API token last used time", err)
+		} else {
+			apiToken.LastUsedAt = now.Unix()
+		}
+	}
+	return apiToken, nil
+}
+
+// CheckApiToken returns an error if a verified token has been revoked or has
+// expired since. Unlike VerifyApiToken, it doesn't record the usage.
+func (as *AuthService) CheckApiToken(ctx context.Context, apiToken models.ApiToken) error {
+	apiToken, err := as.apiTokens.GetApiTokenByHash(ctx, apiToken.TokenHash)
+	if err != nil {
+		return err
+	}
+	if IsApiTokenExpired(apiToken) {
+		return ErrExpiredApiToken
+	}
+	return nil
+}
+
+func IsApiToken(token string) bool {
+	return strings.HasPrefix(token, models.ApiTokenPrefix)
+}
+
+func IsApiTokenExpired(token models.ApiToken) bool {
+	return token.ExpiresAt > 0 && time.Now().Unix() > token.ExpiresAt
+}
+
+func generateApiToken(length int) (string, error) {
+	randomValues := make([]byte, length)
+	if _, err := rand.Read(randomValues); err != nil {
+		return "", err
+	}
+	return models.ApiTokenPrefix + base64.RawURLEncoding.EncodeToString(randomValues), nil
+}
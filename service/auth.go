@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"log"
 	"regexp"
 	"time"
@@ -15,7 +16,16 @@ import (
 )
 
 const (
+	// DefaultSessionDuration is the time a session stays valid without being
+	// used. Using a session extends it up to DefaultMaxSessionLifetime.
 	DefaultSessionDuration    time.Duration = time.Minute * 15
+	DefaultMaxSessionLifetime time.Duration = time.Hour * 12
+	// RememberedSessionDuration and MaxRememberedSessionLifetime apply to
+	// sessions of devices the user asked to remember.
+	RememberedSessionDuration    time.Duration = time.Hour * 24 * 30
+	MaxRememberedSessionLifetime time.Duration = time.Hour * 24 * 90
+	// SessionRenewalInterval throttles writing extended expiration dates.
+	SessionRenewalInterval    time.Duration = time.Minute
 	DefaultSessionTokenLength int           = 32
 	DefaultMinPasswordLength  int           = 6
 	DefaultCleanUpInterval    time.Duration = time.Minute * 1
@@ -23,23 +33,94 @@ const (
 
 var (
 	ErrExpiredSession       = errors.New("Expired Session")
-	ErrMinPasswordLength    = errors.New("Password should be min. 6 characters long")
+	ErrMinPasswordLength    = errors.New("Password too short")
 	ErrUserNameInvalidChars = errors.New("Invalid user name. Min length 2. Please only use letters, numbers, '-' or '_'.")
 	ErrInvalidCredentials   = errors.New("Invalid credentials")
+	// ErrPermissionDenied is returned when a user's role or workspace role
+	// does not allow an operation.
+	ErrPermissionDenied = errors.New("Permission denied")
+	ErrDeleteOwnUser    = errors.New("You can't delete your own user")
+	ErrInvalidRole      = errors.New("Invalid role")
 
 	userNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 )
 
 type AuthService struct {
-	sessions *repository.SessionRepository
-	users    *repository.UserRepository
+	sessions      repository.SessionStore
+	users         repository.UserStore
+	apiTokens     repository.ApiTokenStore
+	loginAttempts repository.LoginAttemptStore
+	twoFactor     repository.TwoFactorStore
+	config        AuthConfig
+}
+
+type AuthConfig struct {
+	SessionDuration              time.Duration
+	MaxSessionLifetime           time.Duration
+	RememberedSessionDuration    time.Duration
+	MaxRememberedSessionLifetime time.Duration
+	MinPasswordLength            int
+	CleanUpInterval              time.Duration
+}
+
+func DefaultAuthConfig() AuthConfig {
+	return AuthConfig{
+		SessionDuration:              DefaultSessionDuration,
+		MaxSessionLifetime:           DefaultMaxSessionLifetime,
+		RememberedSessionDuration:    RememberedSessionDuration,
+		MaxRememberedSessionLifetime: MaxRememberedSessionLifetime,
+		MinPasswordLength:            DefaultMinPasswordLength,
+		CleanUpInterval:              DefaultCleanUpInterval,
+	}
+}
+
+type AuthServiceOption func(*AuthConfig)
+
+// WithAuthConfig replaces the default config. Zero values keep their
+// defaults.
+func WithAuthConfig(config AuthConfig) AuthServiceOption {
+	return func(conf *AuthConfig) {
+		if config.SessionDuration > 0 {
+			conf.SessionDuration = config.SessionDuration
+		}
+		if config.MaxSessionLifetime > 0 {
+			conf.MaxSessionLifetime = config.MaxSessionLifetime
+		}
+		if config.RememberedSessionDuration > 0 {
+			conf.RememberedSessionDuration = config.RememberedSessionDuration
+		}
+		if config.MaxRememberedSessionLifetime > 0 {
+			conf.MaxRememberedSessionLifetime = config.MaxRememberedSessionLifetime
+		}
+		if config.MinPasswordLength > 0 {
+			conf.MinPasswordLength = config.MinPasswordLength
+		}
+		if config.CleanUpInterval > 0 {
+			conf.CleanUpInterval = config.CleanUpInterval
+		}
+	}
 }
 
 func NewAuthService(
-	sessions *repository.SessionRepository,
-	users *repository.UserRepository,
+	sessions repository.SessionStore,
+	users repository.UserStore,
+	apiTokens repository.ApiTokenStore,
+	loginAttempts repository.LoginAttemptStore,
+	twoFactor repository.TwoFactorStore,
+	opts ...AuthServiceOption,
 ) *AuthService {
-	return &AuthService{sessions: sessions, users: users}
+	config := DefaultAuthConfig()
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return &AuthService{
+		sessions:      sessions,
+		users:         users,
+		apiTokens:     apiTokens,
+		loginAttempts: loginAttempts,
+		twoFactor:     twoFactor,
+		config:        config,
+	}
 }
 
 func (as *AuthService) SetUp(
@@ -54,33 +135,70 @@ func (as *AuthService) SetUp(
 		return models.User{}, nil
 	}
 	params := createInitialUser()
-	if !IsValidUserName(params.UserName) {
-		return models.User{}, ErrUserNameInvalidChars
-	}
-	if len(params.Password) < DefaultMinPasswordLength {
-		return models.User{}, ErrMinPasswordLength
-	}
 	params.Role = models.AdminRole
-	initialUser, err := as.users.CreateUser(ctx, params)
-	return initialUser, err
+	return as.CreateUser(ctx, params)
 }
 
 type AuthSignInResult struct {
 	User    models.User
 	Session models.Session
+	// TwoFactorToken is set instead of Session if the user has to pass the
+	// second factor with VerifyTwoFactor.
+	TwoFactorToken string
 }
 
-func (as *AuthService) SignIn(ctx context.Context, userName string, password string) (AuthSignInResult, error) {
+type SignInParams struct {
+	UserName string
+	Password string
+	// Remember creates a long-lived session for a trusted device.
+	Remember bool
+	// UserAgent and IpAddress describe the device signing in.
+	UserAgent string
+	IpAddress string
+}
+
+// SignIn creates a session for valid credentials, or a login challenge for
+// users with two-factor authentication. Failed attempts are counted per user
+// name and IP address, which are temporarily locked after too many failures.
+func (as *AuthService) SignIn(ctx context.Context, params SignInParams) (AuthSignInResult, error) {
 	var result AuthSignInResult
 
-	user, err := as.users.GetUserByName(ctx, userName)
+	attemptKeys := loginAttemptKeys(params)
+	if err := checkLoginLocks(ctx, as.loginAttempts, attemptKeys); err != nil {
+		return result, err
+	}
+
+	user, err := as.users.GetUserByName(ctx, params.UserName)
+	if err == nil && !hash.VerifyPassword(params.Password, user.PasswordHash) {
+		err = ErrInvalidCredentials
+	}
 	if err != nil {
+		if err := recordLoginFailure(ctx, as.loginAttempts, attemptKeys); err != nil {
+			return result, err
+		}
 		return result, ErrInvalidCredentials
 	}
 
-	isMatch := hash.VerifyPassword(password, user.PasswordHash)
-	if !isMatch {
-		return result, ErrInvalidCredentials
+	if user.TwoFactorEnabled {
+		result.User = user
+		result.TwoFactorToken, err = as.createLoginChallenge(ctx, user, params)
+		return result, err
+	}
+	return as.createSession(ctx, user, params)
+}
+
+// createSession signs in a user, who has passed all factors, and forgets the
+// failed attempts of the user name.
+func (as *AuthService) createSession(
+	ctx context.Context,
+	user models.User,
+	params SignInParams,
+) (AuthSignInResult, error) {
+	var result AuthSignInResult
+
+	err := as.loginAttempts.DeleteLoginAttempt(ctx, loginAttemptKeys(params)[0])
+	if err != nil {
+		return result, err
 	}
 
 	token, err := generateSessionToken(DefaultSessionTokenLength)
@@ -90,8 +208,11 @@ func (as *AuthService) SignIn(ctx context.Context, userName string, password str
 
 	session, err := as.sessions.CreateSession(ctx, repository.CreateSessionParams{
 		Token:     token,
-		ExpiresAt: newSessionExpirationTime(),
+		ExpiresAt: time.Now().Add(as.sessionDuration(params.Remember)),
 		UserId:    user.Id,
+		Remember:  params.Remember,
+		UserAgent: params.UserAgent,
+		IpAddress: params.IpAddress,
 	})
 
 	if err != nil {
@@ -116,20 +237,109 @@ func (as *AuthService) VerifyToken(ctx context.Context, sessionToken string) (mo
 	if IsSessionExpired(session) {
 		return models.Session{}, ErrExpiredSession
 	}
+	return as.renewSession(ctx, session)
+}
+
+// CheckSession returns an error if the session with the token has been
+// revoked or has expired. Unlike VerifyToken, it doesn't renew the session,
+// so open streams can check it without keeping it alive.
+func (as *AuthService) CheckSession(ctx context.Context, sessionToken string) error {
+	session, err := as.sessions.GetSessionByToken(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+	if IsSessionExpired(session) {
+		return ErrExpiredSession
+	}
+	return nil
+}
+
+// renewSession slides the expiration of a session that is in use, but never
+// beyond its maximum lifetime, and records its last activity. Both are only
+// stored once per SessionRenewalInterval.
+func (as *AuthService) renewSession(ctx context.Context, session models.Session) (models.Session, error) {
+	now := time.Now()
+	expiresAt := now.Add(as.sessionDuration(session.Remember))
+	maxExpiresAt := time.Unix(session.CreatedAt, 0).Add(as.maxSessionLifetime(session.Remember))
+	if expiresAt.After(maxExpiresAt) {
+		expiresAt = maxExpiresAt
+	}
+	isExtended := expiresAt.Sub(time.Unix(session.ExpiresAt, 0)) >= SessionRenewalInterval
+	isSeen := now.Sub(time.Unix(session.LastSeenAt, 0)) >= SessionRenewalInterval
+	if !isExtended && !isSeen {
+		return session, nil
+	}
+	if !isExtended {
+		expiresAt = time.Unix(session.ExpiresAt, 0)
+	}
+
+	err := as.sessions.UpdateSessionActivity(ctx, repository.UpdateSessionActivityParams{
+		Token:      session.Token,
+		ExpiresAt:  expiresAt,
+		LastSeenAt: now,
+	})
+	if err != nil {
+		return models.Session{}, err
+	}
+	session.LastSeenAt = now.Unix()
+	if isExtended {
+		session.ExpiresAt = expiresAt.Unix()
+		session.Renewed = true
+	}
 	return session, nil
 }
 
-type UpdatePasswordParams = repository.UpdateUserPasswordParams
+func (as *AuthService) ListSessions(ctx context.Context, userId string) ([]models.Session, error) {
+	return as.sessions.ListSessionsForUser(ctx, userId)
+}
+
+type RevokeSessionParams = repository.DeleteSessionForUserParams
+
+// RevokeSession signs out one of the sessions of a user.
+func (as *AuthService) RevokeSession(ctx context.Context, params RevokeSessionParams) error {
+	return as.sessions.DeleteSessionForUser(ctx, params)
+}
+
+type SignOutOtherSessionsParams = repository.DeleteOtherSessionsForUserParams
+
+// SignOutOtherSessions signs out all sessions of a user except the one with
+// KeepToken.
+func (as *AuthService) SignOutOtherSessions(ctx context.Context, params SignOutOtherSessionsParams) error {
+	return as.sessions.DeleteOtherSessionsForUser(ctx, params)
+}
+
+type UpdatePasswordParams struct {
+	UserId   string
+	Password string
+	// SessionToken is the session of the user changing the password. All
+	// other sessions of the user are signed out.
+	SessionToken string
+}
 
 func (as *AuthService) UpdatePassword(ctx context.Context, params UpdatePasswordParams) error {
-	if !as.IsValidPassword(params.Password) {
-		return ErrMinPasswordLength
+	if err := as.ValidatePassword(params.Password); err != nil {
+		return err
 	}
-	return as.users.UpdatePassword(ctx, params)
+	err := as.users.UpdatePassword(ctx, repository.UpdateUserPasswordParams{
+		UserId:   params.UserId,
+		Password: params.Password,
+	})
+	if err != nil {
+		return err
+	}
+	return as.sessions.DeleteOtherSessionsForUser(ctx, repository.DeleteOtherSessionsForUserParams{
+		UserId:    params.UserId,
+		KeepToken: params.SessionToken,
+	})
 }
 
-func (as *AuthService) IsValidPassword(password string) bool {
-	return len(password) >= DefaultMinPasswordLength
+// ValidatePassword returns ErrMinPasswordLength, including the configured
+// length, for passwords that are too short.
+func (as *AuthService) ValidatePassword(password string) error {
+	if len(password) < as.config.MinPasswordLength {
+		return fmt.Errorf("%w. Please use min. %d characters", ErrMinPasswordLength, as.config.MinPasswordLength)
+	}
+	return nil
 }
 
 type UpdateUserNameParams = repository.UpdateUserNameParams
@@ -147,6 +357,12 @@ func (as *AuthService) CreateUser(ctx context.Context, params CreateUserParams)
 	if !IsValidUserName(params.UserName) {
 		return models.User{}, ErrUserNameInvalidChars
 	}
+	if len(params.Role) > 0 && !params.Role.IsValid() {
+		return models.User{}, ErrInvalidRole
+	}
+	if err := as.ValidatePassword(params.Password); err != nil {
+		return models.User{}, err
+	}
 	return as.users.CreateUser(ctx, params)
 }
 
@@ -158,12 +374,55 @@ func (as *AuthService) GetUserById(ctx context.Context, userId string) (models.U
 	return as.users.GetUserById(ctx, userId)
 }
 
-func (as *AuthService) DeleteUserById(ctx context.Context, userId string) error {
-	return as.users.DeleteUserById(ctx, userId)
+func (as *AuthService) GetUserByName(ctx context.Context, userName string) (models.User, error) {
+	return as.users.GetUserByName(ctx, userName)
+}
+
+type SetUserRoleParams = repository.UpdateUserRoleParams
+
+// SetUserRole changes the role of a user. Like UpdatePassword, it doesn't
+// authorize the change, which is up to the caller.
+func (as *AuthService) SetUserRole(ctx context.Context, params SetUserRoleParams) error {
+	if !params.Role.IsValid() {
+		return ErrInvalidRole
+	}
+	return as.users.UpdateRole(ctx, params)
+}
+
+// Authorize returns ErrPermissionDenied unless the role of the user grants the
+// permission.
+func (as *AuthService) Authorize(ctx context.Context, userId string, permission models.Permission) error {
+	user, err := as.users.GetUserById(ctx, userId)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrPermissionDenied
+	} else if err != nil {
+		return err
+	}
+	if !user.Role.HasPermission(permission) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+type DeleteUserParams struct {
+	UserId string
+	// DeletedBy is the user performing the deletion, who needs permission to
+	// manage users and can't delete itself.
+	DeletedBy string
+}
+
+func (as *AuthService) DeleteUser(ctx context.Context, params DeleteUserParams) error {
+	if err := as.Authorize(ctx, params.DeletedBy, models.ManageUsersPermission); err != nil {
+		return err
+	}
+	if params.UserId == params.DeletedBy {
+		return ErrDeleteOwnUser
+	}
+	return as.users.DeleteUserById(ctx, params.UserId)
 }
 
 func (as *AuthService) RunPeriodicCleanUpTask(parentContext context.Context) context.CancelFunc {
-	ticker := time.NewTicker(DefaultCleanUpInterval)
+	ticker := time.NewTicker(as.config.CleanUpInterval)
 	ctx, cancel := context.WithCancel(parentContext)
 
 	log.Println("Starting AuthService clean up task")
@@ -174,6 +433,12 @@ func (as *AuthService) RunPeriodicCleanUpTask(parentContext context.Context) con
 				if err := as.sessions.DeleteExpired(ctx); err != nil {
 					log.Println("Error deleting expired sessions", err)
 				}
+				if err := as.loginAttempts.DeleteStale(ctx, time.Now().Add(-LoginFailureWindow)); err != nil {
+					log.Println("Error deleting stale login attempts", err)
+				}
+				if err := as.twoFactor.DeleteExpiredLoginChallenges(ctx); err != nil {
+					log.Println("Error deleting expired login challenges", err)
+				}
 			case <-ctx.Done():
 				ticker.Stop()
 				return
@@ -191,8 +456,18 @@ func generateSessionToken(length int) (string, error) {
 	return base64.StdEncoding.EncodeToString(randomValues), nil
 }
 
-func newSessionExpirationTime() time.Time {
-	return time.Now().Add(DefaultSessionDuration)
+func (as *AuthService) sessionDuration(remember bool) time.Duration {
+	if remember {
+		return as.config.RememberedSessionDuration
+	}
+	return as.config.SessionDuration
+}
+
+func (as *AuthService) maxSessionLifetime(remember bool) time.Duration {
+	if remember {
+		return as.config.MaxRememberedSessionLifetime
+	}
+	return as.config.MaxSessionLifetime
 }
 
 func IsSessionExpired(session models.Session) bool {
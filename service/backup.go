@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBackupInterval  time.Duration = time.Hour * 24
+	DefaultBackupRetention int           = 7
+	backupFilePrefix       string        = "cpaw-"
+	backupFileSuffix       string        = ".db"
+)
+
+var ErrBackupsDisabled = errors.New("Scheduled backups are disabled")
+
+// Backuper writes a consistent copy of a database while it is in use.
+type Backuper interface {
+	Backup(ctx context.Context, path string) error
+}
+
+type BackupConfig struct {
+	// Dir is the directory of scheduled backups. Scheduled backups are
+	// disabled if it is empty.
+	Dir      string
+	Interval time.Duration
+	// Retention is the number of scheduled backups to keep.
+	Retention int
+}
+
+func (c BackupConfig) IsEnabled() bool {
+	return len(c.Dir) > 0
+}
+
+type BackupService struct {
+	db     Backuper
+	config BackupConfig
+}
+
+func NewBackupService(db Backuper, config BackupConfig) *BackupService {
+	if config.Interval <= 0 {
+		config.Interval = DefaultBackupInterval
+	}
+	if config.Retention <= 0 {
+		config.Retention = DefaultBackupRetention
+	}
+	return &BackupService{db: db, config: config}
+}
+
+// CreateBackup writes a backup to the backup directory and deletes the oldest
+// ones exceeding the retention count. It returns the path of the backup.
+func (bs *BackupService) CreateBackup(ctx context.Context) (string, error) {
+	if !bs.config.IsEnabled() {
+		return "", ErrBackupsDisabled
+	}
+	if err := os.MkdirAll(bs.config.Dir, 0o700); err != nil {
+		return "", err
+	}
+	name := backupFilePrefix + time.Now().UTC().Format("20060102-150405") + backupFileSuffix
+	path := filepath.Join(bs.config.Dir, name)
+	if err := bs.db.Backup(ctx, path); err != nil {
+		return "", err
+	}
+	return path, bs.pruneBackups()
+}
+
+// ListBackups returns the paths of the scheduled backups, oldest first.
+func (bs *BackupService) ListBackups() ([]string, error) {
+	entries, err := os.ReadDir(bs.config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() &&
+			strings.HasPrefix(name, backupFilePrefix) &&
+			strings.HasSuffix(name, backupFileSuffix) {
+			paths = append(paths, filepath.Join(bs.config.Dir, name))
+		}
+	}
+	// The timestamp in the name sorts backups by age.
+	slices.Sort(paths)
+	return paths, nil
+}
+
+func (bs *BackupService) pruneBackups() error {
+	paths, err := bs.ListBackups()
+	if err != nil {
+		return err
+	}
+	for len(paths) > bs.config.Retention {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
+
+// OpenBackup writes a backup to a temporary file, which is deleted on close.
+func (bs *BackupService) OpenBackup(ctx context.Context) (io.ReadCloser, error) {
+	dir, err := os.MkdirTemp("", "cpaw-backup-*")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "cpaw.db")
+	if err := bs.db.Backup(ctx, path); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &tempBackup{File: file, dir: dir}, nil
+}
+
+type tempBackup struct {
+	*os.File
+	dir string
+}
+
+func (tb *tempBackup) Close() error {
+	err := tb.File.Close()
+	if removeErr := os.RemoveAll(tb.dir); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+func (bs *BackupService) RunPeriodicBackupTask(parentContext context.Context) context.CancelFunc {
+	ticker := time.NewTicker(bs.config.Interval)
+	ctx, cancel := context.WithCancel(parentContext)
+
+	log.Println("Starting BackupService backup task")
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				path, err := bs.CreateBackup(ctx)
+				if err != nil {
+					log.Println("Error creating backup", err)
+				} else {
+					log.Println("Created backup", path)
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return cancel
+}
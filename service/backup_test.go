@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/michaelhass/cpaw/db"
+)
+
+func prepareTestSqlite(t *testing.T) *db.Sqlite {
+	sqlite, err := db.NewSqlite(db.WithDbPath(filepath.Join(t.TempDir(), "service_test.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.SetUp(); err != nil {
+		t.Fatal(err)
+	}
+	return sqlite
+}
+
+func TestBackup(t *testing.T) {
+	sqlite := prepareTestSqlite(t)
+	ctx := context.Background()
+
+	t.Run("Scheduled", func(t *testing.T) {
+		dir := t.TempDir()
+		backupService := NewBackupService(sqlite, BackupConfig{Dir: dir, Retention: 2})
+
+		for _, name := range []string{"cpaw-20200101-000000.db", "cpaw-20210101-000000.db", "other.db"} {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		path, err := backupService.CreateBackup(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		backups, err := backupService.ListBackups()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{filepath.Join(dir, "cpaw-20210101-000000.db"), path}
+		if len(backups) != len(want) || backups[0] != want[0] || backups[1] != want[1] {
+			t.Errorf("Expected %v. Got: %v", want, backups)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "other.db")); err != nil {
+			t.Error("Expected other files to be kept. Got: ", err)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		backupService := NewBackupService(sqlite, BackupConfig{})
+		if _, err := backupService.CreateBackup(ctx); !errors.Is(err, ErrBackupsDisabled) {
+			t.Error("Expected 'ErrBackupsDisabled'. Got: ", err)
+		}
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		backupService := NewBackupService(sqlite, BackupConfig{})
+		backup, err := backupService.OpenBackup(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(backup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), "SQLite format 3\x00") {
+			t.Error("Expected SQLite database")
+		}
+
+		tmp := backup.(*tempBackup)
+		if err := backup.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(tmp.dir); !errors.Is(err, fs.ErrNotExist) {
+			t.Error("Expected temporary backup to be deleted. Got: ", err)
+		}
+	})
+}
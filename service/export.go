@@ -0,0 +1,417 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/models"
+)
+
+// Exports contain the personal items of users. Items of workspaces, burn after
+// read and expired items are not exported.
+//
+// A JSON Lines export has one models.ExportedItem per line, oldest first. It
+// only describes attachments, but doesn't contain their data.
+//
+// A zip export contains the same lines as items.jsonl and the data of each
+// attachment in the file named by the path of the attachment, e.g.
+// attachments/<attachment id>.
+//
+// Imports accept both formats. Items with the same content hash as an item of
+// the user, or an earlier item of the import, are skipped and reported as
+// conflict.
+const (
+	JsonLinesExportFormat ExportFormat = "jsonl"
+	ZipExportFormat       ExportFormat = "zip"
+
+	exportItemsFileName string = "items.jsonl"
+	exportAttachmentDir string = "attachments/"
+	maxExportLineSize   int    = 64 << 20
+	// maxImportAttachmentsSize limits the attachments of an imported item
+	// like uploads do.
+	maxImportAttachmentsSize int64 = 32 << 20
+)
+
+var (
+	ErrInvalidExportFormat = errors.New("Invalid export format. Please use 'jsonl' or 'zip'")
+	ErrInvalidImport       = errors.New("Invalid import file")
+)
+
+type ExportFormat string
+
+func (f ExportFormat) IsValid() bool {
+	return f == JsonLinesExportFormat || f == ZipExportFormat
+}
+
+type ExportService struct {
+	items repository.ItemStore
+	users repository.UserStore
+}
+
+func NewExportService(items repository.ItemStore, users repository.UserStore) *ExportService {
+	return &ExportService{items: items, users: users}
+}
+
+type ExportItemsParams struct {
+	// UserId is the user whose items are exported. If empty, the items of all
+	// users are exported.
+	UserId string
+	Format ExportFormat
+}
+
+func (es *ExportService) ExportItems(ctx context.Context, params ExportItemsParams, w io.Writer) error {
+	if !params.Format.IsValid() {
+		return ErrInvalidExportFormat
+	}
+	users, err := es.exportedUsers(ctx, params.UserId)
+	if err != nil {
+		return err
+	}
+
+	var (
+		itemsWriter io.Writer = w
+		zipWriter   *zip.Writer
+	)
+	if params.Format == ZipExportFormat {
+		zipWriter = zip.NewWriter(w)
+		if itemsWriter, err = zipWriter.Create(exportItemsFileName); err != nil {
+			return err
+		}
+	}
+
+	var attachments []repository.GetAttachmentForUserParams
+	encoder := json.NewEncoder(itemsWriter)
+	for _, user := range users {
+		page, err := es.items.ListItemsForUser(ctx, repository.ListItemsForUserParams{UserId: user.Id})
+		if err != nil {
+			return err
+		}
+		// Items are listed newest first.
+		for _, item := range slices.Backward(page.Items) {
+			if item.BurnAfterRead {
+				continue
+			}
+			exported := exportItem(item, user.UserName, zipWriter != nil)
+			if err := encoder.Encode(exported); err != nil {
+				return err
+			}
+			for _, attachment := range item.Attachments {
+				attachments = append(attachments, repository.GetAttachmentForUserParams{
+					AttachmentId: attachment.Id,
+					ItemId:       item.Id,
+					UserId:       user.Id,
+				})
+			}
+		}
+	}
+	if zipWriter == nil {
+		return nil
+	}
+
+	for _, params := range attachments {
+		attachment, err := es.items.GetAttachmentForUser(ctx, params)
+		if err != nil {
+			return err
+		}
+		file, err := zipWriter.Create(exportAttachmentDir + attachment.Id)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(attachment.Data); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+func (es *ExportService) exportedUsers(ctx context.Context, userId string) ([]models.User, error) {
+	if len(userId) == 0 {
+		return es.users.ListUsers(ctx)
+	}
+	user, err := es.users.GetUserById(ctx, userId)
+	return []models.User{user}, err
+}
+
+func exportItem(item models.Item, userName string, withData bool) models.ExportedItem {
+	exported := models.ExportedItem{
+		Id:          item.Id,
+		CreatedAt:   item.CreatedAt,
+		UpdatedAt:   item.UpdatedAt,
+		ExpiresAt:   item.ExpiresAt,
+		UserName:    userName,
+		Content:     item.Content,
+		ContentHash: itemContentHash(item.Content, item.Attachments),
+	}
+	for _, attachment := range item.Attachments {
+		exportedAttachment := models.ExportedAttachment{
+			Id:       attachment.Id,
+			FileName: attachment.FileName,
+			MimeType: attachment.MimeType,
+			Size:     attachment.Size,
+		}
+		if withData {
+			exportedAttachment.Path = exportAttachmentDir + attachment.Id
+		}
+		exported.Attachments = append(exported.Attachments, exportedAttachment)
+	}
+	return exported
+}
+
+// itemContentHash hashes the content and the attachment metadata of an item.
+// The data of attachments is left out, so existing items can be compared
+// without loading it.
+func itemContentHash(content string, attachments []models.Attachment) string {
+	hash := sha256.New()
+	io.WriteString(hash, content)
+	for _, attachment := range attachments {
+		fmt.Fprintf(hash, "\x00%s\x00%s\x00%d", attachment.FileName, attachment.MimeType, attachment.Size)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+type ImportItemsParams struct {
+	// UserId is the user who gets all imported items. If empty, items are
+	// imported for the user with the exported user name.
+	UserId string
+	// Data is a JSON Lines or zip export.
+	Data []byte
+}
+
+// ImportItems recreates exported items with their original creation time.
+// Items that can't be imported are reported as conflict in the result.
+func (es *ExportService) ImportItems(ctx context.Context, params ImportItemsParams) (models.ImportResult, error) {
+	result := models.ImportResult{Conflicts: []models.ImportConflict{}}
+
+	lines, files, err := openImport(params.Data)
+	if err != nil {
+		return result, err
+	}
+
+	importer := itemImporter{es: es, userId: params.UserId, users: map[string]*importUser{}}
+	scanner := bufio.NewScanner(lines)
+	scanner.Buffer(nil, maxExportLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var exported models.ExportedItem
+		if err := json.Unmarshal(scanner.Bytes(), &exported); err != nil {
+			result.Conflicts = append(result.Conflicts, models.ImportConflict{Line: line, Reason: "Invalid item"})
+			continue
+		}
+		reason, err := importer.importItem(ctx, exported, files)
+		if err != nil {
+			return result, err
+		}
+		if len(reason) > 0 {
+			result.Conflicts = append(result.Conflicts, models.ImportConflict{
+				Line:   line,
+				ItemId: exported.Id,
+				Reason: reason,
+			})
+			continue
+		}
+		result.Imported++
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	return result, nil
+}
+
+// openImport returns the items and, for zip exports, the attachment files of
+// an export.
+func openImport(data []byte) (io.Reader, map[string]*zip.File, error) {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return bytes.NewReader(data), nil, nil
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	itemsFile, ok := files[exportItemsFileName]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: missing %s", ErrInvalidImport, exportItemsFileName)
+	}
+	lines, err := itemsFile.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	return lines, files, nil
+}
+
+type itemImporter struct {
+	es     *ExportService
+	userId string
+	// users caches the users items are imported for by user name.
+	users map[string]*importUser
+}
+
+type importUser struct {
+	user models.User
+	// contentHashes contains the hashes of existing and imported items.
+	contentHashes map[string]bool
+}
+
+// importItem imports a single item. It returns the reason if the item is not
+// imported.
+func (ii *itemImporter) importItem(
+	ctx context.Context,
+	exported models.ExportedItem,
+	files map[string]*zip.File,
+) (string, error) {
+	user, err := ii.user(ctx, exported.UserName)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "Unknown user " + strconv.Quote(exported.UserName), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if exported.ExpiresAt > 0 && exported.ExpiresAt <= time.Now().Unix() {
+		return "Item has expired", nil
+	}
+
+	var attachmentsSize int64
+	for _, exportedAttachment := range exported.Attachments {
+		if exportedAttachment.Size < 0 {
+			return "Invalid size of attachment " + strconv.Quote(exportedAttachment.FileName), nil
+		}
+		attachmentsSize += exportedAttachment.Size
+		if attachmentsSize > maxImportAttachmentsSize {
+			return "Attachments are too large", nil
+		}
+	}
+
+	attachments := make([]models.Attachment, len(exported.Attachments))
+	createAttachments := make([]repository.CreateAttachmentParams, len(exported.Attachments))
+	for i, exportedAttachment := range exported.Attachments {
+		file, ok := files[exportedAttachment.Path]
+		if !ok || len(exportedAttachment.Path) == 0 {
+			return "Missing data of attachment " + strconv.Quote(exportedAttachment.FileName), nil
+		}
+		data, err := readZipFile(file, exportedAttachment.Size)
+		if err != nil {
+			return "Invalid data of attachment " + strconv.Quote(exportedAttachment.FileName), nil
+		}
+		attachments[i] = models.Attachment{
+			FileName: exportedAttachment.FileName,
+			MimeType: exportedAttachment.MimeType,
+			Size:     exportedAttachment.Size,
+		}
+		createAttachments[i] = repository.CreateAttachmentParams{
+			FileName: exportedAttachment.FileName,
+			MimeType: exportedAttachment.MimeType,
+			Data:     data,
+		}
+	}
+	// The repository lists attachments by file name, so the hash of the
+	// imported item matches the one of the exported item.
+	slices.SortStableFunc(attachments, func(a, b models.Attachment) int {
+		return strings.Compare(a.FileName, b.FileName)
+	})
+
+	contentHash := itemContentHash(exported.Content, attachments)
+	if len(exported.ContentHash) > 0 && exported.ContentHash != contentHash {
+		return "Content hash doesn't match", nil
+	}
+	if user.contentHashes[contentHash] {
+		return "Item already exists", nil
+	}
+	if len(exported.Content) == 0 && len(attachments) == 0 {
+		return "Item is empty", nil
+	}
+
+	var expiresAt time.Time
+	if exported.ExpiresAt > 0 {
+		expiresAt = time.Unix(exported.ExpiresAt, 0)
+	}
+	_, err = ii.es.items.CreateItem(ctx, repository.CreateItemParams{
+		Content:     exported.Content,
+		UserId:      user.user.Id,
+		ExpiresAt:   expiresAt,
+		Attachments: createAttachments,
+		CreatedAt:   time.Unix(exported.CreatedAt, 0),
+	})
+	if err != nil {
+		return "", err
+	}
+	user.contentHashes[contentHash] = true
+	return "", nil
+}
+
+func (ii *itemImporter) user(ctx context.Context, userName string) (*importUser, error) {
+	if len(ii.userId) > 0 {
+		// All items go to the same user.
+		userName = ""
+	}
+	if user, ok := ii.users[userName]; ok {
+		return user, nil
+	}
+
+	var (
+		user models.User
+		err  error
+	)
+	if len(ii.userId) > 0 {
+		user, err = ii.es.users.GetUserById(ctx, ii.userId)
+	} else {
+		user, err = ii.es.users.GetUserByName(ctx, userName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := ii.es.items.ListItemsForUser(ctx, repository.ListItemsForUserParams{UserId: user.Id})
+	if err != nil {
+		return nil, err
+	}
+	imported := &importUser{user: user, contentHashes: map[string]bool{}}
+	for _, item := range page.Items {
+		if !item.BurnAfterRead {
+			imported.contentHashes[itemContentHash(item.Content, item.Attachments)] = true
+		}
+	}
+	ii.users[userName] = imported
+	return imported, nil
+}
+
+// readZipFile reads a file of an archive, which must have the given size. The
+// size is checked before decompressing and no more than it is read, so a
+// manipulated archive can't expand beyond the size stated in the export.
+func readZipFile(file *zip.File, size int64) ([]byte, error) {
+	if file.UncompressedSize64 != uint64(size) {
+		return nil, fmt.Errorf("%w: unexpected size of %s", ErrInvalidImport, file.Name)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		return nil, fmt.Errorf("%w: unexpected size of %s", ErrInvalidImport, file.Name)
+	}
+	return data, nil
+}
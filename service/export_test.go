@@ -0,0 +1,235 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/models"
+)
+
+type exportTestDb struct {
+	items         repository.ItemStore
+	users         repository.UserStore
+	exportService *ExportService
+}
+
+func newExportTestDb(t *testing.T, userNames ...string) (exportTestDb, map[string]models.User) {
+	t.Helper()
+	memory := repository.NewMemoryDB()
+	testDb := exportTestDb{
+		items: repository.NewMemoryItemRepository(memory),
+		users: repository.NewMemoryUserRepository(memory),
+	}
+	testDb.exportService = NewExportService(testDb.items, testDb.users)
+
+	users := map[string]models.User{}
+	for _, userName := range userNames {
+		user, err := testDb.users.CreateUser(context.Background(), repository.CreateUserParams{
+			UserName: userName,
+			Password: "password",
+			Role:     models.UserRole,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[userName] = user
+	}
+	return testDb, users
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	source, sourceUsers := newExportTestDb(t, "alice", "bob")
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, params := range []repository.CreateItemParams{
+		{Content: "text", UserId: sourceUsers["alice"].Id, CreatedAt: createdAt},
+		{
+			Content:   "with attachment",
+			UserId:    sourceUsers["alice"].Id,
+			CreatedAt: createdAt.Add(time.Minute),
+			Attachments: []repository.CreateAttachmentParams{
+				{FileName: "b.txt", MimeType: "text/plain", Data: []byte("bbb")},
+				{FileName: "a.txt", MimeType: "text/plain", Data: []byte("a")},
+			},
+		},
+		{Content: "secret", UserId: sourceUsers["alice"].Id, BurnAfterRead: true},
+		{Content: "text", UserId: sourceUsers["bob"].Id},
+	} {
+		if _, err := source.items.CreateItem(ctx, params); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	export := func(t *testing.T, format ExportFormat) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		err := source.exportService.ExportItems(ctx, ExportItemsParams{Format: format}, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	t.Run("Zip", func(t *testing.T) {
+		target, targetUsers := newExportTestDb(t, "alice")
+		data := export(t, ZipExportFormat)
+
+		result, err := target.exportService.ImportItems(ctx, ImportItemsParams{Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Imported != 2 {
+			t.Errorf("Expected 2 imported items. Got: %d", result.Imported)
+		}
+		if len(result.Conflicts) != 1 || !strings.Contains(result.Conflicts[0].Reason, "Unknown user") {
+			t.Errorf("Expected conflict for unknown user. Got: %v", result.Conflicts)
+		}
+
+		page, err := target.items.ListItemsForUser(ctx, repository.ListItemsForUserParams{
+			UserId: targetUsers["alice"].Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Items) != 2 {
+			t.Fatalf("Expected 2 items. Got: %d", len(page.Items))
+		}
+		withAttachment, text := page.Items[0], page.Items[1]
+		if text.Content != "text" || text.CreatedAt != createdAt.Unix() {
+			t.Errorf("Expected original item. Got: %+v", text)
+		}
+		if len(withAttachment.Attachments) != 2 {
+			t.Fatalf("Expected 2 attachments. Got: %d", len(withAttachment.Attachments))
+		}
+		attachment, err := target.items.GetAttachmentForUser(ctx, repository.GetAttachmentForUserParams{
+			AttachmentId: withAttachment.Attachments[1].Id,
+			ItemId:       withAttachment.Id,
+			UserId:       targetUsers["alice"].Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(attachment.Data) != "bbb" {
+			t.Errorf("Expected attachment data 'bbb'. Got: %q", attachment.Data)
+		}
+
+		result, err = target.exportService.ImportItems(ctx, ImportItemsParams{Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Imported != 0 || len(result.Conflicts) != 3 {
+			t.Errorf("Expected all items to be skipped. Got: %+v", result)
+		}
+	})
+
+	t.Run("JsonLinesForUser", func(t *testing.T) {
+		target, targetUsers := newExportTestDb(t, "carol")
+		data := export(t, JsonLinesExportFormat)
+
+		result, err := target.exportService.ImportItems(ctx, ImportItemsParams{
+			UserId: targetUsers["carol"].Id,
+			Data:   data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The text of bob duplicates the one of alice and the attachment data
+		// is missing.
+		if result.Imported != 1 || len(result.Conflicts) != 2 {
+			t.Fatalf("Expected 1 imported item and 2 conflicts. Got: %+v", result)
+		}
+		for _, conflict := range result.Conflicts {
+			if len(conflict.ItemId) == 0 || conflict.Line == 0 {
+				t.Errorf("Expected conflict with item id and line. Got: %+v", conflict)
+			}
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		target, _ := newExportTestDb(t, "alice")
+		data := export(t, JsonLinesExportFormat)
+		data = bytes.Replace(data, []byte(`"content":"text"`), []byte(`"content":"changed"`), 1)
+		data = append(data, []byte("{invalid\n")...)
+
+		result, err := target.exportService.ImportItems(ctx, ImportItemsParams{Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reasons := []string{}
+		for _, conflict := range result.Conflicts {
+			reasons = append(reasons, conflict.Reason)
+		}
+		got := strings.Join(reasons, ", ")
+		for _, want := range []string{"Content hash doesn't match", "Invalid item"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Expected conflict %q. Got: %s", want, got)
+			}
+		}
+
+		err = source.exportService.ExportItems(ctx, ExportItemsParams{Format: "csv"}, &bytes.Buffer{})
+		if err != ErrInvalidExportFormat {
+			t.Errorf("Expected ErrInvalidExportFormat. Got: %v", err)
+		}
+	})
+	t.Run("OversizedAttachments", func(t *testing.T) {
+		target, _ := newExportTestDb(t, "alice")
+
+		var buf bytes.Buffer
+		archive := zip.NewWriter(&buf)
+		// The data expands far beyond the size stated in items.jsonl.
+		bomb, err := archive.Create("attachments/bomb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bomb.Write(make([]byte, 8<<20)); err != nil {
+			t.Fatal(err)
+		}
+		lines, err := archive.Create(exportItemsFileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoder := json.NewEncoder(lines)
+		for _, item := range []models.ExportedItem{
+			{
+				Id:       "bomb",
+				UserName: "alice",
+				Attachments: []models.ExportedAttachment{
+					{FileName: "bomb.bin", Size: 3, Path: "attachments/bomb"},
+				},
+			},
+			{
+				Id:       "large",
+				UserName: "alice",
+				Attachments: []models.ExportedAttachment{
+					{FileName: "large.bin", Size: maxImportAttachmentsSize + 1, Path: "attachments/bomb"},
+				},
+			},
+		} {
+			if err := encoder.Encode(item); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := target.exportService.ImportItems(ctx, ImportItemsParams{Data: buf.Bytes()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Imported != 0 || len(result.Conflicts) != 2 {
+			t.Fatalf("Expected 2 conflicts. Got: %+v", result)
+		}
+		if !strings.Contains(result.Conflicts[0].Reason, "Invalid data") ||
+			!strings.Contains(result.Conflicts[1].Reason, "too large") {
+			t.Errorf("Unexpected conflicts: %+v", result.Conflicts)
+		}
+	})
+}
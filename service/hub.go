@@ -0,0 +1,68 @@
+package service
+
+import (
+	"log"
+	"sync"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+const itemEventBufferSize int = 32
+
+// ItemEventHub fans out item events to all subscribers of a user within this
+// process. Events are dropped for subscribers that do not keep up.
+type ItemEventHub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan models.ItemEvent]struct{}
+}
+
+func NewItemEventHub() *ItemEventHub {
+	return &ItemEventHub{
+		subscribers: map[string]map[chan models.ItemEvent]struct{}{},
+	}
+}
+
+func (h *ItemEventHub) Subscribe(userId string) (<-chan models.ItemEvent, func()) {
+	events := make(chan models.ItemEvent, itemEventBufferSize)
+
+	h.mu.Lock()
+	if h.subscribers[userId] == nil {
+		h.subscribers[userId] = map[chan models.ItemEvent]struct{}{}
+	}
+	h.subscribers[userId][events] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers[userId], events)
+			if len(h.subscribers[userId]) == 0 {
+				delete(h.subscribers, userId)
+			}
+			close(events)
+		})
+	}
+	return events, unsubscribe
+}
+
+// Publish sends an event to the subscribers of the item's owner.
+func (h *ItemEventHub) Publish(event models.ItemEvent) {
+	h.PublishTo(event.UserId, event)
+}
+
+// PublishTo sends an event to the subscribers of any user, e.g. the members
+// of a workspace.
+func (h *ItemEventHub) PublishTo(userId string, event models.ItemEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for events := range h.subscribers[userId] {
+		select {
+		case events <- event:
+		default:
+			log.Println("Dropping item event for slow subscriber of user", userId)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/michaelhass/cpaw/models"
+)
+
+func TestItemEventHub(t *testing.T) {
+	hub := NewItemEventHub()
+
+	first, unsubscribeFirst := hub.Subscribe("user_1")
+	second, unsubscribeSecond := hub.Subscribe("user_1")
+	other, unsubscribeOther := hub.Subscribe("user_2")
+	defer unsubscribeSecond()
+	defer unsubscribeOther()
+
+	event := models.ItemEvent{Type: models.ItemCreatedEvent, ItemId: "item", UserId: "user_1"}
+	hub.Publish(event)
+
+	for _, events := range []<-chan models.ItemEvent{first, second} {
+		select {
+		case got := <-events:
+			if got != event {
+				t.Errorf("Expected %v. Got: %v", event, got)
+			}
+		default:
+			t.Error("Expected event for subscriber")
+		}
+	}
+
+	select {
+	case got := <-other:
+		t.Errorf("Unexpected event for other user: %v", got)
+	default:
+	}
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	if _, ok := <-first; ok {
+		t.Error("Expected closed channel after unsubscribe")
+	}
+
+	for range itemEventBufferSize + 1 {
+		hub.Publish(event)
+	}
+	if len(second) != itemEventBufferSize {
+		t.Errorf("Expected full buffer. Got: %d", len(second))
+	}
+}
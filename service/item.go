@@ -2,41 +2,360 @@ package service
 
 import (
 	"context"
+	"errors"
+	"log"
+	"time"
 
 	"github.com/michaelhass/cpaw/db/repository"
 	"github.com/michaelhass/cpaw/models"
 )
 
+const (
+	DefaultItemPageLimit     int = 50
+	MaxItemPageLimit         int = 200
+	DefaultSearchResultLimit int = 50
+)
+
+var (
+	ErrItemExpiresAt               = errors.New("Expiration must be in the future")
+	ErrBurnAfterReadAttachments    = errors.New("Burn after read items can't have attachments")
+	ErrBurnAfterReadMissingContent = errors.New("Burn after read items need content")
+)
+
+// ItemService manages personal items and the items of workspaces. Members of
+// a workspace can read and post items, but only modify their own ones unless
+// they own the workspace.
 type ItemService struct {
-	items *repository.ItemRepository
+	items           repository.ItemStore
+	workspaces      repository.WorkspaceStore
+	events          *ItemEventHub
+	cleanUpInterval time.Duration
+}
+
+type ItemServiceOption func(*ItemService)
+
+func WithItemCleanUpInterval(interval time.Duration) ItemServiceOption {
+	return func(is *ItemService) {
+		if interval > 0 {
+			is.cleanUpInterval = interval
+		}
+	}
 }
 
-func NewItemService(items *repository.ItemRepository) *ItemService {
-	return &ItemService{items: items}
+func NewItemService(
+	items repository.ItemStore,
+	workspaces repository.WorkspaceStore,
+	events *ItemEventHub,
+	opts ...ItemServiceOption,
+) *ItemService {
+	itemService := &ItemService{
+		items:           items,
+		workspaces:      workspaces,
+		events:          events,
+		cleanUpInterval: DefaultCleanUpInterval,
+	}
+	for _, opt := range opts {
+		opt(itemService)
+	}
+	return itemService
 }
 
 type CreateItemsParams = repository.CreateItemParams
 
 func (is *ItemService) CreateItem(ctx context.Context, params CreateItemsParams) (models.Item, error) {
-	return is.items.CreateItem(ctx, params)
+	if !params.ExpiresAt.IsZero() && !params.ExpiresAt.After(time.Now()) {
+		return models.Item{}, ErrItemExpiresAt
+	}
+	if params.BurnAfterRead && len(params.Attachments) > 0 {
+		return models.Item{}, ErrBurnAfterReadAttachments
+	}
+	if params.BurnAfterRead && len(params.Content) == 0 {
+		return models.Item{}, ErrBurnAfterReadMissingContent
+	}
+	if err := is.authorizeWorkspace(ctx, params.WorkspaceId, params.UserId); err != nil {
+		return models.Item{}, err
+	}
+
+	item, err := is.items.CreateItem(ctx, params)
+	if err != nil {
+		return item, err
+	}
+
+	// Other clients only learn about burn after read items, reading them
+	// would burn them.
+	eventItem := item
+	if eventItem.BurnAfterRead {
+		eventItem.Content = ""
+	}
+	is.publish(ctx, models.ItemEvent{
+		Type:        models.ItemCreatedEvent,
+		ItemId:      item.Id,
+		UserId:      item.UserId,
+		WorkspaceId: item.WorkspaceId,
+		Item:        &eventItem,
+	})
+	return item, nil
 }
 
 func (is *ItemService) GetItemById(ctx context.Context, itemId string) (models.Item, error) {
 	return is.items.GetItemById(ctx, itemId)
 }
 
+type CreateAttachmentParams = repository.CreateAttachmentParams
+
 type GetItemForUserParams = repository.GetItemForUserParams
 
+// GetItemForUser returns an item the user can read. Burn after read items are
+// deleted by this.
 func (is *ItemService) GetItemForUser(ctx context.Context, params GetItemForUserParams) (models.Item, error) {
-	return is.items.GetItemForUser(ctx, params)
+	item, err := is.authorizeItem(ctx, params.ItemId, params.UserId, false)
+	if err != nil {
+		return item, err
+	}
+	params.UserId = item.UserId
+
+	item, err = is.items.GetItemForUser(ctx, params)
+	if err != nil {
+		return item, err
+	}
+	if item.BurnAfterRead {
+		is.publishDeleted(ctx, item)
+	}
+	return item, nil
+}
+
+// GetItemForUpdate returns an item the user can modify. Unlike GetItemForUser
+// it never deletes burn after read items.
+func (is *ItemService) GetItemForUpdate(ctx context.Context, params GetItemForUserParams) (models.Item, error) {
+	return is.authorizeItem(ctx, params.ItemId, params.UserId, true)
 }
 
-func (is *ItemService) ListItemsForUser(ctx context.Context, userId string) ([]models.Item, error) {
-	return is.items.ListItemsForUser(ctx, userId)
+type ListItemsForUserParams = repository.ListItemsForUserParams
+
+func (is *ItemService) ListItemsForUser(ctx context.Context, params ListItemsForUserParams) (models.ItemPage, error) {
+	if params.Limit <= 0 {
+		params.Limit = DefaultItemPageLimit
+	}
+	params.Limit = min(params.Limit, MaxItemPageLimit)
+	if err := is.authorizeWorkspace(ctx, params.WorkspaceId, params.UserId); err != nil {
+		return models.ItemPage{}, err
+	}
+	return is.items.ListItemsForUser(ctx, params)
+}
+
+type ListItemsForUserCreatedSinceParams = repository.ListItemsForUserCreatedSinceParams
+
+func (is *ItemService) ListItemsForUserCreatedSince(
+	ctx context.Context,
+	params ListItemsForUserCreatedSinceParams,
+) ([]models.Item, error) {
+	return is.items.ListItemsForUserCreatedSince(ctx, params)
+}
+
+type SearchItemsForUserParams = repository.SearchItemsForUserParams
+
+func (is *ItemService) SearchItemsForUser(ctx context.Context, params SearchItemsForUserParams) ([]models.ItemSearchResult, error) {
+	if params.Limit <= 0 {
+		params.Limit = DefaultSearchResultLimit
+	}
+	if err := is.authorizeWorkspace(ctx, params.WorkspaceId, params.UserId); err != nil {
+		return nil, err
+	}
+	return is.items.SearchItemsForUser(ctx, params)
+}
+
+type UpdateItemForUserParams = repository.UpdateItemForUserParams
+
+func (is *ItemService) UpdateItemForUser(ctx context.Context, params UpdateItemForUserParams) (models.Item, error) {
+	item, err := is.authorizeItem(ctx, params.ItemId, params.UserId, true)
+	if err != nil {
+		return item, err
+	}
+	params.UserId = item.UserId
+
+	item, err = is.items.UpdateItemForUser(ctx, params)
+	if err != nil {
+		return item, err
+	}
+	is.publish(ctx, models.ItemEvent{
+		Type:        models.ItemUpdatedEvent,
+		ItemId:      item.Id,
+		UserId:      item.UserId,
+		WorkspaceId: item.WorkspaceId,
+		Item:        &item,
+	})
+	return item, nil
+}
+
+type ListItemRevisionsForUserParams = repository.ListItemRevisionsForUserParams
+
+func (is *ItemService) ListItemRevisionsForUser(
+	ctx context.Context,
+	params ListItemRevisionsForUserParams,
+) ([]models.ItemRevision, error) {
+	item, err := is.authorizeItem(ctx, params.ItemId, params.UserId, false)
+	if err != nil {
+		return nil, err
+	}
+	params.UserId = item.UserId
+	return is.items.ListItemRevisionsForUser(ctx, params)
+}
+
+type RestoreItemRevisionParams = repository.GetItemRevisionForUserParams
+
+// RestoreItemRevision makes the content of a revision the current content of
+// its item. The replaced content becomes a new revision.
+func (is *ItemService) RestoreItemRevision(ctx context.Context, params RestoreItemRevisionParams) (models.Item, error) {
+	item, err := is.authorizeItem(ctx, params.ItemId, params.UserId, true)
+	if err != nil {
+		return item, err
+	}
+
+	revision, err := is.items.GetItemRevisionForUser(ctx, RestoreItemRevisionParams{
+		RevisionId: params.RevisionId,
+		ItemId:     item.Id,
+		UserId:     item.UserId,
+	})
+	if err != nil {
+		return models.Item{}, err
+	}
+	return is.UpdateItemForUser(ctx, UpdateItemForUserParams{
+		ItemId:  revision.ItemId,
+		UserId:  params.UserId,
+		Content: revision.Content,
+	})
 }
 
 type DeleteUserItemParams = repository.DeleteUserItemParams
 
 func (is *ItemService) DeleteItemForUser(ctx context.Context, params DeleteUserItemParams) error {
-	return is.items.DeleteItemForUser(ctx, params)
+	item, err := is.authorizeItem(ctx, params.ItemId, params.UserId, true)
+	if err != nil {
+		return err
+	}
+	params.UserId = item.UserId
+
+	if err := is.items.DeleteItemForUser(ctx, params); err != nil {
+		return err
+	}
+	is.publishDeleted(ctx, item)
+	return nil
+}
+
+func (is *ItemService) publishDeleted(ctx context.Context, item models.Item) {
+	is.publish(ctx, models.ItemEvent{
+		Type:        models.ItemDeletedEvent,
+		ItemId:      item.Id,
+		UserId:      item.UserId,
+		WorkspaceId: item.WorkspaceId,
+	})
+}
+
+// publish notifies the owner of a personal item or all members of the item's
+// workspace.
+func (is *ItemService) publish(ctx context.Context, event models.ItemEvent) {
+	if len(event.WorkspaceId) == 0 {
+		is.events.Publish(event)
+		return
+	}
+	members, err := is.workspaces.ListMembers(ctx, event.WorkspaceId)
+	if err != nil {
+		log.Println("Error loading members of workspace", event.WorkspaceId, err)
+		return
+	}
+	for _, member := range members {
+		is.events.PublishTo(member.UserId, event)
+	}
+}
+
+// authorizeItem returns the item if the user can read it or, if modify is set,
+// change it. Items the user can't see result in ErrNotFound.
+func (is *ItemService) authorizeItem(
+	ctx context.Context,
+	itemId string,
+	userId string,
+	modify bool,
+) (models.Item, error) {
+	item, err := is.items.GetItemById(ctx, itemId)
+	if err != nil {
+		return models.Item{}, err
+	}
+	if len(item.WorkspaceId) == 0 {
+		if item.UserId != userId {
+			return models.Item{}, repository.ErrNotFound
+		}
+		return item, nil
+	}
+
+	workspace, err := is.workspaces.GetWorkspaceForUser(ctx, repository.GetWorkspaceForUserParams{
+		WorkspaceId: item.WorkspaceId,
+		UserId:      userId,
+	})
+	if err != nil {
+		return models.Item{}, err
+	}
+	if modify && item.UserId != userId && workspace.Role != models.WorkspaceOwnerRole {
+		return models.Item{}, ErrPermissionDenied
+	}
+	return item, nil
+}
+
+// authorizeWorkspace checks that the user is a member of the workspace. An
+// empty workspace id refers to the personal items of the user.
+func (is *ItemService) authorizeWorkspace(ctx context.Context, workspaceId string, userId string) error {
+	if len(workspaceId) == 0 {
+		return nil
+	}
+	_, err := is.workspaces.GetWorkspaceForUser(ctx, repository.GetWorkspaceForUserParams{
+		WorkspaceId: workspaceId,
+		UserId:      userId,
+	})
+	return err
+}
+
+// SubscribeItemEvents streams item events of a user and of the workspaces the
+// user is a member of until the returned function is called.
+func (is *ItemService) SubscribeItemEvents(userId string) (<-chan models.ItemEvent, func()) {
+	return is.events.Subscribe(userId)
+}
+
+type GetAttachmentForUserParams = repository.GetAttachmentForUserParams
+
+func (is *ItemService) GetAttachmentForUser(ctx context.Context, params GetAttachmentForUserParams) (models.Attachment, error) {
+	item, err := is.authorizeItem(ctx, params.ItemId, params.UserId, false)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	params.UserId = item.UserId
+	return is.items.GetAttachmentForUser(ctx, params)
+}
+
+func (is *ItemService) RunPeriodicCleanUpTask(parentContext context.Context) context.CancelFunc {
+	ticker := time.NewTicker(is.cleanUpInterval)
+	ctx, cancel := context.WithCancel(parentContext)
+
+	log.Println("Starting ItemService clean up task")
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := is.DeleteExpired(ctx); err != nil {
+					log.Println("Error deleting expired items", err)
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return cancel
+}
+
+// DeleteExpired deletes all expired items and notifies subscribers about it.
+func (is *ItemService) DeleteExpired(ctx context.Context) error {
+	items, err := is.items.DeleteExpired(ctx)
+	for _, item := range items {
+		is.publishDeleted(ctx, item)
+	}
+	return err
 }
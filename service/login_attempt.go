@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/models"
+)
+
+const (
+	// MaxUserNameLoginFailures and MaxIpAddressLoginFailures are the failed
+	// sign in attempts allowed before a user name or IP address is locked.
+	MaxUserNameLoginFailures  int = 5
+	MaxIpAddressLoginFailures int = 20
+	// MaxSharePasswordFailures is the number of wrong passwords allowed before
+	// a share is locked.
+	MaxSharePasswordFailures int = 5
+	// Each further failure doubles the lockout, starting at
+	// MinLoginLockoutDuration, up to MaxLoginLockoutDuration.
+	MinLoginLockoutDuration time.Duration = time.Second * 30
+	MaxLoginLockoutDuration time.Duration = time.Hour
+	// LoginFailureWindow is the time after which failures are forgotten.
+	LoginFailureWindow time.Duration = time.Hour * 24
+)
+
+var ErrTooManyLoginAttempts = errors.New("Too many failed sign in attempts")
+
+// LoginLockedError is returned while a user name or IP address is locked after
+// too many failed sign in attempts.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("%s. Please try again in %s", ErrTooManyLoginAttempts, e.RetryAfter)
+}
+
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrTooManyLoginAttempts
+}
+
+// checkLoginLocks returns a LoginLockedError if any of the keys is locked.
+func checkLoginLocks(
+	ctx context.Context,
+	loginAttempts repository.LoginAttemptStore,
+	keys []repository.GetLoginAttemptParams,
+) error {
+	now := time.Now()
+	var lockedUntil time.Time
+	for _, key := range keys {
+		attempt, err := loginAttempts.GetLoginAttempt(ctx, key)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if until := time.Unix(attempt.LockedUntil, 0); until.After(lockedUntil) {
+			lockedUntil = until
+		}
+	}
+	if !lockedUntil.After(now) {
+		return nil
+	}
+	return &LoginLockedError{RetryAfter: lockedUntil.Sub(now).Round(time.Second)}
+}
+
+// recordLoginFailure counts a failed attempt for each key and locks keys that
+// exceeded their allowed failures.
+func recordLoginFailure(
+	ctx context.Context,
+	loginAttempts repository.LoginAttemptStore,
+	keys []repository.GetLoginAttemptParams,
+) error {
+	now := time.Now()
+	for _, key := range keys {
+		attempt, err := loginAttempts.RecordLoginFailure(ctx, repository.RecordLoginFailureParams{
+			Scope:        key.Scope,
+			Key:          key.Key,
+			FailedAt:     now,
+			ForgetBefore: now.Add(-LoginFailureWindow),
+		})
+		if err != nil {
+			return err
+		}
+		lockout := loginLockoutDuration(attempt)
+		if lockout <= 0 {
+			continue
+		}
+		err = loginAttempts.LockLoginAttempt(ctx, repository.LockLoginAttemptParams{
+			Scope:       key.Scope,
+			Key:         key.Key,
+			LockedUntil: now.Add(lockout),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loginLockoutDuration grows exponentially with the failures beyond the
+// allowed ones of the attempt's scope.
+func loginLockoutDuration(attempt models.LoginAttempt) time.Duration {
+	allowed := MaxUserNameLoginFailures
+	switch attempt.Scope {
+	case models.IpAddressLoginAttemptScope:
+		allowed = MaxIpAddressLoginFailures
+	case models.ShareLoginAttemptScope:
+		allowed = MaxSharePasswordFailures
+	}
+	exceeded := attempt.Failures - allowed
+	if exceeded <= 0 {
+		return 0
+	}
+	lockout := MinLoginLockoutDuration * time.Duration(math.Pow(2, float64(exceeded-1)))
+	if lockout <= 0 || lockout > MaxLoginLockoutDuration {
+		return MaxLoginLockoutDuration
+	}
+	return lockout
+}
+
+func loginAttemptKeys(params SignInParams) []repository.GetLoginAttemptParams {
+	keys := []repository.GetLoginAttemptParams{
+		{Scope: models.UserNameLoginAttemptScope, Key: params.UserName},
+	}
+	if len(params.IpAddress) > 0 {
+		keys = append(keys, repository.GetLoginAttemptParams{
+			Scope: models.IpAddressLoginAttemptScope,
+			Key:   params.IpAddress,
+		})
+	}
+	return keys
+}
+
+// ListLockedUserNames lists the user names that are currently locked after
+// too many failed sign in attempts.
+func (as *AuthService) ListLockedUserNames(ctx context.Context) ([]models.LoginAttempt, error) {
+	return as.loginAttempts.ListLocked(ctx, models.UserNameLoginAttemptScope)
+}
+
+type UnlockUserParams struct {
+	UserId string
+	// UnlockedBy is the user lifting the lock, who needs permission to
+	// manage users.
+	UnlockedBy string
+}
+
+// UnlockUser lifts the lockout of a user and forgets its failed attempts.
+func (as *AuthService) UnlockUser(ctx context.Context, params UnlockUserParams) error {
+	if err := as.Authorize(ctx, params.UnlockedBy, models.ManageUsersPermission); err != nil {
+		return err
+	}
+	user, err := as.users.GetUserById(ctx, params.UserId)
+	if err != nil {
+		return err
+	}
+	return as.loginAttempts.DeleteLoginAttempt(ctx, repository.GetLoginAttemptParams{
+		Scope: models.UserNameLoginAttemptScope,
+		Key:   user.UserName,
+	})
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/models"
+)
+
+func TestLoginLockoutDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt models.LoginAttempt
+		want    time.Duration
+	}{
+		{"allowed", models.LoginAttempt{Scope: models.UserNameLoginAttemptScope, Failures: 5}, 0},
+		{"first lockout", models.LoginAttempt{Scope: models.UserNameLoginAttemptScope, Failures: 6}, 30 * time.Second},
+		{"doubled", models.LoginAttempt{Scope: models.UserNameLoginAttemptScope, Failures: 8}, 2 * time.Minute},
+		{"capped", models.LoginAttempt{Scope: models.UserNameLoginAttemptScope, Failures: 100}, time.Hour},
+		{"ip allowed", models.LoginAttempt{Scope: models.IpAddressLoginAttemptScope, Failures: 20}, 0},
+		{"ip lockout", models.LoginAttempt{Scope: models.IpAddressLoginAttemptScope, Failures: 21}, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loginLockoutDuration(tt.attempt); got != tt.want {
+				t.Errorf("loginLockoutDuration(%v) = %s, want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignInLockout(t *testing.T) {
+	authService := newTestAuthService(repository.NewMemoryDB())
+
+	ctx := context.Background()
+	admin, err := authService.CreateUser(ctx, CreateUserParams{
+		UserName: "lockout_admin",
+		Password: "password",
+		Role:     models.AdminRole,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := authService.CreateUser(ctx, CreateUserParams{UserName: "lockout_user", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signIn := func(password string, ipAddress string) error {
+		_, err := authService.SignIn(ctx, SignInParams{
+			UserName:  user.UserName,
+			Password:  password,
+			IpAddress: ipAddress,
+		})
+		return err
+	}
+
+	for range MaxUserNameLoginFailures {
+		if err := signIn("wrong", "10.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatal("Expected 'ErrInvalidCredentials'. Got: ", err)
+		}
+	}
+	if err := signIn("password", "10.0.0.1"); err != nil {
+		t.Fatal("Expected sign in within allowed failures. Got: ", err)
+	}
+
+	for range MaxUserNameLoginFailures + 1 {
+		signIn("wrong", "10.0.0.1")
+	}
+	err = signIn("password", "10.0.0.2")
+	var lockedErr *LoginLockedError
+	if !errors.As(err, &lockedErr) || !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Fatal("Expected 'LoginLockedError' for locked user name. Got: ", err)
+	}
+	if lockedErr.RetryAfter <= 0 || lockedErr.RetryAfter > MinLoginLockoutDuration {
+		t.Errorf("Unexpected retry after: %s", lockedErr.RetryAfter)
+	}
+
+	locked, err := authService.ListLockedUserNames(ctx)
+	if err != nil || len(locked) != 1 || locked[0].Key != user.UserName {
+		t.Errorf("Expected locked user. Got: %v %v", locked, err)
+	}
+
+	err = authService.UnlockUser(ctx, UnlockUserParams{UserId: user.Id, UnlockedBy: user.Id})
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Error("Expected 'ErrPermissionDenied' for user without permission. Got: ", err)
+	}
+	if err := authService.UnlockUser(ctx, UnlockUserParams{UserId: user.Id, UnlockedBy: admin.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if err := signIn("password", "10.0.0.2"); err != nil {
+		t.Error("Expected sign in after unlock. Got: ", err)
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/models"
+)
+
+var (
+	ErrOidcSignIn = errors.New("Single sign-on failed")
+
+	invalidUserNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+)
+
+type OidcConfig struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	// RedirectURL is the callback registered at the provider, e.g.
+	// https://cpaw.example.com/signin/oidc/callback
+	RedirectURL string
+	// RoleClaim names a string or string list claim, e.g. "groups", whose
+	// values RoleMapping maps onto roles. Users without a mapped value get
+	// DefaultRole.
+	RoleClaim   string
+	RoleMapping map[string]models.Role
+	DefaultRole models.Role
+}
+
+func (c OidcConfig) IsEnabled() bool {
+	return len(c.Issuer) > 0
+}
+
+// OidcService signs in users with the authorization code flow and PKCE of an
+// OpenID Connect provider. Users are created on their first sign in.
+type OidcService struct {
+	config     OidcConfig
+	oauth      oauth2.Config
+	verifier   *oidc.IDTokenVerifier
+	auth       *AuthService
+	identities repository.IdentityStore
+}
+
+// NewOidcService discovers the endpoints of the provider, which has to be
+// reachable.
+func NewOidcService(
+	ctx context.Context,
+	config OidcConfig,
+	authService *AuthService,
+	identities repository.IdentityStore,
+) (*OidcService, error) {
+	if len(config.DefaultRole) == 0 {
+		config.DefaultRole = models.UserRole
+	} else if !config.DefaultRole.IsValid() {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRole, config.DefaultRole)
+	}
+	for value, role := range config.RoleMapping {
+		if !role.IsValid() {
+			return nil, fmt.Errorf("%w for claim value %q: %s", ErrInvalidRole, value, role)
+		}
+	}
+
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	return &OidcService{
+		config: config,
+		oauth: oauth2.Config{
+			ClientID:     config.ClientId,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  config.RedirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier:   provider.Verifier(&oidc.Config{ClientID: config.ClientId}),
+		auth:       authService,
+		identities: identities,
+	}, nil
+}
+
+type OidcAuthRequest struct {
+	// URL of the provider to redirect the user to.
+	URL string
+	// State, Verifier and Nonce have to be kept until the provider redirects
+	// back to the callback.
+	State    string
+	Verifier string
+	Nonce    string
+}
+
+func (oi *OidcService) BeginSignIn() (OidcAuthRequest, error) {
+	var request OidcAuthRequest
+
+	state, err := randomOidcValue()
+	if err != nil {
+		return request, err
+	}
+	nonce, err := randomOidcValue()
+	if err != nil {
+		return request, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	request.URL = oi.oauth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce))
+	request.State = state
+	request.Verifier = verifier
+	request.Nonce = nonce
+	return request, nil
+}
+
+type OidcSignInParams struct {
+	Code     string
+	Verifier string
+	Nonce    string
+	// UserAgent and IpAddress describe the device signing in.
+	UserAgent string
+	IpAddress string
+}
+
+// SignIn exchanges the authorization code and creates a session for the user
+// of the ID token. The role of the user follows the claims on every sign in.
+func (oi *OidcService) SignIn(ctx context.Context, params OidcSignInParams) (AuthSignInResult, error) {
+	var result AuthSignInResult
+
+	token, err := oi.oauth.Exchange(ctx, params.Code, oauth2.VerifierOption(params.Verifier))
+	if err != nil {
+		return result, fmt.Errorf("%w: %v", ErrOidcSignIn, err)
+	}
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return result, fmt.Errorf("%w: missing ID token", ErrOidcSignIn)
+	}
+	idToken, err := oi.verifier.Verify(ctx, rawIdToken)
+	if err != nil {
+		return result, fmt.Errorf("%w: %v", ErrOidcSignIn, err)
+	}
+	if idToken.Nonce != params.Nonce {
+		return result, fmt.Errorf("%w: invalid nonce", ErrOidcSignIn)
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return result, fmt.Errorf("%w: %v", ErrOidcSignIn, err)
+	}
+	role := oi.roleFromClaims(claims)
+
+	user, err := oi.userForIdentity(ctx, idToken, claims, role)
+	if err != nil {
+		return result, err
+	}
+	if user.Role != role {
+		err := oi.auth.SetUserRole(ctx, SetUserRoleParams{UserId: user.Id, Role: role})
+		if err != nil {
+			return result, err
+		}
+		user.Role = role
+	}
+
+	return oi.auth.createSession(ctx, user, SignInParams{
+		UserName:  user.UserName,
+		UserAgent: params.UserAgent,
+		IpAddress: params.IpAddress,
+	})
+}
+
+// userForIdentity returns the user linked to the subject of the ID token or
+// provisions a new one.
+func (oi *OidcService) userForIdentity(
+	ctx context.Context,
+	idToken *oidc.IDToken,
+	claims map[string]any,
+	role models.Role,
+) (models.User, error) {
+	identity, err := oi.identities.GetIdentity(ctx, repository.GetIdentityParams{
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+	})
+	if err == nil {
+		return oi.auth.GetUserById(ctx, identity.UserId)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return models.User{}, err
+	}
+
+	userName, err := oi.availableUserName(ctx, claims)
+	if err != nil {
+		return models.User{}, err
+	}
+	// Provisioned users sign in with the provider only. Nobody knows the
+	// random password.
+	password, err := randomOidcValue()
+	if err != nil {
+		return models.User{}, err
+	}
+	// The user and its identity are created together, so a failed sign in
+	// leaves no user behind.
+	user, err := oi.auth.CreateUser(ctx, CreateUserParams{
+		UserName: userName,
+		Password: password,
+		Role:     role,
+		Identity: &repository.UserIdentityParams{Issuer: idToken.Issuer, Subject: idToken.Subject},
+	})
+	if err != nil {
+		// A concurrent first sign in of the same subject may have created
+		// the user in the meantime.
+		identity, lookupErr := oi.identities.GetIdentity(ctx, repository.GetIdentityParams{
+			Issuer:  idToken.Issuer,
+			Subject: idToken.Subject,
+		})
+		if lookupErr == nil {
+			return oi.auth.GetUserById(ctx, identity.UserId)
+		}
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// availableUserName derives a valid user name from the claims, which is not
+// taken by another user yet.
+func (oi *OidcService) availableUserName(ctx context.Context, claims map[string]any) (string, error) {
+	name, _ := claims["preferred_username"].(string)
+	if len(name) == 0 {
+		email, _ := claims["email"].(string)
+		name, _, _ = strings.Cut(email, "@")
+	}
+	name = strings.Trim(invalidUserNameChars.ReplaceAllString(name, "-"), "-")
+	if len(name) < 2 {
+		name = "user"
+	}
+
+	candidate := name
+	for i := 2; i <= 100; i++ {
+		_, err := oi.auth.GetUserByName(ctx, candidate)
+		if errors.Is(err, repository.ErrNotFound) {
+			return candidate, nil
+		} else if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	return "", fmt.Errorf("%w: user name %q is taken", ErrOidcSignIn, name)
+}
+
+// roleFromClaims returns the most privileged role mapped from the values of
+// the role claim.
+func (oi *OidcService) roleFromClaims(claims map[string]any) models.Role {
+	var values []string
+	switch claim := claims[oi.config.RoleClaim].(type) {
+	case string:
+		values = append(values, claim)
+	case []any:
+		for _, value := range claim {
+			if value, ok := value.(string); ok {
+				values = append(values, value)
+			}
+		}
+	}
+
+	mapped := map[models.Role]bool{}
+	for _, value := range values {
+		if role, ok := oi.config.RoleMapping[value]; ok {
+			mapped[role] = true
+		}
+	}
+	for _, role := range models.AllRoles() {
+		if mapped[role] {
+			return role
+		}
+	}
+	return oi.config.DefaultRole
+}
+
+// ParseOidcRoleMapping parses a mapping of claim values onto roles in the form
+// "cpaw-admins=admin,cpaw-users=user".
+func ParseOidcRoleMapping(mapping string) (map[string]models.Role, error) {
+	roles := map[string]models.Role{}
+	for _, entry := range strings.Split(mapping, ",") {
+		if len(strings.TrimSpace(entry)) == 0 {
+			continue
+		}
+		value, role, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid role mapping %q", entry)
+		}
+		roles[strings.TrimSpace(value)] = models.Role(strings.TrimSpace(role))
+	}
+	return roles, nil
+}
+
+func randomOidcValue() (string, error) {
+	randomValues := make([]byte, 32)
+	if _, err := rand.Read(randomValues); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomValues), nil
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/models"
+)
+
+const (
+	stubClientId     = "cpaw"
+	stubClientSecret = "secret"
+)
+
+// stubOidcProvider is an OpenID Connect provider, which issues ID tokens with
+// the claims of authorize for PKCE protected authorization codes.
+type stubOidcProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]stubAuthorization
+}
+
+type stubAuthorization struct {
+	challenge string
+	nonce     string
+	claims    map[string]any
+}
+
+func newStubOidcProvider(t *testing.T) *stubOidcProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &stubOidcProvider{key: key, codes: map[string]stubAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                provider.server.URL,
+			"authorization_endpoint":                provider.server.URL + "/authorize",
+			"token_endpoint":                        provider.server.URL + "/token",
+			"jwks_uri":                              provider.server.URL + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "stub", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("POST /token", provider.handleToken)
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+// authorize grants the auth request of authURL for a user with the claims and
+// returns the authorization code.
+func (p *stubOidcProvider) authorize(t *testing.T, authURL string, claims map[string]any) string {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != stubClientId || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("Unexpected auth request: %s", authURL)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code, err := randomOidcValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.codes[code] = stubAuthorization{
+		challenge: query.Get("code_challenge"),
+		nonce:     query.Get("nonce"),
+		claims:    claims,
+	}
+	return code
+}
+
+func (p *stubOidcProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientId, clientSecret = r.FormValue("client_id"), r.FormValue("client_secret")
+	}
+	if clientId != stubClientId || clientSecret != stubClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	p.mu.Lock()
+	authorization, ok := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	p.mu.Unlock()
+
+	verifierSum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifierSum[:]) != authorization.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "invalid_grant"}`))
+		return
+	}
+
+	claims := map[string]any{
+		"iss":   p.server.URL,
+		"aud":   stubClientId,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": authorization.nonce,
+	}
+	for name, value := range authorization.claims {
+		claims[name] = value
+	}
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: p.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "stub"),
+	)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	payload, _ := json.Marshal(claims)
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	idToken, _ := signed.CompactSerialize()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func TestOidcSignIn(t *testing.T) {
+	provider := newStubOidcProvider(t)
+	memory := repository.NewMemoryDB()
+	users := repository.NewMemoryUserRepository(memory)
+	authService := newTestAuthService(memory)
+
+	ctx := context.Background()
+	oidcService, err := NewOidcService(ctx, OidcConfig{
+		Issuer:       provider.server.URL,
+		ClientId:     stubClientId,
+		ClientSecret: stubClientSecret,
+		RedirectURL:  "http://cpaw.test/signin/oidc/callback",
+		RoleClaim:    "groups",
+		RoleMapping:  map[string]models.Role{"cpaw-admins": models.AdminRole},
+	}, authService, repository.NewMemoryIdentityRepository(memory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.CreateUser(ctx, repository.CreateUserParams{UserName: "jane", Password: "pw"}); err != nil {
+		t.Fatal(err)
+	}
+
+	signIn := func(t *testing.T, claims map[string]any) (AuthSignInResult, error) {
+		t.Helper()
+		authRequest, err := oidcService.BeginSignIn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := provider.authorize(t, authRequest.URL, claims)
+		return oidcService.SignIn(ctx, OidcSignInParams{
+			Code:     code,
+			Verifier: authRequest.Verifier,
+			Nonce:    authRequest.Nonce,
+		})
+	}
+	claims := map[string]any{"sub": "jane-subject", "preferred_username": "jane", "groups": []string{"cpaw-admins"}}
+
+	var provisioned models.User
+	t.Run("Provision", func(t *testing.T) {
+		result, err := signIn(t, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		provisioned = result.User
+		if provisioned.UserName != "jane-2" || provisioned.Role != models.AdminRole {
+			t.Errorf("Expected new admin 'jane-2'. Got: %v", provisioned)
+		}
+		if _, err := authService.VerifyToken(ctx, result.Session.Token); err != nil {
+			t.Error("Expected valid session. Got: ", err)
+		}
+	})
+
+	t.Run("RoleFollowsClaims", func(t *testing.T) {
+		result, err := signIn(t, map[string]any{"sub": "jane-subject", "groups": []string{"other"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.User.Id != provisioned.Id || result.User.Role != models.UserRole {
+			t.Errorf("Expected existing user with default role. Got: %v", result.User)
+		}
+	})
+
+	t.Run("ConcurrentFirstSignIn", func(t *testing.T) {
+		claims := map[string]any{"sub": "concurrent-subject", "preferred_username": "concurrent"}
+		params := make([]OidcSignInParams, 8)
+		for i := range params {
+			authRequest, err := oidcService.BeginSignIn()
+			if err != nil {
+				t.Fatal(err)
+			}
+			params[i] = OidcSignInParams{
+				Code:     provider.authorize(t, authRequest.URL, claims),
+				Verifier: authRequest.Verifier,
+				Nonce:    authRequest.Nonce,
+			}
+		}
+
+		results := make([]AuthSignInResult, len(params))
+		errs := make([]error, len(params))
+		var wg sync.WaitGroup
+		for i := range params {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], errs[i] = oidcService.SignIn(ctx, params[i])
+			}()
+		}
+		wg.Wait()
+
+		for i, err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[i].User.Id != results[0].User.Id {
+				t.Errorf("Expected a single user. Got: %v, %v", results[i].User, results[0].User)
+			}
+		}
+		users, err := authService.ListUsers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, user := range users {
+			if user.UserName != "concurrent" && strings.HasPrefix(user.UserName, "concurrent") {
+				t.Errorf("Unexpected orphaned user: %v", user)
+			}
+		}
+	})
+
+	t.Run("InvalidVerifier", func(t *testing.T) {
+		authRequest, err := oidcService.BeginSignIn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := provider.authorize(t, authRequest.URL, claims)
+		_, err = oidcService.SignIn(ctx, OidcSignInParams{Code: code, Verifier: "wrong", Nonce: authRequest.Nonce})
+		if !errors.Is(err, ErrOidcSignIn) {
+			t.Error("Expected 'ErrOidcSignIn'. Got: ", err)
+		}
+	})
+
+	t.Run("InvalidNonce", func(t *testing.T) {
+		authRequest, err := oidcService.BeginSignIn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := provider.authorize(t, authRequest.URL, claims)
+		_, err = oidcService.SignIn(ctx, OidcSignInParams{Code: code, Verifier: authRequest.Verifier, Nonce: "wrong"})
+		if !errors.Is(err, ErrOidcSignIn) {
+			t.Error("Expected 'ErrOidcSignIn'. Got: ", err)
+		}
+	})
+}
+
+func TestParseOidcRoleMapping(t *testing.T) {
+	got, err := ParseOidcRoleMapping(" cpaw-admins=admin, staff=user ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["cpaw-admins"] != models.AdminRole || got["staff"] != models.UserRole {
+		t.Errorf("Unexpected mapping: %v", got)
+	}
+	if _, err := ParseOidcRoleMapping("admin"); err == nil {
+		t.Error("Expected error for entry without role")
+	}
+}
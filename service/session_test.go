@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/models"
+)
+
+// newTestAuthService creates an AuthService with memory repositories.
+func newTestAuthService(memory *repository.MemoryDB) *AuthService {
+	return NewAuthService(
+		repository.NewMemorySessionRepository(memory),
+		repository.NewMemoryUserRepository(memory),
+		repository.NewMemoryApiTokenRepository(memory),
+		repository.NewMemoryLoginAttemptRepository(memory),
+		repository.NewMemoryTwoFactorRepository(memory),
+	)
+}
+
+// agedSessionStore moves the creation and expiration of sessions into the
+// past. Expirations are stored shifted by the age, so renewals read back the
+// stored time.
+type agedSessionStore struct {
+	repository.SessionStore
+	mu   sync.Mutex
+	ages map[string]sessionAge
+}
+
+type sessionAge struct {
+	created time.Duration
+	expires time.Duration
+}
+
+func newAgedSessionStore(sessions repository.SessionStore) *agedSessionStore {
+	return &agedSessionStore{SessionStore: sessions, ages: map[string]sessionAge{}}
+}
+
+func (ss *agedSessionStore) age(token string, created time.Duration, expires time.Duration) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.ages[token] = sessionAge{created: created, expires: expires}
+}
+
+func (ss *agedSessionStore) GetSessionByToken(ctx context.Context, sessionToken string) (models.Session, error) {
+	session, err := ss.SessionStore.GetSessionByToken(ctx, sessionToken)
+	if err != nil {
+		return session, err
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	age := ss.ages[sessionToken]
+	session.CreatedAt -= int64(age.created.Seconds())
+	session.ExpiresAt -= int64(age.expires.Seconds())
+	return session, nil
+}
+
+func (ss *agedSessionStore) UpdateSessionActivity(
+	ctx context.Context,
+	arg repository.UpdateSessionActivityParams,
+) error {
+	ss.mu.Lock()
+	arg.ExpiresAt = arg.ExpiresAt.Add(ss.ages[arg.Token].expires)
+	ss.mu.Unlock()
+	return ss.SessionStore.UpdateSessionActivity(ctx, arg)
+}
+
+func TestSessionRenewal(t *testing.T) {
+	memory := repository.NewMemoryDB()
+	sessions := newAgedSessionStore(repository.NewMemorySessionRepository(memory))
+	authService := NewAuthService(
+		sessions,
+		repository.NewMemoryUserRepository(memory),
+		repository.NewMemoryApiTokenRepository(memory),
+		repository.NewMemoryLoginAttemptRepository(memory),
+		repository.NewMemoryTwoFactorRepository(memory),
+	)
+
+	ctx := context.Background()
+	_, err := authService.CreateUser(ctx, CreateUserParams{UserName: "session_user", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signIn := func(t *testing.T, remember bool) string {
+		t.Helper()
+		result, err := authService.SignIn(ctx, SignInParams{
+			UserName: "session_user",
+			Password: "password",
+			Remember: remember,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Session.Token
+	}
+	t.Run("Throttled", func(t *testing.T) {
+		token := signIn(t, false)
+		session, err := authService.VerifyToken(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.Renewed {
+			t.Error("Expected fresh session not to be renewed")
+		}
+	})
+
+	t.Run("Sliding", func(t *testing.T) {
+		token := signIn(t, false)
+		sessions.age(token, DefaultSessionDuration/2, DefaultSessionDuration/2)
+
+		session, err := authService.VerifyToken(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := time.Now().Add(DefaultSessionDuration).Unix()
+		if !session.Renewed || session.ExpiresAt < want-1 {
+			t.Errorf("Expected session to expire at %d. Got: %v", want, session)
+		}
+		stored, err := sessions.GetSessionByToken(ctx, token)
+		if err != nil || stored.ExpiresAt != session.ExpiresAt {
+			t.Errorf("Expected renewal to be stored. Got: %v %v", stored, err)
+		}
+	})
+
+	t.Run("MaxLifetime", func(t *testing.T) {
+		token := signIn(t, false)
+		sessions.age(token, DefaultMaxSessionLifetime-time.Minute*10, time.Minute*10)
+
+		session, err := authService.VerifyToken(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := session.CreatedAt + int64(DefaultMaxSessionLifetime.Seconds())
+		if session.ExpiresAt != want {
+			t.Errorf("Expected session to expire at max. lifetime %d. Got: %d", want, session.ExpiresAt)
+		}
+	})
+
+	t.Run("Remember", func(t *testing.T) {
+		token := signIn(t, true)
+		sessions.age(token, DefaultSessionDuration*2, DefaultSessionDuration*2)
+
+		session, err := authService.VerifyToken(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := time.Now().Add(RememberedSessionDuration).Unix()
+		if !session.Remember || session.ExpiresAt < want-1 {
+			t.Errorf("Expected remembered session to expire at %d. Got: %v", want, session)
+		}
+	})
+}
+
+func TestUpdatePasswordRevokesOtherSessions(t *testing.T) {
+	authService := newTestAuthService(repository.NewMemoryDB())
+
+	ctx := context.Background()
+	user, err := authService.CreateUser(ctx, CreateUserParams{UserName: "password_user", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens []string
+	for range 3 {
+		result, err := authService.SignIn(ctx, SignInParams{UserName: "password_user", Password: "password"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, result.Session.Token)
+	}
+
+	err = authService.UpdatePassword(ctx, UpdatePasswordParams{
+		UserId:       user.Id,
+		Password:     "new_password",
+		SessionToken: tokens[0],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := authService.VerifyToken(ctx, tokens[0]); err != nil {
+		t.Error("Expected current session to stay valid. Got: ", err)
+	}
+	for _, token := range tokens[1:] {
+		if _, err := authService.VerifyToken(ctx, token); err == nil {
+			t.Error("Expected other session to be revoked")
+		}
+	}
+}
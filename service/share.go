@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/hash"
+	"github.com/michaelhass/cpaw/models"
+)
+
+const DefaultShareTokenLength int = 24
+
+var (
+	ErrShareExpiresAt     = errors.New("Expiration date must be in the future")
+	ErrShareMaxViews      = errors.New("Max. views can't be negative")
+	ErrShareBurnAfterRead = errors.New("Burn after read items can't be shared")
+	// ErrSharePassword is returned when viewing a password protected share
+	// without or with a wrong password.
+	ErrSharePassword = errors.New("Invalid password")
+)
+
+type ShareService struct {
+	shares        repository.ShareStore
+	items         repository.ItemStore
+	loginAttempts repository.LoginAttemptStore
+}
+
+func NewShareService(
+	shares repository.ShareStore,
+	items repository.ItemStore,
+	loginAttempts repository.LoginAttemptStore,
+) *ShareService {
+	return &ShareService{shares: shares, items: items, loginAttempts: loginAttempts}
+}
+
+type CreateShareParams struct {
+	ItemId    string
+	UserId    string
+	ExpiresAt time.Time
+	MaxViews  int64
+	// Password is optional.
+	Password string
+}
+
+func (ss *ShareService) CreateShare(ctx context.Context, params CreateShareParams) (models.Share, error) {
+	if !params.ExpiresAt.IsZero() && !params.ExpiresAt.After(time.Now()) {
+		return models.Share{}, ErrShareExpiresAt
+	}
+	if params.MaxViews < 0 {
+		return models.Share{}, ErrShareMaxViews
+	}
+
+	// GetItemForUser would burn burn after read items.
+	item, err := ss.items.GetItemById(ctx, params.ItemId)
+	if err != nil {
+		return models.Share{}, err
+	}
+	if item.UserId != params.UserId {
+		return models.Share{}, repository.ErrNotFound
+	}
+	if item.BurnAfterRead {
+		return models.Share{}, ErrShareBurnAfterRead
+	}
+
+	token, err := generateShareToken(DefaultShareTokenLength)
+	if err != nil {
+		return models.Share{}, err
+	}
+
+	var passwordHash string
+	if len(params.Password) > 0 {
+		passwordHash, err = hash.NewFromPassword(params.Password)
+		if err != nil {
+			return models.Share{}, err
+		}
+	}
+
+	return ss.shares.CreateShare(ctx, repository.CreateShareParams{
+		ItemId:       params.ItemId,
+		UserId:       params.UserId,
+		Token:        token,
+		ExpiresAt:    params.ExpiresAt,
+		MaxViews:     params.MaxViews,
+		PasswordHash: passwordHash,
+	})
+}
+
+type ListSharesForItemParams = repository.ListSharesForItemParams
+
+func (ss *ShareService) ListSharesForItem(ctx context.Context, params ListSharesForItemParams) ([]models.Share, error) {
+	return ss.shares.ListSharesForItem(ctx, params)
+}
+
+type RevokeShareParams = repository.DeleteShareForUserParams
+
+func (ss *ShareService) RevokeShare(ctx context.Context, params RevokeShareParams) error {
+	return ss.shares.DeleteShareForUser(ctx, params)
+}
+
+// GetShare returns an active share. Unlike ViewShare it does not count as
+// a view.
+func (ss *ShareService) GetShare(ctx context.Context, token string) (models.Share, error) {
+	share, err := ss.shares.GetShareByToken(ctx, token)
+	if err != nil {
+		return share, err
+	}
+	if !share.IsActive() {
+		return models.Share{}, repository.ErrNotFound
+	}
+	return share, nil
+}
+
+type ViewShareParams struct {
+	Token    string
+	Password string
+}
+
+// ViewShare returns the shared item and counts the view. Expired, used up
+// and unknown shares all result in repository.ErrNotFound. Wrong passwords are
+// counted per share, which is temporarily locked after too many of them.
+func (ss *ShareService) ViewShare(ctx context.Context, params ViewShareParams) (models.Item, error) {
+	share, err := ss.GetShare(ctx, params.Token)
+	if err != nil {
+		return models.Item{}, err
+	}
+	if share.HasPassword {
+		if err := ss.verifyPassword(ctx, share, params.Password); err != nil {
+			return models.Item{}, err
+		}
+	}
+
+	item, err := ss.items.GetItemById(ctx, share.ItemId)
+	if err != nil {
+		return models.Item{}, err
+	}
+	if item.BurnAfterRead {
+		return models.Item{}, repository.ErrNotFound
+	}
+
+	if err := ss.shares.CountView(ctx, share.Id); err != nil {
+		return models.Item{}, err
+	}
+	return item, nil
+}
+
+// verifyPassword checks the password of a share, unless too many wrong ones
+// have been tried. A missing password is no guess and isn't counted.
+func (ss *ShareService) verifyPassword(ctx context.Context, share models.Share, password string) error {
+	attemptKeys := []repository.GetLoginAttemptParams{
+		{Scope: models.ShareLoginAttemptScope, Key: share.Id},
+	}
+	if err := checkLoginLocks(ctx, ss.loginAttempts, attemptKeys); err != nil {
+		return err
+	}
+	if len(password) == 0 {
+		return ErrSharePassword
+	}
+	if !hash.VerifyPassword(password, share.PasswordHash) {
+		if err := recordLoginFailure(ctx, ss.loginAttempts, attemptKeys); err != nil {
+			return err
+		}
+		return ErrSharePassword
+	}
+	return ss.loginAttempts.DeleteLoginAttempt(ctx, attemptKeys[0])
+}
+
+func generateShareToken(length int) (string, error) {
+	randomValues := make([]byte, length)
+	if _, err := rand.Read(randomValues); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomValues), nil
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/hash"
+	"github.com/michaelhass/cpaw/models"
+	"github.com/michaelhass/cpaw/totp"
+)
+
+const (
+	TotpIssuer string = "cpaw"
+	// LoginChallengeDuration is the time to enter the second factor after
+	// signing in with a password.
+	LoginChallengeDuration time.Duration = time.Minute * 5
+	RecoveryCodeCount      int           = 10
+	recoveryCodeLength     int           = 10
+)
+
+var (
+	ErrTwoFactorEnabled      = errors.New("Two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled  = errors.New("Please start the two-factor setup first")
+	ErrInvalidTwoFactorCode  = errors.New("Invalid authentication code")
+	ErrExpiredLoginChallenge = errors.New("Sign in expired. Please sign in again")
+
+	recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+type TotpEnrollment struct {
+	Secret string
+	// URL is the otpauth URL, which authenticator apps scan as QR code.
+	URL string
+}
+
+// BeginTotpEnrollment creates a new secret for the user. Two-factor
+// authentication is only enabled once a code of the secret is confirmed with
+// ConfirmTotpEnrollment.
+func (as *AuthService) BeginTotpEnrollment(ctx context.Context, userId string) (TotpEnrollment, error) {
+	var enrollment TotpEnrollment
+
+	user, err := as.users.GetUserById(ctx, userId)
+	if err != nil {
+		return enrollment, err
+	}
+	if user.TwoFactorEnabled {
+		return enrollment, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return enrollment, err
+	}
+	err = as.users.SetTotpSecret(ctx, repository.SetTotpSecretParams{UserId: userId, Secret: secret})
+	if err != nil {
+		return enrollment, err
+	}
+	enrollment.Secret = secret
+	enrollment.URL = totp.URL(TotpIssuer, user.UserName, secret)
+	return enrollment, nil
+}
+
+type ConfirmTotpEnrollmentParams struct {
+	UserId string
+	Code   string
+}
+
+// ConfirmTotpEnrollment enables two-factor authentication and returns new
+// recovery codes, which are only stored hashed.
+func (as *AuthService) ConfirmTotpEnrollment(
+	ctx context.Context,
+	params ConfirmTotpEnrollmentParams,
+) ([]string, error) {
+	user, err := as.users.GetUserById(ctx, params.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if len(user.TotpSecret) == 0 {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := totp.Validate(user.TotpSecret, params.Code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	err = as.users.UseTotpStep(ctx, repository.UseTotpStepParams{UserId: user.Id, Step: step, Enable: true})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidTwoFactorCode
+	} else if err != nil {
+		return nil, err
+	}
+	return as.regenerateRecoveryCodes(ctx, user.Id)
+}
+
+func (as *AuthService) regenerateRecoveryCodes(ctx context.Context, userId string) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		randomValues := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(randomValues); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(randomValues))
+		codes[i] = code[:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:]
+		hashes[i] = hash.NewFromToken(code)
+	}
+
+	err := as.twoFactor.ReplaceRecoveryCodes(ctx, repository.ReplaceRecoveryCodesParams{
+		UserId:     userId,
+		CodeHashes: hashes,
+	})
+	return codes, err
+}
+
+func (as *AuthService) CountRecoveryCodes(ctx context.Context, userId string) (int, error) {
+	return as.twoFactor.CountRecoveryCodes(ctx, userId)
+}
+
+type DisableTwoFactorParams struct {
+	UserId string
+	// Password confirms that the user disables the second factor.
+	Password string
+}
+
+func (as *AuthService) DisableTwoFactor(ctx context.Context, params DisableTwoFactorParams) error {
+	user, err := as.users.GetUserById(ctx, params.UserId)
+	if err != nil {
+		return err
+	}
+	if !hash.VerifyPassword(params.Password, user.PasswordHash) {
+		return ErrInvalidCredentials
+	}
+	return as.disableTwoFactor(ctx, user.Id)
+}
+
+type ResetTwoFactorParams struct {
+	UserId string
+	// ResetBy is the user resetting the second factor, who needs permission
+	// to manage users.
+	ResetBy string
+}
+
+// ResetTwoFactor disables two-factor authentication of a user, who lost
+// access to the authenticator app and the recovery codes.
+func (as *AuthService) ResetTwoFactor(ctx context.Context, params ResetTwoFactorParams) error {
+	if err := as.Authorize(ctx, params.ResetBy, models.ManageUsersPermission); err != nil {
+		return err
+	}
+	if _, err := as.users.GetUserById(ctx, params.UserId); err != nil {
+		return err
+	}
+	return as.disableTwoFactor(ctx, params.UserId)
+}
+
+func (as *AuthService) disableTwoFactor(ctx context.Context, userId string) error {
+	if err := as.users.DisableTotp(ctx, userId); err != nil {
+		return err
+	}
+	return as.twoFactor.DeleteRecoveryCodes(ctx, userId)
+}
+
+func (as *AuthService) createLoginChallenge(
+	ctx context.Context,
+	user models.User,
+	params SignInParams,
+) (string, error) {
+	token, err := generateSessionToken(DefaultSessionTokenLength)
+	if err != nil {
+		return "", err
+	}
+	_, err = as.twoFactor.CreateLoginChallenge(ctx, repository.CreateLoginChallengeParams{
+		TokenHash: hash.NewFromToken(token),
+		UserId:    user.Id,
+		ExpiresAt: time.Now().Add(LoginChallengeDuration),
+		Remember:  params.Remember,
+		UserAgent: params.UserAgent,
+		IpAddress: params.IpAddress,
+	})
+	return token, err
+}
+
+type VerifyTwoFactorParams struct {
+	// Token is the TwoFactorToken returned by SignIn.
+	Token string
+	// Code is either a code of the authenticator app or a recovery code.
+	Code string
+}
+
+// VerifyTwoFactor completes a sign in with the second factor. Failures count
+// towards the lockout of the user name and IP address like wrong passwords.
+func (as *AuthService) VerifyTwoFactor(ctx context.Context, params VerifyTwoFactorParams) (AuthSignInResult, error) {
+	var result AuthSignInResult
+
+	tokenHash := hash.NewFromToken(params.Token)
+	challenge, err := as.twoFactor.GetLoginChallengeByHash(ctx, tokenHash)
+	if errors.Is(err, repository.ErrNotFound) {
+		return result, ErrExpiredLoginChallenge
+	} else if err != nil {
+		return result, err
+	}
+	if time.Now().Unix() > challenge.ExpiresAt {
+		return result, ErrExpiredLoginChallenge
+	}
+
+	user, err := as.users.GetUserById(ctx, challenge.UserId)
+	if errors.Is(err, repository.ErrNotFound) {
+		return result, ErrExpiredLoginChallenge
+	} else if err != nil {
+		return result, err
+	}
+
+	signInParams := SignInParams{
+		UserName:  user.UserName,
+		Remember:  challenge.Remember,
+		UserAgent: challenge.UserAgent,
+		IpAddress: challenge.IpAddress,
+	}
+	attemptKeys := loginAttemptKeys(signInParams)
+	if err := checkLoginLocks(ctx, as.loginAttempts, attemptKeys); err != nil {
+		return result, err
+	}
+
+	if err := as.verifySecondFactor(ctx, user, params.Code); errors.Is(err, ErrInvalidTwoFactorCode) {
+		if err := recordLoginFailure(ctx, as.loginAttempts, attemptKeys); err != nil {
+			return result, err
+		}
+		return result, err
+	} else if err != nil {
+		return result, err
+	}
+
+	if err := as.twoFactor.DeleteLoginChallenge(ctx, tokenHash); err != nil {
+		return result, err
+	}
+	return as.createSession(ctx, user, signInParams)
+}
+
+// verifySecondFactor accepts each TOTP code and each recovery code only once.
+func (as *AuthService) verifySecondFactor(ctx context.Context, user models.User, code string) error {
+	if !user.TwoFactorEnabled {
+		return nil
+	}
+
+	if step, ok := totp.Validate(user.TotpSecret, code, time.Now()); ok {
+		err := as.users.UseTotpStep(ctx, repository.UseTotpStepParams{UserId: user.Id, Step: step})
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	err := as.twoFactor.UseRecoveryCode(ctx, repository.UseRecoveryCodeParams{
+		UserId:   user.Id,
+		CodeHash: hash.NewFromToken(normalized),
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidTwoFactorCode
+	}
+	return err
+}
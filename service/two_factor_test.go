@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/models"
+	"github.com/michaelhass/cpaw/totp"
+)
+
+func TestTwoFactorSignIn(t *testing.T) {
+	authService := newTestAuthService(repository.NewMemoryDB())
+
+	ctx := context.Background()
+	admin, err := authService.CreateUser(ctx, CreateUserParams{
+		UserName: "two_factor_admin",
+		Password: "password",
+		Role:     models.AdminRole,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := authService.CreateUser(ctx, CreateUserParams{UserName: "two_factor_user", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signIn := func(t *testing.T) AuthSignInResult {
+		t.Helper()
+		result, err := authService.SignIn(ctx, SignInParams{UserName: user.UserName, Password: "password"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	enrollment, err := authService.BeginTotpEnrollment(ctx, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := signIn(t); len(result.Session.Token) == 0 || len(result.TwoFactorToken) > 0 {
+		t.Error("Expected unconfirmed enrollment not to require a second factor")
+	}
+
+	_, err = authService.ConfirmTotpEnrollment(ctx, ConfirmTotpEnrollmentParams{UserId: user.Id, Code: "000000"})
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatal("Expected 'ErrInvalidTwoFactorCode'. Got: ", err)
+	}
+	code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	recoveryCodes, err := authService.ConfirmTotpEnrollment(ctx, ConfirmTotpEnrollmentParams{
+		UserId: user.Id,
+		Code:   code,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recoveryCodes) != RecoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes. Got: %d", RecoveryCodeCount, len(recoveryCodes))
+	}
+
+	t.Run("Totp", func(t *testing.T) {
+		result := signIn(t)
+		if len(result.Session.Token) > 0 || len(result.TwoFactorToken) == 0 {
+			t.Fatal("Expected sign in to require a second factor")
+		}
+
+		_, err := authService.VerifyTwoFactor(ctx, VerifyTwoFactorParams{Token: result.TwoFactorToken, Code: code})
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Error("Expected replayed code to be rejected. Got: ", err)
+		}
+		nextCode, _ := totp.Code(enrollment.Secret, totp.Step(time.Now())+1)
+		verified, err := authService.VerifyTwoFactor(ctx, VerifyTwoFactorParams{
+			Token: result.TwoFactorToken,
+			Code:  nextCode,
+		})
+		if err != nil || len(verified.Session.Token) == 0 {
+			t.Fatalf("Expected session. Got: %v %v", verified, err)
+		}
+
+		_, err = authService.VerifyTwoFactor(ctx, VerifyTwoFactorParams{Token: result.TwoFactorToken, Code: nextCode})
+		if !errors.Is(err, ErrExpiredLoginChallenge) {
+			t.Error("Expected used challenge to be rejected. Got: ", err)
+		}
+	})
+
+	t.Run("RecoveryCode", func(t *testing.T) {
+		result := signIn(t)
+		verified, err := authService.VerifyTwoFactor(ctx, VerifyTwoFactorParams{
+			Token: result.TwoFactorToken,
+			Code:  recoveryCodes[0],
+		})
+		if err != nil || len(verified.Session.Token) == 0 {
+			t.Fatalf("Expected session. Got: %v %v", verified, err)
+		}
+
+		result = signIn(t)
+		_, err = authService.VerifyTwoFactor(ctx, VerifyTwoFactorParams{
+			Token: result.TwoFactorToken,
+			Code:  recoveryCodes[0],
+		})
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Error("Expected used recovery code to be rejected. Got: ", err)
+		}
+		if count, _ := authService.CountRecoveryCodes(ctx, user.Id); count != RecoveryCodeCount-1 {
+			t.Errorf("Expected %d recovery codes left. Got: %d", RecoveryCodeCount-1, count)
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		err := authService.ResetTwoFactor(ctx, ResetTwoFactorParams{UserId: user.Id, ResetBy: user.Id})
+		if !errors.Is(err, ErrPermissionDenied) {
+			t.Error("Expected 'ErrPermissionDenied'. Got: ", err)
+		}
+		if err := authService.ResetTwoFactor(ctx, ResetTwoFactorParams{UserId: user.Id, ResetBy: admin.Id}); err != nil {
+			t.Fatal(err)
+		}
+		if result := signIn(t); len(result.Session.Token) == 0 {
+			t.Error("Expected sign in without second factor after reset")
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/models"
+)
+
+const MaxWorkspaceNameLength int = 64
+
+var (
+	ErrWorkspaceName       = errors.New("Please provide a name of max. 64 characters")
+	ErrWorkspaceOwnerLeave = errors.New("The owner can't leave a workspace. Please delete it instead")
+	ErrUnknownUser         = errors.New("Unknown user")
+)
+
+type WorkspaceService struct {
+	workspaces repository.WorkspaceStore
+	users      repository.UserStore
+}
+
+func NewWorkspaceService(
+	workspaces repository.WorkspaceStore,
+	users repository.UserStore,
+) *WorkspaceService {
+	return &WorkspaceService{workspaces: workspaces, users: users}
+}
+
+type CreateWorkspaceParams = repository.CreateWorkspaceParams
+
+func (ws *WorkspaceService) CreateWorkspace(ctx context.Context, params CreateWorkspaceParams) (models.Workspace, error) {
+	params.Name = strings.TrimSpace(params.Name)
+	if len(params.Name) == 0 || len(params.Name) > MaxWorkspaceNameLength {
+		return models.Workspace{}, ErrWorkspaceName
+	}
+	return ws.workspaces.CreateWorkspace(ctx, params)
+}
+
+func (ws *WorkspaceService) ListWorkspacesForUser(ctx context.Context, userId string) ([]models.Workspace, error) {
+	return ws.workspaces.ListWorkspacesForUser(ctx, userId)
+}
+
+type GetWorkspaceForUserParams = repository.GetWorkspaceForUserParams
+
+// GetWorkspaceForUser returns a workspace the user is a member of.
+func (ws *WorkspaceService) GetWorkspaceForUser(
+	ctx context.Context,
+	params GetWorkspaceForUserParams,
+) (models.Workspace, error) {
+	return ws.workspaces.GetWorkspaceForUser(ctx, params)
+}
+
+// ListMembers lists the members of a workspace, which only members can see.
+func (ws *WorkspaceService) ListMembers(
+	ctx context.Context,
+	params GetWorkspaceForUserParams,
+) ([]models.WorkspaceMember, error) {
+	if _, err := ws.workspaces.GetWorkspaceForUser(ctx, params); err != nil {
+		return nil, err
+	}
+	return ws.workspaces.ListMembers(ctx, params.WorkspaceId)
+}
+
+type AddWorkspaceMemberParams struct {
+	WorkspaceId string
+	// UserId is the user adding the member, who has to own the workspace.
+	UserId string
+	// MemberName is the user name of the new member.
+	MemberName string
+}
+
+func (ws *WorkspaceService) AddMember(ctx context.Context, params AddWorkspaceMemberParams) error {
+	if err := ws.authorizeOwner(ctx, params.WorkspaceId, params.UserId); err != nil {
+		return err
+	}
+	member, err := ws.users.GetUserByName(ctx, strings.TrimSpace(params.MemberName))
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrUnknownUser
+	} else if err != nil {
+		return err
+	}
+	return ws.workspaces.AddMember(ctx, repository.AddWorkspaceMemberParams{
+		WorkspaceId: params.WorkspaceId,
+		UserId:      member.Id,
+		Role:        models.WorkspaceMemberRole,
+	})
+}
+
+type RemoveWorkspaceMemberParams struct {
+	WorkspaceId string
+	// UserId is the user removing the member. Only the owner can remove
+	// other members, everyone else can only leave the workspace.
+	UserId   string
+	MemberId string
+}
+
+func (ws *WorkspaceService) RemoveMember(ctx context.Context, params RemoveWorkspaceMemberParams) error {
+	workspace, err := ws.workspaces.GetWorkspaceForUser(ctx, GetWorkspaceForUserParams{
+		WorkspaceId: params.WorkspaceId,
+		UserId:      params.UserId,
+	})
+	if err != nil {
+		return err
+	}
+	if params.MemberId == workspace.OwnerId {
+		return ErrWorkspaceOwnerLeave
+	}
+	if params.MemberId != params.UserId && workspace.Role != models.WorkspaceOwnerRole {
+		return ErrPermissionDenied
+	}
+	return ws.workspaces.RemoveMember(ctx, repository.RemoveWorkspaceMemberParams{
+		WorkspaceId: params.WorkspaceId,
+		UserId:      params.MemberId,
+	})
+}
+
+// DeleteWorkspace deletes a workspace including all of its items.
+func (ws *WorkspaceService) DeleteWorkspace(ctx context.Context, params GetWorkspaceForUserParams) error {
+	if err := ws.authorizeOwner(ctx, params.WorkspaceId, params.UserId); err != nil {
+		return err
+	}
+	return ws.workspaces.DeleteWorkspace(ctx, params.WorkspaceId)
+}
+
+func (ws *WorkspaceService) authorizeOwner(ctx context.Context, workspaceId string, userId string) error {
+	workspace, err := ws.workspaces.GetWorkspaceForUser(ctx, GetWorkspaceForUserParams{
+		WorkspaceId: workspaceId,
+		UserId:      userId,
+	})
+	if err != nil {
+		return err
+	}
+	if workspace.Role != models.WorkspaceOwnerRole {
+		return ErrPermissionDenied
+	}
+	return nil
+}
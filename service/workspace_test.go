@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/michaelhass/cpaw/db/repository"
+	"github.com/michaelhass/cpaw/models"
+)
+
+func TestWorkspaceAuthorization(t *testing.T) {
+	memory := repository.NewMemoryDB()
+
+	users := repository.NewMemoryUserRepository(memory)
+	workspaces := repository.NewMemoryWorkspaceRepository(memory)
+	events := NewItemEventHub()
+	itemService := NewItemService(repository.NewMemoryItemRepository(memory), workspaces, events)
+	workspaceService := NewWorkspaceService(workspaces, users)
+
+	ctx := context.Background()
+	var (
+		owner, member, outsider models.User
+		err                     error
+	)
+	for name, user := range map[string]*models.User{"owner": &owner, "member": &member, "outsider": &outsider} {
+		if *user, err = users.CreateUser(ctx, repository.CreateUserParams{UserName: name, Password: "pw"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	workspace, err := workspaceService.CreateWorkspace(ctx, CreateWorkspaceParams{Name: "team", OwnerId: owner.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = workspaceService.AddMember(ctx, AddWorkspaceMemberParams{
+		WorkspaceId: workspace.Id,
+		UserId:      owner.Id,
+		MemberName:  member.UserName,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ownerEvents, unsubscribe := itemService.SubscribeItemEvents(owner.Id)
+	defer unsubscribe()
+
+	t.Run("MembersPost", func(t *testing.T) {
+		item, err := itemService.CreateItem(ctx, CreateItemsParams{
+			Content:     "build link",
+			UserId:      member.Id,
+			WorkspaceId: workspace.Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case event := <-ownerEvents:
+			if event.ItemId != item.Id || event.WorkspaceId != workspace.Id {
+				t.Errorf("Unexpected event: %v", event)
+			}
+		default:
+			t.Error("Expected event for workspace owner")
+		}
+
+		_, err = itemService.CreateItem(ctx, CreateItemsParams{
+			Content:     "intruder",
+			UserId:      outsider.Id,
+			WorkspaceId: workspace.Id,
+		})
+		if !errors.Is(err, repository.ErrNotFound) {
+			t.Error("Expected 'ErrNotFound' for non-member. Got: ", err)
+		}
+	})
+
+	t.Run("MembersRead", func(t *testing.T) {
+		item, err := itemService.CreateItem(ctx, CreateItemsParams{
+			Content:     "credentials",
+			UserId:      owner.Id,
+			WorkspaceId: workspace.Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-ownerEvents
+
+		got, err := itemService.GetItemForUser(ctx, GetItemForUserParams{ItemId: item.Id, UserId: member.Id})
+		if err != nil || got.Content != "credentials" {
+			t.Errorf("Expected member to read item. Got: %v %v", got, err)
+		}
+		_, err = itemService.GetItemForUser(ctx, GetItemForUserParams{ItemId: item.Id, UserId: outsider.Id})
+		if !errors.Is(err, repository.ErrNotFound) {
+			t.Error("Expected 'ErrNotFound' for non-member. Got: ", err)
+		}
+
+		err = itemService.DeleteItemForUser(ctx, DeleteUserItemParams{ItemId: item.Id, UserId: member.Id})
+		if !errors.Is(err, ErrPermissionDenied) {
+			t.Error("Expected 'ErrPermissionDenied' for item of other member. Got: ", err)
+		}
+	})
+
+	t.Run("OwnerRemovesOthers", func(t *testing.T) {
+		item, err := itemService.CreateItem(ctx, CreateItemsParams{
+			Content:     "stale",
+			UserId:      member.Id,
+			WorkspaceId: workspace.Id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-ownerEvents
+
+		if err := itemService.DeleteItemForUser(ctx, DeleteUserItemParams{ItemId: item.Id, UserId: owner.Id}); err != nil {
+			t.Error(err)
+		}
+
+		err = workspaceService.RemoveMember(ctx, RemoveWorkspaceMemberParams{
+			WorkspaceId: workspace.Id,
+			UserId:      member.Id,
+			MemberId:    owner.Id,
+		})
+		if !errors.Is(err, ErrWorkspaceOwnerLeave) {
+			t.Error("Expected 'ErrWorkspaceOwnerLeave'. Got: ", err)
+		}
+		err = workspaceService.RemoveMember(ctx, RemoveWorkspaceMemberParams{
+			WorkspaceId: workspace.Id,
+			UserId:      owner.Id,
+			MemberId:    member.Id,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		_, err = itemService.ListItemsForUser(ctx, ListItemsForUserParams{
+			UserId:      member.Id,
+			WorkspaceId: workspace.Id,
+		})
+		if !errors.Is(err, repository.ErrNotFound) {
+			t.Error("Expected 'ErrNotFound' for removed member. Got: ", err)
+		}
+	})
+}
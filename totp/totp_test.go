@@ -0,0 +1,53 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	// Test vectors of RFC 6238 for SHA1, truncated to 6 digits.
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	previous, _ := Code(secret, Step(now)-1)
+	if step, ok := Validate(secret, previous, now); !ok || step != Step(now)-1 {
+		t.Errorf("Expected code of previous step to be valid. Got: %d %v", step, ok)
+	}
+	stale, _ := Code(secret, Step(now)-2)
+	if _, ok := Validate(secret, stale, now); ok {
+		t.Error("Expected stale code to be invalid")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Error("Expected short code to be invalid")
+	}
+}